@@ -63,8 +63,13 @@ func main() {
 	log.Println("Database connection established successfully")
 
 	// Initialize services
-	ragService := service.NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
-	log.Println("RAG service initialized")
+	ragService := service.NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint, service.WithConfig(cfg))
+	log.Printf("RAG service initialized (embedding provider: %s, model: %s)", cfg.Embedding.Provider, cfg.Embedding.Model)
+
+	// Verify the configured embedding model matches the stored embeddings
+	if err := ragService.CheckEmbeddingSchema(context.Background()); err != nil {
+		log.Fatalf("Embedding schema check failed: %v", err)
+	}
 
 	// Create context that will be canceled on shutdown
 	ctx, cancel := context.WithCancel(context.Background())
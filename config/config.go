@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"strconv"
+	"strings"
 
 	"github.com/joho/godotenv"
 )
@@ -14,6 +16,14 @@ type Config struct {
 	OpenAIKey     string
 	OpenAIBaseURL string
 	MCPEndpoint   string
+	Embedding     EmbeddingConfig
+	Chunking      ChunkingConfig
+	Query         QueryConfig
+	Rerank        RerankConfig
+	Answer        AnswerConfig
+	Chat          ChatConfig
+	Extraction    ExtractionConfig
+	Resolution    ResolutionConfig
 }
 
 // DBConfig holds database configuration
@@ -25,6 +35,89 @@ type DBConfig struct {
 	DBName   string
 }
 
+// EmbeddingConfig holds embedding provider configuration
+type EmbeddingConfig struct {
+	Provider       string // "openai" or "hash"
+	Model          string
+	Dimensions     int
+	BatchSize      int // maximum number of texts per embedding request
+	MaxBatchTokens int // maximum estimated tokens per embedding request
+	CacheEnabled   bool
+}
+
+// ChunkingConfig holds the default chunking settings, used when a request does not specify them
+type ChunkingConfig struct {
+	Strategy string // "markdown", "sentence", "token_window" or "recursive"
+	Size     int    // maximum tokens per chunk
+	Overlap  int    // tokens shared between consecutive chunks
+	// ParentSize is the maximum tokens of the parent sections that chunks are
+	// grouped under for small-to-big retrieval; 0 disables parent sections
+	ParentSize int
+}
+
+// QueryConfig holds the default query settings, used when a request does not specify them
+type QueryConfig struct {
+	Limit          int     // number of results per page
+	MaxLimit       int     // largest limit a request may ask for
+	MaxDistance    float64 // cosine distance cutoff for matching chunks
+	MinScore       float64 // minimum fused score of a result, from 0 to 1
+	VectorWeight   float64 // weight of the vector ranking in reciprocal rank fusion
+	KeywordWeight  float64 // weight of the full-text ranking in reciprocal rank fusion
+	RRFK           int     // reciprocal rank fusion constant, higher values flatten the rank curve
+	MMRLambda      float64 // trade-off between relevance (1) and diversity (0) of maximal marginal relevance
+	MaxPerDocument int     // maximum number of results from one document, 0 for no limit
+	Expansion      string  // query expansion mode: "none", "multi_query" or "hyde"
+	Paraphrases    int     // number of paraphrases generated by multi_query expansion
+	ExpansionModel string  // chat completion model of query expansion, defaults to the answer model
+	// Graph-augmented retrieval: hops traversed from the linked nodes, the weight of
+	// the graph ranking in the fused score and the cosine distance cutoff for linking
+	// query embeddings to nodes
+	GraphHops         int
+	GraphWeight       float64
+	GraphNodeDistance float64
+}
+
+// RerankConfig holds the configuration of the optional reranking stage
+type RerankConfig struct {
+	Provider   string // "" (disabled), "http" or "llm"
+	URL        string // endpoint of the http reranker
+	APIKey     string // bearer token of the http reranker
+	Model      string
+	Format     string // request format of the http reranker: "cohere" (also Jina) or "tei"
+	Candidates int    // number of retrieved chunks passed to the reranker
+	TimeoutSec int
+}
+
+// AnswerConfig holds the settings of answer generation
+type AnswerConfig struct {
+	Model            string // chat completion model
+	MaxTokens        int    // maximum tokens of a generated answer
+	MaxContextTokens int    // maximum estimated tokens of the sources in the prompt
+}
+
+// ChatConfig holds the settings of chat sessions
+type ChatConfig struct {
+	HistoryTurns int    // number of earlier turns used to rewrite a follow-up question, 0 disables rewriting
+	RewriteModel string // chat completion model of query rewriting, defaults to the answer model
+}
+
+// ExtractionConfig holds the configuration of knowledge graph extraction
+type ExtractionConfig struct {
+	Provider      string   // "regex" (default) or "llm"
+	Model         string   // chat completion model of the llm extractor
+	EntityTypes   []string // entity types the llm extractor may return
+	RelationTypes []string // relation types the llm extractor may return
+	MinConfidence float64  // entities and relations below this confidence are dropped
+}
+
+// ResolutionConfig holds the configuration of entity resolution, which
+// proposes merging knowledge nodes that name the same entity
+type ResolutionConfig struct {
+	MaxDistance  float64  // nodes whose embeddings are closer than this cosine distance are proposed
+	SameType     bool     // only propose merging nodes of the same type
+	NameSuffixes []string // suffixes such as "inc" ignored when comparing normalized names
+}
+
 // loadEnvFile attempts to load .env file from multiple locations
 func loadEnvFile() {
 	// Try loading from current directory
@@ -82,11 +175,121 @@ func LoadConfig() (*Config, error) {
 		return nil, fmt.Errorf("MCP_ENDPOINT environment variable is required")
 	}
 
+	// Embedding configuration, defaults to OpenAI embeddings
+	embeddingConfig := loadEmbeddingConfig("openai")
+	if embeddingConfig.Provider != "openai" && embeddingConfig.Provider != "hash" {
+		return nil, fmt.Errorf("EMBEDDING_PROVIDER must be one of: openai, hash")
+	}
+	if embeddingConfig.Dimensions <= 0 {
+		return nil, fmt.Errorf("EMBEDDING_DIMENSIONS must be positive")
+	}
+
+	// Chunking configuration
+	chunkingConfig := loadChunkingConfig()
+	if chunkingConfig.Size <= 0 || chunkingConfig.Overlap < 0 || chunkingConfig.Overlap >= chunkingConfig.Size {
+		return nil, fmt.Errorf("CHUNK_SIZE must be positive and CHUNK_OVERLAP between 0 and CHUNK_SIZE")
+	}
+	if chunkingConfig.ParentSize < 0 {
+		return nil, fmt.Errorf("CHUNK_PARENT_SIZE must not be negative")
+	}
+
+	// Query configuration
+	queryConfig := loadQueryConfig()
+	if queryConfig.Limit <= 0 || queryConfig.MaxLimit < queryConfig.Limit {
+		return nil, fmt.Errorf("QUERY_LIMIT must be positive and not above QUERY_MAX_LIMIT")
+	}
+	if queryConfig.VectorWeight < 0 || queryConfig.KeywordWeight < 0 || queryConfig.VectorWeight+queryConfig.KeywordWeight == 0 {
+		return nil, fmt.Errorf("QUERY_VECTOR_WEIGHT and QUERY_KEYWORD_WEIGHT must not be negative or both zero")
+	}
+	if queryConfig.MinScore < 0 || queryConfig.MinScore > 1 {
+		return nil, fmt.Errorf("QUERY_MIN_SCORE must be between 0 and 1")
+	}
+	if queryConfig.RRFK <= 0 {
+		return nil, fmt.Errorf("QUERY_RRF_K must be positive")
+	}
+	if queryConfig.MMRLambda < 0 || queryConfig.MMRLambda > 1 {
+		return nil, fmt.Errorf("QUERY_MMR_LAMBDA must be between 0 and 1")
+	}
+	if queryConfig.MaxPerDocument < 0 {
+		return nil, fmt.Errorf("QUERY_MAX_PER_DOCUMENT must not be negative")
+	}
+	if queryConfig.Expansion != "none" && queryConfig.Expansion != "multi_query" && queryConfig.Expansion != "hyde" {
+		return nil, fmt.Errorf("QUERY_EXPANSION must be one of: none, multi_query, hyde")
+	}
+	if queryConfig.Paraphrases < 1 || queryConfig.Paraphrases > 10 {
+		return nil, fmt.Errorf("QUERY_PARAPHRASES must be between 1 and 10")
+	}
+	if queryConfig.GraphHops < 1 || queryConfig.GraphHops > 2 {
+		return nil, fmt.Errorf("QUERY_GRAPH_HOPS must be 1 or 2")
+	}
+	if queryConfig.GraphWeight < 0 {
+		return nil, fmt.Errorf("QUERY_GRAPH_WEIGHT must not be negative")
+	}
+	if queryConfig.GraphNodeDistance < 0 || queryConfig.GraphNodeDistance > 2 {
+		return nil, fmt.Errorf("QUERY_GRAPH_NODE_DISTANCE must be between 0 and 2")
+	}
+
+	// Reranking configuration
+	rerankConfig := loadRerankConfig()
+	switch rerankConfig.Provider {
+	case "", "llm":
+	case "http":
+		if rerankConfig.URL == "" {
+			return nil, fmt.Errorf("RERANK_URL is required when RERANK_PROVIDER is http")
+		}
+		if rerankConfig.Format != "cohere" && rerankConfig.Format != "tei" {
+			return nil, fmt.Errorf("RERANK_FORMAT must be one of: cohere, tei")
+		}
+	default:
+		return nil, fmt.Errorf("RERANK_PROVIDER must be one of: http, llm")
+	}
+	if rerankConfig.Candidates <= 0 {
+		return nil, fmt.Errorf("RERANK_CANDIDATES must be positive")
+	}
+
+	// Answer generation configuration
+	answerConfig := loadAnswerConfig()
+	if answerConfig.MaxTokens <= 0 || answerConfig.MaxContextTokens <= 0 {
+		return nil, fmt.Errorf("ANSWER_MAX_TOKENS and ANSWER_MAX_CONTEXT_TOKENS must be positive")
+	}
+
+	// Chat session configuration
+	chatConfig := loadChatConfig()
+	if chatConfig.HistoryTurns < 0 {
+		return nil, fmt.Errorf("CHAT_HISTORY_TURNS must not be negative")
+	}
+
+	// Knowledge graph extraction configuration
+	extractionConfig := loadExtractionConfig()
+	if extractionConfig.Provider != "regex" && extractionConfig.Provider != "llm" {
+		return nil, fmt.Errorf("EXTRACTION_PROVIDER must be one of: regex, llm")
+	}
+	if len(extractionConfig.EntityTypes) == 0 || len(extractionConfig.RelationTypes) == 0 {
+		return nil, fmt.Errorf("EXTRACTION_ENTITY_TYPES and EXTRACTION_RELATION_TYPES must not be empty")
+	}
+	if extractionConfig.MinConfidence < 0 || extractionConfig.MinConfidence > 1 {
+		return nil, fmt.Errorf("EXTRACTION_MIN_CONFIDENCE must be between 0 and 1")
+	}
+
+	// Entity resolution configuration
+	resolutionConfig := loadResolutionConfig()
+	if resolutionConfig.MaxDistance < 0 || resolutionConfig.MaxDistance > 2 {
+		return nil, fmt.Errorf("RESOLUTION_MAX_DISTANCE must be between 0 and 2")
+	}
+
 	return &Config{
 		DBConfig:      dbConfig,
 		OpenAIKey:     openAIKey,
 		OpenAIBaseURL: openAIBaseURL,
 		MCPEndpoint:   mcpEndpoint,
+		Embedding:     embeddingConfig,
+		Chunking:      chunkingConfig,
+		Query:         queryConfig,
+		Rerank:        rerankConfig,
+		Answer:        answerConfig,
+		Chat:          chatConfig,
+		Extraction:    extractionConfig,
+		Resolution:    resolutionConfig,
 	}, nil
 }
 
@@ -119,11 +322,122 @@ func LoadTestConfig() *Config {
 		mcpEndpoint = "http://localhost:8080" // Fallback for testing
 	}
 
+	// Embedding configuration, defaults to the offline hash embedder for testing
+	embeddingConfig := loadEmbeddingConfig("hash")
+
 	return &Config{
 		DBConfig:      dbConfig,
 		OpenAIKey:     openAIKey,
 		OpenAIBaseURL: openAIBaseURL,
 		MCPEndpoint:   mcpEndpoint,
+		Embedding:     embeddingConfig,
+		Chunking:      loadChunkingConfig(),
+		Query:         loadQueryConfig(),
+		Rerank:        loadRerankConfig(),
+		Answer:        loadAnswerConfig(),
+		Chat:          loadChatConfig(),
+		Extraction:    loadExtractionConfig(),
+		Resolution:    loadResolutionConfig(),
+	}
+}
+
+// loadEmbeddingConfig loads embedding configuration with the given default provider
+func loadEmbeddingConfig(defaultProvider string) EmbeddingConfig {
+	return EmbeddingConfig{
+		Provider:       getEnvOrDefault("EMBEDDING_PROVIDER", defaultProvider),
+		Model:          getEnvOrDefault("EMBEDDING_MODEL", "text-embedding-3-small"),
+		Dimensions:     getEnvAsIntOrDefault("EMBEDDING_DIMENSIONS", 1536),
+		BatchSize:      getEnvAsIntOrDefault("EMBEDDING_BATCH_SIZE", 64),
+		MaxBatchTokens: getEnvAsIntOrDefault("EMBEDDING_MAX_BATCH_TOKENS", 32000),
+		CacheEnabled:   getEnvAsBoolOrDefault("EMBEDDING_CACHE_ENABLED", true),
+	}
+}
+
+// loadChunkingConfig loads the default chunking settings
+func loadChunkingConfig() ChunkingConfig {
+	return ChunkingConfig{
+		Strategy: getEnvOrDefault("CHUNK_STRATEGY", "markdown"),
+		Size:     getEnvAsIntOrDefault("CHUNK_SIZE", 250),
+		Overlap:  getEnvAsIntOrDefault("CHUNK_OVERLAP", 25),
+
+		ParentSize: getEnvAsIntOrDefault("CHUNK_PARENT_SIZE", 1000),
+	}
+}
+
+// loadQueryConfig loads the default query settings
+func loadQueryConfig() QueryConfig {
+	return QueryConfig{
+		Limit:         getEnvAsIntOrDefault("QUERY_LIMIT", 5),
+		MaxLimit:      getEnvAsIntOrDefault("QUERY_MAX_LIMIT", 100),
+		MaxDistance:   getEnvAsFloatOrDefault("QUERY_MAX_DISTANCE", 0.5),
+		MinScore:      getEnvAsFloatOrDefault("QUERY_MIN_SCORE", 0),
+		VectorWeight:  getEnvAsFloatOrDefault("QUERY_VECTOR_WEIGHT", 0.3),
+		KeywordWeight: getEnvAsFloatOrDefault("QUERY_KEYWORD_WEIGHT", 0.7),
+		RRFK:          getEnvAsIntOrDefault("QUERY_RRF_K", 60),
+
+		MMRLambda:      getEnvAsFloatOrDefault("QUERY_MMR_LAMBDA", 0.5),
+		MaxPerDocument: getEnvAsIntOrDefault("QUERY_MAX_PER_DOCUMENT", 0),
+
+		Expansion:      getEnvOrDefault("QUERY_EXPANSION", "none"),
+		Paraphrases:    getEnvAsIntOrDefault("QUERY_PARAPHRASES", 3),
+		ExpansionModel: os.Getenv("QUERY_EXPANSION_MODEL"),
+
+		GraphHops:         getEnvAsIntOrDefault("QUERY_GRAPH_HOPS", 1),
+		GraphWeight:       getEnvAsFloatOrDefault("QUERY_GRAPH_WEIGHT", 0.5),
+		GraphNodeDistance: getEnvAsFloatOrDefault("QUERY_GRAPH_NODE_DISTANCE", 0.3),
+	}
+}
+
+// loadRerankConfig loads the reranking configuration
+func loadRerankConfig() RerankConfig {
+	return RerankConfig{
+		Provider:   os.Getenv("RERANK_PROVIDER"),
+		URL:        os.Getenv("RERANK_URL"),
+		APIKey:     os.Getenv("RERANK_API_KEY"),
+		Model:      os.Getenv("RERANK_MODEL"),
+		Format:     getEnvOrDefault("RERANK_FORMAT", "cohere"),
+		Candidates: getEnvAsIntOrDefault("RERANK_CANDIDATES", 20),
+		TimeoutSec: getEnvAsIntOrDefault("RERANK_TIMEOUT_SECONDS", 30),
+	}
+}
+
+// loadAnswerConfig loads the answer generation configuration
+func loadAnswerConfig() AnswerConfig {
+	return AnswerConfig{
+		Model:            getEnvOrDefault("ANSWER_MODEL", "gpt-4o-mini"),
+		MaxTokens:        getEnvAsIntOrDefault("ANSWER_MAX_TOKENS", 1024),
+		MaxContextTokens: getEnvAsIntOrDefault("ANSWER_MAX_CONTEXT_TOKENS", 6000),
+	}
+}
+
+// loadChatConfig loads the chat session configuration
+func loadChatConfig() ChatConfig {
+	return ChatConfig{
+		HistoryTurns: getEnvAsIntOrDefault("CHAT_HISTORY_TURNS", 5),
+		RewriteModel: os.Getenv("CHAT_REWRITE_MODEL"),
+	}
+}
+
+// loadExtractionConfig loads the knowledge graph extraction configuration
+func loadExtractionConfig() ExtractionConfig {
+	return ExtractionConfig{
+		Provider: getEnvOrDefault("EXTRACTION_PROVIDER", "regex"),
+		Model:    getEnvOrDefault("EXTRACTION_MODEL", "gpt-4o-mini"),
+		EntityTypes: getEnvAsListOrDefault("EXTRACTION_ENTITY_TYPES",
+			[]string{"person", "organization", "location", "product", "technology", "event", "concept"}),
+		RelationTypes: getEnvAsListOrDefault("EXTRACTION_RELATION_TYPES",
+			[]string{"is_a", "part_of", "works_at", "located_in", "created_by", "uses", "depends_on", "related_to"}),
+		MinConfidence: getEnvAsFloatOrDefault("EXTRACTION_MIN_CONFIDENCE", 0),
+	}
+}
+
+// loadResolutionConfig loads the entity resolution configuration
+func loadResolutionConfig() ResolutionConfig {
+	return ResolutionConfig{
+		MaxDistance: getEnvAsFloatOrDefault("RESOLUTION_MAX_DISTANCE", 0.1),
+		SameType:    getEnvAsBoolOrDefault("RESOLUTION_SAME_TYPE", true),
+		NameSuffixes: getEnvAsListOrDefault("RESOLUTION_NAME_SUFFIXES",
+			[]string{"inc", "incorporated", "corp", "corporation", "co", "company", "ltd", "limited", "llc", "plc", "gmbh", "ag", "sa"}),
 	}
 }
 
@@ -145,3 +459,37 @@ func getEnvAsIntOrDefault(key string, defaultValue int) int {
 	}
 	return defaultValue
 }
+
+func getEnvAsBoolOrDefault(key string, defaultValue bool) bool {
+	if value := os.Getenv(key); value != "" {
+		if result, err := strconv.ParseBool(value); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
+
+func getEnvAsFloatOrDefault(key string, defaultValue float64) float64 {
+	if value := os.Getenv(key); value != "" {
+		if result, err := strconv.ParseFloat(value, 64); err == nil {
+			return result
+		}
+	}
+	return defaultValue
+}
+
+// getEnvAsListOrDefault returns the comma-separated values of an environment
+// variable, trimmed and without empty values
+func getEnvAsListOrDefault(key string, defaultValue []string) []string {
+	value := os.Getenv(key)
+	if value == "" {
+		return defaultValue
+	}
+	var result []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -2,9 +2,12 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 
 	"rag-data-service/models"
 	"rag-data-service/service"
@@ -35,8 +38,22 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 
 		// Query endpoints
 		r.Post("/query", h.handleQuery)
+		r.Post("/answer", h.handleAnswer)
+		r.Post("/answer/stream", h.handleAnswerStream)
 		r.Get("/graph", h.handleGetGraph)
 
+		// Graph traversal endpoints
+		r.Get("/graph/nodes/{id}/neighbors", h.handleGetNodeNeighbors)
+		r.Get("/graph/nodes/{id}/subgraph", h.handleGetSubgraph)
+		r.Get("/graph/path", h.handleFindPath)
+		r.Get("/graph/export", h.handleExportGraph)
+
+		// Chat session endpoints
+		r.Post("/sessions", h.handleCreateChatSession)
+		r.Get("/sessions/{id}", h.handleGetChatSession)
+		r.Delete("/sessions/{id}", h.handleDeleteChatSession)
+		r.Post("/sessions/{id}/messages", h.handleChat)
+
 		// URL queue endpoints
 		r.Get("/queue", h.handleGetQueue)
 		r.Delete("/queue/{id}", h.handleDeleteURL)
@@ -50,6 +67,22 @@ func (h *Handler) RegisterRoutes(r chi.Router) {
 
 		// MCP logs endpoint
 		r.Get("/mcp-logs", h.handleGetMCPLogs)
+
+		// Admin endpoints
+		r.Get("/admin/embedding-cache", h.handleGetEmbeddingCacheStats)
+		r.Delete("/admin/embedding-cache", h.handlePurgeEmbeddingCache)
+		r.Post("/admin/embedding-migration", h.handleStartEmbeddingMigration)
+		r.Get("/admin/embedding-migration", h.handleGetEmbeddingMigration)
+		r.Delete("/admin/embedding-migration", h.handleCancelEmbeddingMigration)
+
+		// Entity resolution endpoints
+		r.Post("/admin/entity-resolution", h.handleResolveEntities)
+		r.Get("/admin/entity-merges", h.handleListMergeProposals)
+		r.Post("/admin/entity-merges/{id}/accept", h.handleAcceptMergeProposal)
+		r.Post("/admin/entity-merges/{id}/reject", h.handleRejectMergeProposal)
+		r.Get("/admin/nodes/{id}", h.handleGetKnowledgeNode)
+		r.Post("/admin/nodes/merge", h.handleMergeNodes)
+		r.Post("/admin/nodes/{id}/split", h.handleSplitNode)
 	})
 }
 
@@ -67,7 +100,7 @@ func (h *Handler) handleProcessDocument(w http.ResponseWriter, r *http.Request)
 
 	// If only URL is provided, queue it for background processing
 	if req.Content == "" {
-		if err := h.ragService.QueueURL(r.Context(), req.URL); err != nil {
+		if err := h.ragService.QueueURL(r.Context(), req.URL, req.Metadata); err != nil {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
@@ -92,9 +125,7 @@ func (h *Handler) handleProcessDocument(w http.ResponseWriter, r *http.Request)
 }
 
 func (h *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
-	var req struct {
-		Query string `json:"query"`
-	}
+	var req models.QueryRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
@@ -104,8 +135,36 @@ func (h *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Query is required", http.StatusBadRequest)
 		return
 	}
+	resp, err := h.ragService.QueryWithOptions(r.Context(), &req)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
 
-	resp, err := h.ragService.Query(r.Context(), req.Query)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func (h *Handler) handleAnswer(w http.ResponseWriter, r *http.Request) {
+	var req models.AnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+	resp, err := h.ragService.Answer(r.Context(), &req)
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
@@ -115,6 +174,183 @@ func (h *Handler) handleQuery(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 
+// handleAnswerStream streams an answer as Server-Sent Events: a "sources"
+// event with the numbered sources, "delta" events with pieces of the answer
+// text and a final "citations" event with the complete answer. Failures after
+// the stream has started are reported as an "error" event. A client that
+// disconnects cancels the request context and with it the generation.
+func (h *Handler) handleAnswerStream(w http.ResponseWriter, r *http.Request) {
+	var req models.AnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming is not supported", http.StatusInternalServerError)
+		return
+	}
+
+	// The response starts with the first event, so that errors during
+	// retrieval can still be reported with a status code
+	started := false
+	send := func(event string, data interface{}) error {
+		if !started {
+			w.Header().Set("Content-Type", "text/event-stream")
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("Connection", "keep-alive")
+			w.WriteHeader(http.StatusOK)
+			started = true
+		}
+		if err := writeSSE(w, event, data); err != nil {
+			return err
+		}
+		flusher.Flush()
+		return nil
+	}
+
+	resp, err := h.ragService.StreamAnswer(r.Context(), &req, service.AnswerStreamHandler{
+		Sources: func(sources []models.Citation) error {
+			return send("sources", map[string]interface{}{"sources": sources})
+		},
+		Delta: func(content string) error {
+			return send("delta", map[string]string{"content": content})
+		},
+	})
+	if err != nil {
+		if r.Context().Err() != nil {
+			// The client is gone
+			return
+		}
+		if !started {
+			status := http.StatusInternalServerError
+			if errors.Is(err, service.ErrInvalidQuery) {
+				status = http.StatusBadRequest
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		send("error", map[string]string{"error": err.Error()})
+		return
+	}
+
+	send("citations", resp)
+}
+
+// writeSSE writes a Server-Sent Event with JSON data
+func writeSSE(w http.ResponseWriter, event string, data interface{}) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(w, "event: %s\ndata: %s\n\n", event, payload)
+	return err
+}
+
+func (h *Handler) handleCreateChatSession(w http.ResponseWriter, r *http.Request) {
+	var req models.CreateChatSessionRequest
+	// The body is optional; a session may be created without a title
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	session, err := h.ragService.CreateChatSession(r.Context(), req.Title)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *Handler) handleGetChatSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	session, err := h.ragService.GetChatSession(r.Context(), id)
+	if errors.Is(err, service.ErrChatSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(session)
+}
+
+func (h *Handler) handleDeleteChatSession(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	err = h.ragService.DeleteChatSession(r.Context(), id)
+	if errors.Is(err, service.ErrChatSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleChat answers the next question of a chat session and returns the stored turn
+func (h *Handler) handleChat(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.AnswerRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Query == "" {
+		http.Error(w, "Query is required", http.StatusBadRequest)
+		return
+	}
+	turn, err := h.ragService.Chat(r.Context(), id, &req)
+	if errors.Is(err, service.ErrChatSessionNotFound) {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, service.ErrInvalidQuery) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(turn)
+}
+
 func (h *Handler) handleGetGraph(w http.ResponseWriter, r *http.Request) {
 	query := r.URL.Query().Get("query")
 
@@ -291,3 +527,396 @@ func (h *Handler) handleGetMCPLogs(w http.ResponseWriter, r *http.Request) {
 		"logs": logs,
 	})
 }
+
+func (h *Handler) handleGetEmbeddingCacheStats(w http.ResponseWriter, r *http.Request) {
+	stats, err := h.ragService.GetEmbeddingCacheStats(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(stats)
+}
+
+func (h *Handler) handlePurgeEmbeddingCache(w http.ResponseWriter, r *http.Request) {
+	// An optional model parameter limits the purge to a single embedding model
+	model := r.URL.Query().Get("model")
+
+	deleted, err := h.ragService.PurgeEmbeddingCache(r.Context(), model)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"deleted": deleted,
+	})
+}
+
+func (h *Handler) handleStartEmbeddingMigration(w http.ResponseWriter, r *http.Request) {
+	var req models.StartEmbeddingMigrationRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Model == "" || req.Dimensions <= 0 {
+		http.Error(w, "Model and dimensions are required", http.StatusBadRequest)
+		return
+	}
+
+	migration, err := h.ragService.StartEmbeddingMigration(r.Context(), &req)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrMigrationRunning):
+			http.Error(w, err.Error(), http.StatusConflict)
+		case errors.Is(err, service.ErrInvalidMigration):
+			http.Error(w, err.Error(), http.StatusBadRequest)
+		default:
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusAccepted)
+	json.NewEncoder(w).Encode(migration)
+}
+
+func (h *Handler) handleGetEmbeddingMigration(w http.ResponseWriter, r *http.Request) {
+	migration, err := h.ragService.GetEmbeddingMigration(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	if migration == nil {
+		http.Error(w, "No embedding migration found", http.StatusNotFound)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(migration)
+}
+
+func (h *Handler) handleCancelEmbeddingMigration(w http.ResponseWriter, r *http.Request) {
+	if err := h.ragService.CancelEmbeddingMigration(r.Context()); err != nil {
+		http.Error(w, err.Error(), http.StatusConflict)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// writeResolutionError reports an entity resolution error with its status code
+func writeResolutionError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrNodeNotFound), errors.Is(err, service.ErrMergeProposalNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidResolution):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func (h *Handler) handleResolveEntities(w http.ResponseWriter, r *http.Request) {
+	result, err := h.ragService.ResolveEntities(r.Context())
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func (h *Handler) handleListMergeProposals(w http.ResponseWriter, r *http.Request) {
+	proposals, err := h.ragService.ListMergeProposals(r.Context(), r.URL.Query().Get("status"))
+	if err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"proposals": proposals,
+	})
+}
+
+func (h *Handler) handleAcceptMergeProposal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.ragService.AcceptMergeProposal(r.Context(), id)
+	if err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(node)
+}
+
+func (h *Handler) handleRejectMergeProposal(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	if err := h.ragService.RejectMergeProposal(r.Context(), id); err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (h *Handler) handleGetKnowledgeNode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.ragService.GetKnowledgeNode(r.Context(), id)
+	if err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(node)
+}
+
+func (h *Handler) handleMergeNodes(w http.ResponseWriter, r *http.Request) {
+	var req models.MergeNodesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.TargetID == 0 || len(req.SourceIDs) == 0 {
+		http.Error(w, "Target ID and source IDs are required", http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.ragService.MergeNodes(r.Context(), req.TargetID, req.SourceIDs)
+	if err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(node)
+}
+
+func (h *Handler) handleSplitNode(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	var req models.SplitNodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Name == "" {
+		http.Error(w, "Name is required", http.StatusBadRequest)
+		return
+	}
+
+	node, err := h.ragService.SplitNode(r.Context(), id, &req)
+	if err != nil {
+		writeResolutionError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(node)
+}
+
+func writeGraphError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, service.ErrNodeNotFound):
+		http.Error(w, err.Error(), http.StatusNotFound)
+	case errors.Is(err, service.ErrInvalidGraphQuery):
+		http.Error(w, err.Error(), http.StatusBadRequest)
+	default:
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+	}
+}
+
+// queryInt parses an optional integer query parameter, which is 0 when absent
+func queryInt(r *http.Request, name string) (int, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	return strconv.Atoi(value)
+}
+
+// queryList returns the values of a query parameter that may be repeated or
+// comma separated
+func queryList(r *http.Request, name string) []string {
+	var values []string
+	for _, value := range r.URL.Query()[name] {
+		values = append(values, strings.Split(value, ",")...)
+	}
+	return values
+}
+
+func (h *Handler) handleGetNodeNeighbors(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	limit, err := queryInt(r, "limit")
+	if err != nil {
+		http.Error(w, "Invalid limit", http.StatusBadRequest)
+		return
+	}
+
+	neighbors, err := h.ragService.GetNodeNeighbors(r.Context(), &models.NeighborsRequest{
+		NodeID:            id,
+		Direction:         r.URL.Query().Get("direction"),
+		RelationshipTypes: queryList(r, "relationship_type"),
+		NodeTypes:         queryList(r, "node_type"),
+		Limit:             limit,
+	})
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(neighbors)
+}
+
+func (h *Handler) handleGetSubgraph(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(chi.URLParam(r, "id"))
+	if err != nil {
+		http.Error(w, "Invalid ID format", http.StatusBadRequest)
+		return
+	}
+
+	hops, err := queryInt(r, "hops")
+	if err != nil {
+		http.Error(w, "Invalid hops", http.StatusBadRequest)
+		return
+	}
+	maxNodes, err := queryInt(r, "max_nodes")
+	if err != nil {
+		http.Error(w, "Invalid max_nodes", http.StatusBadRequest)
+		return
+	}
+
+	subgraph, err := h.ragService.GetSubgraph(r.Context(), &models.SubgraphRequest{
+		NodeID:            id,
+		Hops:              hops,
+		Direction:         r.URL.Query().Get("direction"),
+		RelationshipTypes: queryList(r, "relationship_type"),
+		MaxNodes:          maxNodes,
+	})
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(subgraph)
+}
+
+func (h *Handler) handleFindPath(w http.ResponseWriter, r *http.Request) {
+	from, err := strconv.Atoi(r.URL.Query().Get("from"))
+	if err != nil {
+		http.Error(w, "Invalid from ID", http.StatusBadRequest)
+		return
+	}
+	to, err := strconv.Atoi(r.URL.Query().Get("to"))
+	if err != nil {
+		http.Error(w, "Invalid to ID", http.StatusBadRequest)
+		return
+	}
+	maxHops, err := queryInt(r, "max_hops")
+	if err != nil {
+		http.Error(w, "Invalid max_hops", http.StatusBadRequest)
+		return
+	}
+
+	path, err := h.ragService.FindPath(r.Context(), &models.PathRequest{
+		SourceID:          from,
+		TargetID:          to,
+		MaxHops:           maxHops,
+		Direction:         r.URL.Query().Get("direction"),
+		RelationshipTypes: queryList(r, "relationship_type"),
+	})
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(path)
+}
+
+// exportWriter starts the response of a graph export with its first write,
+// so that errors before the export begins can still be reported with a status code
+type exportWriter struct {
+	w       http.ResponseWriter
+	format  *service.ExportFormat
+	started bool
+}
+
+func (ew *exportWriter) Write(p []byte) (int, error) {
+	if !ew.started {
+		ew.w.Header().Set("Content-Type", ew.format.ContentType)
+		ew.w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="knowledge-graph.%s"`, ew.format.Extension))
+		ew.w.WriteHeader(http.StatusOK)
+		ew.started = true
+	}
+	return ew.w.Write(p)
+}
+
+func (h *Handler) handleExportGraph(w http.ResponseWriter, r *http.Request) {
+	req := &models.GraphExportRequest{
+		Format: r.URL.Query().Get("format"),
+		Query:  r.URL.Query().Get("query"),
+	}
+	if value := r.URL.Query().Get("document_id"); value != "" {
+		documentID, err := strconv.Atoi(value)
+		if err != nil {
+			http.Error(w, "Invalid document ID", http.StatusBadRequest)
+			return
+		}
+		req.DocumentID = &documentID
+	}
+
+	format, err := service.LookupExportFormat(req.Format)
+	if err != nil {
+		writeGraphError(w, err)
+		return
+	}
+
+	ew := &exportWriter{w: w, format: format}
+	if err := h.ragService.ExportKnowledgeGraph(r.Context(), req, ew); err != nil {
+		if ew.started {
+			// The export is cut short, which the client sees as a truncated file
+			log.Printf("Error exporting knowledge graph: %v", err)
+			return
+		}
+		writeGraphError(w, err)
+	}
+}
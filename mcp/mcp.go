@@ -14,12 +14,19 @@ import (
 // This allows for mocking in tests.
 type RAGServicer interface {
 	LogMCPRequest(ctx context.Context, logEntry *models.MCPLog) error
-	QueueURL(ctx context.Context, url string) error
+	QueueURL(ctx context.Context, url string, metadata map[string]any) error
 	GetURLQueue(ctx context.Context) ([]models.URLQueueItem, error)
 	GetKnowledgeGraph(ctx context.Context, query string) ([]models.KnowledgeNodeResponse, []models.KnowledgeEdgeResponse, error)
 	GetKnowledgeGraphByDocument(ctx context.Context, documentID int) ([]models.KnowledgeNodeResponse, []models.KnowledgeEdgeResponse, error)
-	Query(ctx context.Context, query string) (*models.QueryResponse, error)
+	QueryWithOptions(ctx context.Context, req *models.QueryRequest) (*models.QueryResponse, error)
 	ProcessDocument(ctx context.Context, req *models.ProcessDocumentRequest) error
+	Answer(ctx context.Context, req *models.AnswerRequest) (*models.AnswerResponse, error)
+	CreateChatSession(ctx context.Context, title string) (*models.ChatSession, error)
+	Chat(ctx context.Context, sessionID int, req *models.AnswerRequest) (*models.ChatTurn, error)
+	FindKnowledgeNode(ctx context.Context, name string) (*models.KnowledgeNodeResponse, error)
+	GetNodeNeighbors(ctx context.Context, req *models.NeighborsRequest) (*models.NeighborsResponse, error)
+	GetSubgraph(ctx context.Context, req *models.SubgraphRequest) (*models.SubgraphResponse, error)
+	FindPath(ctx context.Context, req *models.PathRequest) (*models.PathResponse, error)
 }
 
 // MCPRequest represents a request from the MCP client
@@ -150,6 +157,23 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, req *MCPRequest, log
 						"type":        "string",
 						"description": "Content of the document (optional if URL is provided)",
 					},
+					"chunk_strategy": map[string]interface{}{
+						"type":        "string",
+						"enum":        []string{"markdown", "sentence", "token_window", "recursive"},
+						"description": "Optional chunking strategy, defaults to the server configuration",
+					},
+					"chunk_size": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional maximum number of tokens per chunk",
+					},
+					"chunk_overlap": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional number of tokens shared between consecutive chunks",
+					},
+					"metadata": map[string]interface{}{
+						"type":        "object",
+						"description": "Optional metadata stored on the document and its chunks, usable as query filters",
+					},
 				},
 				"required": []string{"url"},
 			},
@@ -158,14 +182,27 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, req *MCPRequest, log
 			"name":        "query_knowledge_base",
 			"description": "Query the knowledge base for relevant information",
 			"inputSchema": map[string]interface{}{
-				"type": "object",
-				"properties": map[string]interface{}{
-					"query": map[string]interface{}{
-						"type":        "string",
-						"description": "The query to search for in the knowledge base",
-					},
-				},
-				"required": []string{"query"},
+				"type":       "object",
+				"properties": queryToolProperties(),
+				"required":   []string{"query"},
+			},
+		},
+		{
+			"name":        "answer_question",
+			"description": "Answer a question from the knowledge base, citing the sources used by number",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": answerToolProperties(),
+				"required":   []string{"query"},
+			},
+		},
+		{
+			"name":        "chat",
+			"description": "Ask the next question of a conversation. Follow-up questions are rewritten into standalone questions using the earlier turns of the session before retrieval",
+			"inputSchema": map[string]interface{}{
+				"type":       "object",
+				"properties": chatToolProperties(),
+				"required":   []string{"query"},
 			},
 		},
 		{
@@ -181,6 +218,86 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, req *MCPRequest, log
 				},
 			},
 		},
+		{
+			"name":        "get_node_neighbors",
+			"description": "Get the entities linked to an entity of the knowledge graph by a single relationship",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": graphToolProperties(map[string]interface{}{
+					"node_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID of the entity",
+					},
+					"node": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or alias of the entity, used when node_id is not given",
+					},
+					"node_types": map[string]interface{}{
+						"type":        "array",
+						"items":       map[string]interface{}{"type": "string"},
+						"description": "Optional entity types the neighbors must have",
+					},
+					"limit": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional maximum number of neighbors (default 50)",
+					},
+				}),
+			},
+		},
+		{
+			"name":        "get_subgraph",
+			"description": "Get the entities within a number of hops of an entity of the knowledge graph and the relationships between them",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": graphToolProperties(map[string]interface{}{
+					"node_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID of the seed entity",
+					},
+					"node": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or alias of the seed entity, used when node_id is not given",
+					},
+					"hops": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional number of hops from the seed (default 2, at most 4)",
+					},
+					"max_nodes": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional maximum number of entities, closest first (default 100)",
+					},
+				}),
+			},
+		},
+		{
+			"name":        "find_path",
+			"description": "Find a shortest chain of relationships between two entities of the knowledge graph",
+			"inputSchema": map[string]interface{}{
+				"type": "object",
+				"properties": graphToolProperties(map[string]interface{}{
+					"source_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID of the entity the path starts from",
+					},
+					"source": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or alias of the entity the path starts from, used when source_id is not given",
+					},
+					"target_id": map[string]interface{}{
+						"type":        "integer",
+						"description": "ID of the entity the path leads to",
+					},
+					"target": map[string]interface{}{
+						"type":        "string",
+						"description": "Name or alias of the entity the path leads to, used when target_id is not given",
+					},
+					"max_hops": map[string]interface{}{
+						"type":        "integer",
+						"description": "Optional maximum length of the path (default 4, at most 6)",
+					},
+				}),
+			},
+		},
 		{
 			"name":        "queue_url",
 			"description": "Add a URL to the processing queue for background processing",
@@ -191,6 +308,10 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, req *MCPRequest, log
 						"type":        "string",
 						"description": "URL to add to the processing queue",
 					},
+					"metadata": map[string]interface{}{
+						"type":        "object",
+						"description": "Optional metadata stored on the document once the URL is processed",
+					},
 				},
 				"required": []string{"url"},
 			},
@@ -216,6 +337,148 @@ func (h *MCPHandler) handleToolsList(w http.ResponseWriter, req *MCPRequest, log
 	h.sendResponse(w, response, logEntry)
 }
 
+// queryToolProperties returns the input schema properties of query_knowledge_base
+func queryToolProperties() map[string]interface{} {
+	return map[string]interface{}{
+		"query": map[string]interface{}{
+			"type":        "string",
+			"description": "The query to search for in the knowledge base",
+		},
+		"return_parents": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Match on small chunks but return the text of their parent sections",
+		},
+		"context_window": map[string]interface{}{
+			"type":        "integer",
+			"description": "Number of neighboring chunks to include on each side of every result (0-10)",
+		},
+		"limit": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional number of results to return, defaults to the server configuration",
+		},
+		"offset": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional number of results to skip",
+		},
+		"cursor": map[string]interface{}{
+			"type":        "string",
+			"description": "Optional next_cursor from a previous response to fetch the next page",
+		},
+		"min_score": map[string]interface{}{
+			"type":        "number",
+			"description": "Optional minimum fused score of a result, from 0 (any) to 1 (ranked first by both vector and full-text search)",
+		},
+		"max_distance": map[string]interface{}{
+			"type":        "number",
+			"description": "Optional cosine distance cutoff for matching chunks",
+		},
+		"vector_weight": map[string]interface{}{
+			"type":        "number",
+			"description": "Optional weight of the vector ranking in the fused score",
+		},
+		"keyword_weight": map[string]interface{}{
+			"type":        "number",
+			"description": "Optional weight of the full-text ranking in the fused score",
+		},
+		"rerank": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Set to false to skip the configured reranker",
+		},
+		"rerank_candidates": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional number of retrieved chunks passed to the reranker",
+		},
+		"mmr": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Diversify results by maximal marginal relevance over chunk embeddings",
+		},
+		"mmr_lambda": map[string]interface{}{
+			"type":        "number",
+			"description": "Optional trade-off between relevance (1) and diversity (0) for mmr",
+		},
+		"max_per_document": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional maximum number of results from one document, 0 for no limit",
+		},
+		"expansion": map[string]interface{}{
+			"type":        "string",
+			"enum":        []string{"none", "multi_query", "hyde"},
+			"description": "Optional query expansion: multi_query also searches paraphrases of the query and fuses the results, hyde searches with the embedding of a hypothetical answer",
+		},
+		"paraphrases": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional number of paraphrases for multi_query expansion (1-10)",
+		},
+		"graph": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Also rank chunks of documents reached through the knowledge graph from the entities named in the query, and return the traversed subgraph",
+		},
+		"graph_hops": map[string]interface{}{
+			"type":        "integer",
+			"description": "Optional number of edges walked from the linked entities for graph (1 or 2)",
+		},
+		"explain": map[string]interface{}{
+			"type":        "boolean",
+			"description": "Add how each result was ranked (vector distance, lexical score, fusion rank, rerank score, matched keywords) and per-stage timings",
+		},
+		"filters": map[string]interface{}{
+			"type":        "object",
+			"description": "Optional filters restricting the searched chunks",
+			"properties": map[string]interface{}{
+				"document_ids": map[string]interface{}{
+					"type":  "array",
+					"items": map[string]interface{}{"type": "integer"},
+				},
+				"url_prefix": map[string]interface{}{"type": "string"},
+				"domain": map[string]interface{}{
+					"type":        "string",
+					"description": "Host name of the document URL, subdomains included",
+				},
+				"title": map[string]interface{}{
+					"type":        "string",
+					"description": "Case-insensitive substring of the document title",
+				},
+				"created_after":  map[string]interface{}{"type": "string", "format": "date-time"},
+				"created_before": map[string]interface{}{"type": "string", "format": "date-time"},
+				"updated_after":  map[string]interface{}{"type": "string", "format": "date-time"},
+				"updated_before": map[string]interface{}{"type": "string", "format": "date-time"},
+				"metadata": map[string]interface{}{
+					"type":        "object",
+					"description": "Key/values the chunk metadata must contain",
+				},
+			},
+		},
+	}
+}
+
+// answerToolProperties returns the input schema properties of answer_question,
+// the query options without paging plus the chat model
+func answerToolProperties() map[string]interface{} {
+	properties := queryToolProperties()
+	delete(properties, "offset")
+	delete(properties, "cursor")
+	properties["query"] = map[string]interface{}{
+		"type":        "string",
+		"description": "The question to answer",
+	}
+	properties["model"] = map[string]interface{}{
+		"type":        "string",
+		"description": "Optional chat completion model, defaults to the server configuration",
+	}
+	return properties
+}
+
+// chatToolProperties returns the input schema properties of chat, the
+// answer_question options plus the session ID
+func chatToolProperties() map[string]interface{} {
+	properties := answerToolProperties()
+	properties["session_id"] = map[string]interface{}{
+		"type":        "integer",
+		"description": "Chat session to continue; a new session is started when omitted and its ID is returned",
+	}
+	return properties
+}
+
 // handleToolsCall handles the tools/call request
 func (h *MCPHandler) handleToolsCall(w http.ResponseWriter, req *MCPRequest, logEntry *models.MCPLog) {
 	// Parse the call request
@@ -245,8 +508,18 @@ func (h *MCPHandler) handleToolsCall(w http.ResponseWriter, req *MCPRequest, log
 		responseResult, callErr = h.handleProcessDocument(callReq.Arguments)
 	case "query_knowledge_base":
 		responseResult, callErr = h.handleQueryKnowledgeBase(callReq.Arguments)
+	case "answer_question":
+		responseResult, callErr = h.handleAnswerQuestion(callReq.Arguments)
+	case "chat":
+		responseResult, callErr = h.handleChat(callReq.Arguments)
 	case "get_knowledge_graph":
 		responseResult, callErr = h.handleGetKnowledgeGraph(callReq.Arguments)
+	case "get_node_neighbors":
+		responseResult, callErr = h.handleGetNodeNeighbors(callReq.Arguments)
+	case "get_subgraph":
+		responseResult, callErr = h.handleGetSubgraph(callReq.Arguments)
+	case "find_path":
+		responseResult, callErr = h.handleFindPath(callReq.Arguments)
 	case "queue_url":
 		responseResult, callErr = h.handleQueueURL(callReq.Arguments)
 	case "get_queue_status":
@@ -285,10 +558,19 @@ func (h *MCPHandler) handleProcessDocument(args map[string]interface{}) (interfa
 		Title:   title,
 		Content: content,
 	}
+	req.ChunkStrategy, _ = args["chunk_strategy"].(string)
+	if chunkSize, ok := args["chunk_size"].(float64); ok {
+		req.ChunkSize = int(chunkSize)
+	}
+	if chunkOverlap, ok := args["chunk_overlap"].(float64); ok {
+		overlap := int(chunkOverlap)
+		req.ChunkOverlap = &overlap
+	}
+	req.Metadata, _ = args["metadata"].(map[string]interface{})
 
 	if content == "" {
 		// Queue for background processing
-		err := h.ragService.QueueURL(context.Background(), url)
+		err := h.ragService.QueueURL(context.Background(), url, req.Metadata)
 		if err != nil {
 			return nil, err
 		}
@@ -312,20 +594,143 @@ func (h *MCPHandler) handleProcessDocument(args map[string]interface{}) (interfa
 
 // handleQueryKnowledgeBase handles the query_knowledge_base tool call
 func (h *MCPHandler) handleQueryKnowledgeBase(args map[string]interface{}) (interface{}, error) {
-	query, ok := args["query"].(string)
-	if !ok {
-		return nil, fmt.Errorf("query is required and must be a string")
+	req, err := queryRequestFromArgs(args)
+	if err != nil {
+		return nil, err
 	}
 
-	resp, err := h.ragService.Query(context.Background(), query)
+	resp, err := h.ragService.QueryWithOptions(context.Background(), req)
 	if err != nil {
 		return nil, err
 	}
 
-	return map[string]interface{}{
-		"query":   query,
+	result := map[string]interface{}{
+		"query":   req.Query,
 		"results": resp.Results,
-	}, nil
+		"limit":   resp.Limit,
+		"offset":  resp.Offset,
+	}
+	if resp.NextCursor != "" {
+		result["next_offset"] = resp.NextOffset
+		result["next_cursor"] = resp.NextCursor
+	}
+	if resp.Reranker != "" {
+		result["reranker"] = resp.Reranker
+	}
+	if resp.Expansion != nil {
+		result["expansion"] = resp.Expansion
+	}
+	if resp.Explain != nil {
+		result["explain"] = resp.Explain
+	}
+	if resp.Graph != nil {
+		result["graph"] = resp.Graph
+	}
+	return result, nil
+}
+
+// handleAnswerQuestion handles the answer_question tool call
+func (h *MCPHandler) handleAnswerQuestion(args map[string]interface{}) (interface{}, error) {
+	req, err := queryRequestFromArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	answerReq := &models.AnswerRequest{QueryRequest: *req}
+	answerReq.Model, _ = args["model"].(string)
+
+	return h.ragService.Answer(context.Background(), answerReq)
+}
+
+// handleChat handles the chat tool call
+func (h *MCPHandler) handleChat(args map[string]interface{}) (interface{}, error) {
+	req, err := queryRequestFromArgs(args)
+	if err != nil {
+		return nil, err
+	}
+
+	answerReq := &models.AnswerRequest{QueryRequest: *req}
+	answerReq.Model, _ = args["model"].(string)
+
+	ctx := context.Background()
+	var sessionID int
+	if id, ok := args["session_id"].(float64); ok {
+		sessionID = int(id)
+	} else {
+		session, err := h.ragService.CreateChatSession(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		sessionID = session.ID
+	}
+
+	return h.ragService.Chat(ctx, sessionID, answerReq)
+}
+
+// queryRequestFromArgs parses the query options of a tool call
+func queryRequestFromArgs(args map[string]interface{}) (*models.QueryRequest, error) {
+	query, ok := args["query"].(string)
+	if !ok {
+		return nil, fmt.Errorf("query is required and must be a string")
+	}
+
+	req := &models.QueryRequest{Query: query}
+	req.ReturnParents, _ = args["return_parents"].(bool)
+	if contextWindow, ok := args["context_window"].(float64); ok {
+		req.ContextWindow = int(contextWindow)
+	}
+	if limit, ok := args["limit"].(float64); ok {
+		req.Limit = int(limit)
+	}
+	if offset, ok := args["offset"].(float64); ok {
+		req.Offset = int(offset)
+	}
+	req.Cursor, _ = args["cursor"].(string)
+	req.MinScore = floatArg(args, "min_score")
+	req.MaxDistance = floatArg(args, "max_distance")
+	req.VectorWeight = floatArg(args, "vector_weight")
+	req.KeywordWeight = floatArg(args, "keyword_weight")
+	if rerank, ok := args["rerank"].(bool); ok {
+		req.Rerank = &rerank
+	}
+	if candidates, ok := args["rerank_candidates"].(float64); ok {
+		req.RerankCandidates = int(candidates)
+	}
+	req.MMR, _ = args["mmr"].(bool)
+	req.MMRLambda = floatArg(args, "mmr_lambda")
+	if maxPerDocument, ok := args["max_per_document"].(float64); ok {
+		perDocument := int(maxPerDocument)
+		req.MaxPerDocument = &perDocument
+	}
+	req.Expansion, _ = args["expansion"].(string)
+	req.Explain, _ = args["explain"].(bool)
+	req.Graph, _ = args["graph"].(bool)
+	if hops, ok := args["graph_hops"].(float64); ok {
+		req.GraphHops = int(hops)
+	}
+	if paraphrases, ok := args["paraphrases"].(float64); ok {
+		req.Paraphrases = int(paraphrases)
+	}
+	if filters, ok := args["filters"]; ok {
+		// Round-trip through JSON to parse the dates and IDs
+		data, err := json.Marshal(filters)
+		if err != nil {
+			return nil, fmt.Errorf("invalid filters: %w", err)
+		}
+		if err := json.Unmarshal(data, &req.Filters); err != nil {
+			return nil, fmt.Errorf("invalid filters: %w", err)
+		}
+	}
+
+	return req, nil
+}
+
+// floatArg returns the numeric argument with the given name, or nil if it is not set
+func floatArg(args map[string]interface{}, name string) *float64 {
+	if value, ok := args[name].(float64); ok {
+		return &value
+	}
+	return nil
 }
 
 // handleGetKnowledgeGraph handles the get_knowledge_graph tool call
@@ -360,6 +765,120 @@ func (h *MCPHandler) handleGetKnowledgeGraph(args map[string]interface{}) (inter
 	}, nil
 }
 
+// graphToolProperties adds the traversal options shared by the graph tools to
+// the properties of a tool
+func graphToolProperties(properties map[string]interface{}) map[string]interface{} {
+	properties["direction"] = map[string]interface{}{
+		"type":        "string",
+		"enum":        []string{"out", "in", "both"},
+		"description": "Optional direction of the relationships to follow: out from the entity, in to it, or both (default)",
+	}
+	properties["relationship_types"] = map[string]interface{}{
+		"type":        "array",
+		"items":       map[string]interface{}{"type": "string"},
+		"description": "Optional relationship types to follow, e.g. works_at",
+	}
+	return properties
+}
+
+// nodeIDArg returns the node ID argument idName or, when it is not set, the
+// ID of the node named by the argument nameName
+func (h *MCPHandler) nodeIDArg(ctx context.Context, args map[string]interface{}, idName, nameName string) (int, error) {
+	if id, ok := args[idName].(float64); ok {
+		return int(id), nil
+	}
+	name, ok := args[nameName].(string)
+	if !ok || name == "" {
+		return 0, fmt.Errorf("%s or %s is required", idName, nameName)
+	}
+	node, err := h.ragService.FindKnowledgeNode(ctx, name)
+	if err != nil {
+		return 0, err
+	}
+	return node.ID, nil
+}
+
+// stringListArg returns the string array argument with the given name
+func stringListArg(args map[string]interface{}, name string) []string {
+	values, _ := args[name].([]interface{})
+	var result []string
+	for _, value := range values {
+		if s, ok := value.(string); ok {
+			result = append(result, s)
+		}
+	}
+	return result
+}
+
+// handleGetNodeNeighbors handles the get_node_neighbors tool call
+func (h *MCPHandler) handleGetNodeNeighbors(args map[string]interface{}) (interface{}, error) {
+	ctx := context.Background()
+	nodeID, err := h.nodeIDArg(ctx, args, "node_id", "node")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.NeighborsRequest{
+		NodeID:            nodeID,
+		RelationshipTypes: stringListArg(args, "relationship_types"),
+		NodeTypes:         stringListArg(args, "node_types"),
+	}
+	req.Direction, _ = args["direction"].(string)
+	if limit, ok := args["limit"].(float64); ok {
+		req.Limit = int(limit)
+	}
+
+	return h.ragService.GetNodeNeighbors(ctx, req)
+}
+
+// handleGetSubgraph handles the get_subgraph tool call
+func (h *MCPHandler) handleGetSubgraph(args map[string]interface{}) (interface{}, error) {
+	ctx := context.Background()
+	nodeID, err := h.nodeIDArg(ctx, args, "node_id", "node")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.SubgraphRequest{
+		NodeID:            nodeID,
+		RelationshipTypes: stringListArg(args, "relationship_types"),
+	}
+	req.Direction, _ = args["direction"].(string)
+	if hops, ok := args["hops"].(float64); ok {
+		req.Hops = int(hops)
+	}
+	if maxNodes, ok := args["max_nodes"].(float64); ok {
+		req.MaxNodes = int(maxNodes)
+	}
+
+	return h.ragService.GetSubgraph(ctx, req)
+}
+
+// handleFindPath handles the find_path tool call
+func (h *MCPHandler) handleFindPath(args map[string]interface{}) (interface{}, error) {
+	ctx := context.Background()
+	sourceID, err := h.nodeIDArg(ctx, args, "source_id", "source")
+	if err != nil {
+		return nil, err
+	}
+	targetID, err := h.nodeIDArg(ctx, args, "target_id", "target")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &models.PathRequest{
+		SourceID:          sourceID,
+		TargetID:          targetID,
+		RelationshipTypes: stringListArg(args, "relationship_types"),
+	}
+	req.Direction, _ = args["direction"].(string)
+	if maxHops, ok := args["max_hops"].(float64); ok {
+		req.MaxHops = int(maxHops)
+	}
+
+	return h.ragService.FindPath(ctx, req)
+}
+
 // handleQueueURL handles the queue_url tool call
 func (h *MCPHandler) handleQueueURL(args map[string]interface{}) (interface{}, error) {
 	url, ok := args["url"].(string)
@@ -367,7 +886,8 @@ func (h *MCPHandler) handleQueueURL(args map[string]interface{}) (interface{}, e
 		return nil, fmt.Errorf("url is required and must be a string")
 	}
 
-	err := h.ragService.QueueURL(context.Background(), url)
+	metadata, _ := args["metadata"].(map[string]interface{})
+	err := h.ragService.QueueURL(context.Background(), url, metadata)
 	if err != nil {
 		return nil, err
 	}
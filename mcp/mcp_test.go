@@ -16,12 +16,19 @@ import (
 // It allows us to check which methods were called and with what arguments.
 type mockRAGService struct {
 	logMCPRequestFunc          func(logEntry *models.MCPLog)
-	queueURLFunc               func(url string) error
+	queueURLFunc               func(url string, metadata map[string]any) error
 	getURLQueueFunc            func() ([]models.URLQueueItem, error)
 	getKnowledgeGraphFunc      func(query string) ([]models.KnowledgeNodeResponse, []models.KnowledgeEdgeResponse, error)
 	getKnowledgeGraphByDocFunc func(docID int) ([]models.KnowledgeNodeResponse, []models.KnowledgeEdgeResponse, error)
-	queryFunc                  func(query string) (*models.QueryResponse, error)
+	queryFunc                  func(req *models.QueryRequest) (*models.QueryResponse, error)
 	processDocumentFunc        func(req *models.ProcessDocumentRequest) error
+	answerFunc                 func(req *models.AnswerRequest) (*models.AnswerResponse, error)
+	createChatSessionFunc      func(title string) (*models.ChatSession, error)
+	chatFunc                   func(sessionID int, req *models.AnswerRequest) (*models.ChatTurn, error)
+	findKnowledgeNodeFunc      func(name string) (*models.KnowledgeNodeResponse, error)
+	getNodeNeighborsFunc       func(req *models.NeighborsRequest) (*models.NeighborsResponse, error)
+	getSubgraphFunc            func(req *models.SubgraphRequest) (*models.SubgraphResponse, error)
+	findPathFunc               func(req *models.PathRequest) (*models.PathResponse, error)
 }
 
 func (m *mockRAGService) LogMCPRequest(ctx context.Context, logEntry *models.MCPLog) error {
@@ -31,9 +38,9 @@ func (m *mockRAGService) LogMCPRequest(ctx context.Context, logEntry *models.MCP
 	return nil
 }
 
-func (m *mockRAGService) QueueURL(ctx context.Context, url string) error {
+func (m *mockRAGService) QueueURL(ctx context.Context, url string, metadata map[string]any) error {
 	if m.queueURLFunc != nil {
-		return m.queueURLFunc(url)
+		return m.queueURLFunc(url, metadata)
 	}
 	return nil
 }
@@ -59,9 +66,9 @@ func (m *mockRAGService) GetKnowledgeGraphByDocument(ctx context.Context, docume
 	return nil, nil, nil
 }
 
-func (m *mockRAGService) Query(ctx context.Context, query string) (*models.QueryResponse, error) {
+func (m *mockRAGService) QueryWithOptions(ctx context.Context, req *models.QueryRequest) (*models.QueryResponse, error) {
 	if m.queryFunc != nil {
-		return m.queryFunc(query)
+		return m.queryFunc(req)
 	}
 	return nil, nil
 }
@@ -73,6 +80,55 @@ func (m *mockRAGService) ProcessDocument(ctx context.Context, req *models.Proces
 	return nil
 }
 
+func (m *mockRAGService) Answer(ctx context.Context, req *models.AnswerRequest) (*models.AnswerResponse, error) {
+	if m.answerFunc != nil {
+		return m.answerFunc(req)
+	}
+	return &models.AnswerResponse{Query: req.Query}, nil
+}
+
+func (m *mockRAGService) CreateChatSession(ctx context.Context, title string) (*models.ChatSession, error) {
+	if m.createChatSessionFunc != nil {
+		return m.createChatSessionFunc(title)
+	}
+	return &models.ChatSession{Title: title}, nil
+}
+
+func (m *mockRAGService) Chat(ctx context.Context, sessionID int, req *models.AnswerRequest) (*models.ChatTurn, error) {
+	if m.chatFunc != nil {
+		return m.chatFunc(sessionID, req)
+	}
+	return &models.ChatTurn{SessionID: sessionID, Question: req.Query}, nil
+}
+
+func (m *mockRAGService) FindKnowledgeNode(ctx context.Context, name string) (*models.KnowledgeNodeResponse, error) {
+	if m.findKnowledgeNodeFunc != nil {
+		return m.findKnowledgeNodeFunc(name)
+	}
+	return &models.KnowledgeNodeResponse{Name: name}, nil
+}
+
+func (m *mockRAGService) GetNodeNeighbors(ctx context.Context, req *models.NeighborsRequest) (*models.NeighborsResponse, error) {
+	if m.getNodeNeighborsFunc != nil {
+		return m.getNodeNeighborsFunc(req)
+	}
+	return &models.NeighborsResponse{Node: models.KnowledgeNodeResponse{ID: req.NodeID}}, nil
+}
+
+func (m *mockRAGService) GetSubgraph(ctx context.Context, req *models.SubgraphRequest) (*models.SubgraphResponse, error) {
+	if m.getSubgraphFunc != nil {
+		return m.getSubgraphFunc(req)
+	}
+	return &models.SubgraphResponse{SeedID: req.NodeID}, nil
+}
+
+func (m *mockRAGService) FindPath(ctx context.Context, req *models.PathRequest) (*models.PathResponse, error) {
+	if m.findPathFunc != nil {
+		return m.findPathFunc(req)
+	}
+	return &models.PathResponse{}, nil
+}
+
 func TestMCPHandler(t *testing.T) {
 	t.Run("Handle tools/list request", func(t *testing.T) {
 		// Setup
@@ -120,18 +176,21 @@ func TestMCPHandler(t *testing.T) {
 			logMCPRequestFunc: func(logEntry *models.MCPLog) {
 				logCalled = true
 			},
-			queueURLFunc: func(url string) error {
+			queueURLFunc: func(url string, metadata map[string]any) error {
 				queueURLCalled = true
 				if url != testURL {
 					t.Errorf("expected queue_url to be called with '%s', got '%s'", testURL, url)
 				}
+				if metadata["team"] != "docs" {
+					t.Errorf("expected metadata to be passed through, got %v", metadata)
+				}
 				return nil
 			},
 		}
 		handler := NewMCPHandler(mockService)
 
 		// Create request
-		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "2", "params": {"name": "queue_url", "arguments": {"url": "https://example.com/test"}}}`
+		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "2", "params": {"name": "queue_url", "arguments": {"url": "https://example.com/test", "metadata": {"team": "docs"}}}}`
 		req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
 		req.Header.Set("Content-Type", "application/json")
 		rr := httptest.NewRecorder()
@@ -156,6 +215,230 @@ func TestMCPHandler(t *testing.T) {
 		}
 	})
 
+	t.Run("Handle tools/call for query_knowledge_base", func(t *testing.T) {
+		// Setup
+		queryCalled := false
+		mockService := &mockRAGService{
+			queryFunc: func(req *models.QueryRequest) (*models.QueryResponse, error) {
+				queryCalled = true
+				if req.Query != "install on linux" {
+					t.Errorf("expected query 'install on linux', got '%s'", req.Query)
+				}
+				if !req.ReturnParents {
+					t.Error("expected return_parents to be passed through")
+				}
+				if req.Rerank == nil || *req.Rerank {
+					t.Error("expected rerank to be passed through")
+				}
+				if req.Filters == nil || req.Filters.Domain != "example.com" || len(req.Filters.DocumentIDs) != 1 ||
+					req.Filters.CreatedAfter == nil {
+					t.Errorf("expected filters to be passed through, got %+v", req.Filters)
+				}
+				if !req.Graph || req.GraphHops != 2 {
+					t.Errorf("expected graph options to be passed through, got %v with %d hops", req.Graph, req.GraphHops)
+				}
+				if req.Expansion != "multi_query" || req.Paraphrases != 2 {
+					t.Errorf("expected expansion to be passed through, got %q with %d paraphrases", req.Expansion, req.Paraphrases)
+				}
+				return &models.QueryResponse{
+					Results:   []models.SearchResult{{Content: "## Linux"}},
+					Expansion: &models.QueryExpansion{Mode: "multi_query", Queries: []string{"linux setup"}},
+				}, nil
+			},
+		}
+		handler := NewMCPHandler(mockService)
+
+		// Create request
+		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "4", "params": {"name": "query_knowledge_base", "arguments": {"query": "install on linux", "return_parents": true, "rerank": false, "filters": {"domain": "example.com", "document_ids": [3], "created_after": "2024-01-01T00:00:00Z"}, "expansion": "multi_query", "paraphrases": 2, "graph": true, "graph_hops": 2}}}`
+		req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// Execute
+		handler.HandleRequest(rr, req)
+
+		// Assert
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if !queryCalled {
+			t.Error("expected QueryWithOptions to be called, but it was not")
+		}
+		if !strings.Contains(rr.Body.String(), "## Linux") {
+			t.Errorf("handler response body does not contain the result: got %v", rr.Body.String())
+		}
+		if !strings.Contains(rr.Body.String(), "linux setup") {
+			t.Errorf("handler response body does not contain the expansion: got %v", rr.Body.String())
+		}
+	})
+
+	t.Run("Handle tools/call for answer_question", func(t *testing.T) {
+		// Setup
+		answerCalled := false
+		mockService := &mockRAGService{
+			answerFunc: func(req *models.AnswerRequest) (*models.AnswerResponse, error) {
+				answerCalled = true
+				if req.Query != "how do I install it?" || req.Model != "gpt-4o" || req.Limit != 3 {
+					t.Errorf("expected the question, model and limit to be passed through, got %+v", req)
+				}
+				return &models.AnswerResponse{
+					Query:     req.Query,
+					Answer:    "Run the installer [1].",
+					Citations: []models.Citation{{Number: 1, DocumentID: 7, URL: "https://example.com/install"}},
+				}, nil
+			},
+		}
+		handler := NewMCPHandler(mockService)
+
+		// Create request
+		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "5", "params": {"name": "answer_question", "arguments": {"query": "how do I install it?", "model": "gpt-4o", "limit": 3}}}`
+		req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// Execute
+		handler.HandleRequest(rr, req)
+
+		// Assert
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if !answerCalled {
+			t.Error("expected Answer to be called, but it was not")
+		}
+		if !strings.Contains(rr.Body.String(), "https://example.com/install") {
+			t.Errorf("handler response body does not contain the citation: got %v", rr.Body.String())
+		}
+	})
+
+	t.Run("Handle tools/call for chat", func(t *testing.T) {
+		// Setup
+		sessionCreated := false
+		var chatSessionIDs []int
+		mockService := &mockRAGService{
+			createChatSessionFunc: func(title string) (*models.ChatSession, error) {
+				sessionCreated = true
+				return &models.ChatSession{ID: 12}, nil
+			},
+			chatFunc: func(sessionID int, req *models.AnswerRequest) (*models.ChatTurn, error) {
+				chatSessionIDs = append(chatSessionIDs, sessionID)
+				return &models.ChatTurn{SessionID: sessionID, Question: req.Query, Query: "how do I install the CLI?"}, nil
+			},
+		}
+		handler := NewMCPHandler(mockService)
+
+		// A call without a session starts a new one, later calls continue it
+		for _, arguments := range []string{
+			`{"query": "how do I install the CLI?"}`,
+			`{"query": "and on Windows?", "session_id": 12}`,
+		} {
+			body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "6", "params": {"name": "chat", "arguments": ` + arguments + `}}`
+			req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
+			req.Header.Set("Content-Type", "application/json")
+			rr := httptest.NewRecorder()
+
+			// Execute
+			handler.HandleRequest(rr, req)
+
+			// Assert
+			if status := rr.Code; status != http.StatusOK {
+				t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+			}
+			if !strings.Contains(rr.Body.String(), `"session_id":12`) {
+				t.Errorf("handler response body does not contain the session: got %v", rr.Body.String())
+			}
+		}
+		if !sessionCreated {
+			t.Error("expected CreateChatSession to be called, but it was not")
+		}
+		if len(chatSessionIDs) != 2 || chatSessionIDs[0] != 12 || chatSessionIDs[1] != 12 {
+			t.Errorf("expected both turns in session 12, got %v", chatSessionIDs)
+		}
+	})
+
+	t.Run("Handle tools/call for get_node_neighbors", func(t *testing.T) {
+		// Setup
+		var received *models.NeighborsRequest
+		mockService := &mockRAGService{
+			getNodeNeighborsFunc: func(req *models.NeighborsRequest) (*models.NeighborsResponse, error) {
+				received = req
+				return &models.NeighborsResponse{
+					Node: models.KnowledgeNodeResponse{ID: req.NodeID, Name: "Jane Smith"},
+					Neighbors: []models.NodeNeighbor{{
+						Node:      models.KnowledgeNodeResponse{ID: 8, Name: "Acme"},
+						Edge:      models.KnowledgeEdgeResponse{ID: 3, SourceID: req.NodeID, TargetID: 8, RelationshipType: "works_at"},
+						Direction: "out",
+					}},
+				}, nil
+			},
+		}
+		handler := NewMCPHandler(mockService)
+
+		// Create request
+		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "7", "params": {"name": "get_node_neighbors", "arguments": {"node_id": 4, "direction": "out", "relationship_types": ["works_at"], "limit": 10}}}`
+		req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// Execute
+		handler.HandleRequest(rr, req)
+
+		// Assert
+		if status := rr.Code; status != http.StatusOK {
+			t.Errorf("handler returned wrong status code: got %v want %v", status, http.StatusOK)
+		}
+		if received == nil {
+			t.Fatal("expected GetNodeNeighbors to be called, but it was not")
+		}
+		if received.NodeID != 4 || received.Direction != "out" || received.Limit != 10 ||
+			len(received.RelationshipTypes) != 1 || received.RelationshipTypes[0] != "works_at" {
+			t.Errorf("expected the node and options to be passed through, got %+v", received)
+		}
+		if !strings.Contains(rr.Body.String(), `"relationship_type":"works_at"`) {
+			t.Errorf("handler response body does not contain the edge: got %v", rr.Body.String())
+		}
+	})
+
+	t.Run("Handle tools/call for find_path by name", func(t *testing.T) {
+		// Setup
+		var lookedUp []string
+		var received *models.PathRequest
+		mockService := &mockRAGService{
+			findKnowledgeNodeFunc: func(name string) (*models.KnowledgeNodeResponse, error) {
+				lookedUp = append(lookedUp, name)
+				return &models.KnowledgeNodeResponse{ID: 20 + len(lookedUp), Name: name}, nil
+			},
+			findPathFunc: func(req *models.PathRequest) (*models.PathResponse, error) {
+				received = req
+				return &models.PathResponse{Found: true, Hops: 1}, nil
+			},
+		}
+		handler := NewMCPHandler(mockService)
+
+		// Create request
+		body := `{"jsonrpc": "2.0", "method": "tools/call", "id": "8", "params": {"name": "find_path", "arguments": {"source": "Jane Smith", "target_id": 5, "max_hops": 3}}}`
+		req := httptest.NewRequest("POST", "/mcp", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+
+		// Execute
+		handler.HandleRequest(rr, req)
+
+		// Assert
+		if len(lookedUp) != 1 || lookedUp[0] != "Jane Smith" {
+			t.Errorf("expected only the source to be looked up by name, got %v", lookedUp)
+		}
+		if received == nil {
+			t.Fatal("expected FindPath to be called, but it was not")
+		}
+		if received.SourceID != 21 || received.TargetID != 5 || received.MaxHops != 3 {
+			t.Errorf("expected the resolved ends to be passed through, got %+v", received)
+		}
+		if !strings.Contains(rr.Body.String(), `"found":true`) {
+			t.Errorf("handler response body does not contain the path: got %v", rr.Body.String())
+		}
+	})
+
 	t.Run("Handle tools/call for non-existent tool", func(t *testing.T) {
 		// Setup
 		logCalled := false
@@ -0,0 +1,6 @@
+-- Full-text search over chunks, kept up to date by PostgreSQL
+-- Adding the generated column computes it for existing chunks
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS content_tsv tsvector
+    GENERATED ALWAYS AS (to_tsvector('english', COALESCE(content, ''))) STORED;
+
+CREATE INDEX IF NOT EXISTS idx_chunks_content_tsv ON chunks USING GIN (content_tsv);
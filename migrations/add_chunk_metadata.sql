@@ -0,0 +1,2 @@
+-- Per-chunk metadata such as the heading breadcrumb ("section_path") of the chunk
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
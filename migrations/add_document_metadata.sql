@@ -0,0 +1,7 @@
+-- Arbitrary metadata on documents, inherited by their chunks
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS metadata JSONB NOT NULL DEFAULT '{}';
+
+-- Metadata given when a URL is queued, stored on the document once it is processed
+ALTER TABLE url_queue ADD COLUMN IF NOT EXISTS metadata JSONB;
+
+CREATE INDEX IF NOT EXISTS idx_documents_metadata ON documents USING GIN (metadata jsonb_path_ops);
@@ -0,0 +1,16 @@
+-- Create edge mentions table, linking knowledge edges to every document they were extracted from
+CREATE TABLE IF NOT EXISTS edge_mentions (
+    id SERIAL PRIMARY KEY,
+    edge_id INTEGER NOT NULL REFERENCES knowledge_edges(id) ON DELETE CASCADE,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (edge_id, document_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_edge_mentions_document_id ON edge_mentions(document_id);
+
+-- Existing edges are mentioned by the document they were last extracted from
+INSERT INTO edge_mentions (edge_id, document_id)
+SELECT id, document_id FROM knowledge_edges
+WHERE document_id IS NOT NULL
+ON CONFLICT DO NOTHING;
@@ -0,0 +1,12 @@
+-- Embedding cache keyed by content hash and embedding model
+-- The embedding column has no fixed dimension so entries from different models can coexist
+CREATE TABLE IF NOT EXISTS embedding_cache (
+    content_hash CHAR(64) NOT NULL,
+    model TEXT NOT NULL,
+    dimensions INTEGER NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (content_hash, model, dimensions)
+);
+
+CREATE INDEX IF NOT EXISTS idx_embedding_cache_model ON embedding_cache(model);
@@ -0,0 +1,31 @@
+-- Record the embedding model and dimensions per row
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_dimensions INTEGER;
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS embedding_dimensions INTEGER;
+ALTER TABLE knowledge_nodes ADD COLUMN IF NOT EXISTS embedding_model TEXT;
+ALTER TABLE knowledge_nodes ADD COLUMN IF NOT EXISTS embedding_dimensions INTEGER;
+
+-- Staging columns written during an embedding migration, before cut over
+-- They have no fixed dimension so the target model may differ from the current one
+ALTER TABLE documents ADD COLUMN IF NOT EXISTS embedding_next vector;
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS embedding_next vector;
+ALTER TABLE knowledge_nodes ADD COLUMN IF NOT EXISTS embedding_next vector;
+
+-- Track re-embedding of the corpus with a new model
+CREATE TABLE IF NOT EXISTS embedding_migrations (
+    id SERIAL PRIMARY KEY,
+    provider TEXT NOT NULL,
+    from_model TEXT,
+    from_dimensions INTEGER,
+    to_model TEXT NOT NULL,
+    to_dimensions INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    total_count INTEGER DEFAULT 0,
+    processed_count INTEGER DEFAULT 0,
+    failed_count INTEGER DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
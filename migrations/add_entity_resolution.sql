@@ -0,0 +1,28 @@
+-- Create node aliases table, the names of the nodes merged into a node; extraction resolves them to the node
+CREATE TABLE IF NOT EXISTS node_aliases (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL REFERENCES knowledge_nodes(id) ON DELETE CASCADE,
+    alias TEXT NOT NULL,
+    type TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alias, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_aliases_node_id ON node_aliases(node_id);
+
+-- Create entity merge proposals table; node IDs are not foreign keys so that decisions outlive merged nodes
+CREATE TABLE IF NOT EXISTS entity_merge_proposals (
+    id SERIAL PRIMARY KEY,
+    source_id INTEGER NOT NULL,
+    source_name TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    target_name TEXT NOT NULL,
+    similarity DOUBLE PRECISION,
+    reasons TEXT[] NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_merge_proposals_status ON entity_merge_proposals(status);
+CREATE INDEX IF NOT EXISTS idx_entity_merge_proposals_nodes ON entity_merge_proposals(source_id, target_id);
@@ -0,0 +1,2 @@
+-- Index for linking query phrases to knowledge nodes by name in graph queries
+CREATE INDEX IF NOT EXISTS idx_knowledge_nodes_lower_name ON knowledge_nodes(lower(name));
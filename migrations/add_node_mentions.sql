@@ -0,0 +1,28 @@
+-- Create node mentions table, linking knowledge nodes to every document and chunk they were extracted from
+CREATE TABLE IF NOT EXISTS node_mentions (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL REFERENCES knowledge_nodes(id) ON DELETE CASCADE,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    chunk_id INTEGER REFERENCES chunks(id) ON DELETE CASCADE,
+    start_position INTEGER,
+    end_position INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (node_id, document_id, chunk_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_mentions_node_id ON node_mentions(node_id);
+CREATE INDEX IF NOT EXISTS idx_node_mentions_document_id ON node_mentions(document_id);
+CREATE INDEX IF NOT EXISTS idx_node_mentions_chunk_id ON node_mentions(chunk_id);
+
+-- NULL chunk IDs are distinct to the table constraint, so whole-document mentions need their own
+DELETE FROM node_mentions m
+USING node_mentions d
+WHERE m.chunk_id IS NULL AND d.chunk_id IS NULL
+  AND m.node_id = d.node_id AND m.document_id = d.document_id AND m.id > d.id;
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_mentions_document_node ON node_mentions(node_id, document_id) WHERE chunk_id IS NULL;
+
+-- Existing nodes are mentioned by the document they were last extracted from
+INSERT INTO node_mentions (node_id, document_id)
+SELECT id, document_id FROM knowledge_nodes kn
+WHERE document_id IS NOT NULL
+  AND NOT EXISTS (SELECT 1 FROM node_mentions m WHERE m.node_id = kn.id AND m.document_id = kn.document_id);
@@ -0,0 +1,16 @@
+-- Parent sections that chunks are grouped under for small-to-big retrieval
+CREATE TABLE IF NOT EXISTS parent_chunks (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER REFERENCES documents(id) ON DELETE CASCADE,
+    content TEXT,
+    chunk_index INTEGER,
+    start_position INTEGER,
+    end_position INTEGER,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+ALTER TABLE chunks ADD COLUMN IF NOT EXISTS parent_id INTEGER REFERENCES parent_chunks(id) ON DELETE CASCADE;
+
+CREATE INDEX IF NOT EXISTS idx_chunks_parent_id ON chunks(parent_id);
+CREATE INDEX IF NOT EXISTS idx_parent_chunks_document_id ON parent_chunks(document_id);
@@ -0,0 +1,5 @@
+-- Indexes for the metadata, URL prefix and date filters of queries
+CREATE INDEX IF NOT EXISTS idx_chunks_metadata ON chunks USING GIN (metadata jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_documents_url_pattern ON documents(url text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_documents_created_at ON documents(created_at);
+CREATE INDEX IF NOT EXISTS idx_documents_updated_at ON documents(updated_at);
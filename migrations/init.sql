@@ -8,19 +8,41 @@ CREATE TABLE IF NOT EXISTS documents (
     title TEXT,
     content TEXT,
     embedding vector(1536),
+    embedding_model TEXT,
+    embedding_dimensions INTEGER,
+    embedding_next vector,
+    metadata JSONB NOT NULL DEFAULT '{}',
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
+-- Create parent chunks table, the sections that chunks are grouped under for small-to-big retrieval
+CREATE TABLE IF NOT EXISTS parent_chunks (
+    id SERIAL PRIMARY KEY,
+    document_id INTEGER REFERENCES documents(id) ON DELETE CASCADE,
+    content TEXT,
+    chunk_index INTEGER,
+    start_position INTEGER,
+    end_position INTEGER,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
 -- Create chunks table
 CREATE TABLE IF NOT EXISTS chunks (
     id SERIAL PRIMARY KEY,
     document_id INTEGER REFERENCES documents(id),
     content TEXT,
     embedding vector(1536),
+    embedding_model TEXT,
+    embedding_dimensions INTEGER,
+    embedding_next vector,
     chunk_index INTEGER,
     start_position INTEGER,
     end_position INTEGER,
+    metadata JSONB NOT NULL DEFAULT '{}',
+    parent_id INTEGER REFERENCES parent_chunks(id) ON DELETE CASCADE,
+    content_tsv tsvector GENERATED ALWAYS AS (to_tsvector('english', COALESCE(content, ''))) STORED,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
 
@@ -31,6 +53,9 @@ CREATE TABLE IF NOT EXISTS knowledge_nodes (
     type TEXT,
     properties JSONB,
     embedding vector(1536),
+    embedding_model TEXT,
+    embedding_dimensions INTEGER,
+    embedding_next vector,
     document_id INTEGER REFERENCES documents(id),
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     UNIQUE (name, type)
@@ -55,6 +80,7 @@ CREATE TABLE IF NOT EXISTS url_queue (
     status TEXT NOT NULL DEFAULT 'pending',
     error TEXT,
     retry_count INTEGER DEFAULT 0,
+    metadata JSONB,
     created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
     updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
 );
@@ -64,7 +90,16 @@ CREATE INDEX IF NOT EXISTS idx_documents_embedding ON documents USING ivfflat (e
 CREATE INDEX IF NOT EXISTS idx_chunks_embedding ON chunks USING ivfflat (embedding vector_cosine_ops);
 CREATE INDEX IF NOT EXISTS idx_knowledge_nodes_embedding ON knowledge_nodes USING ivfflat (embedding vector_cosine_ops);
 CREATE INDEX IF NOT EXISTS idx_chunks_document_id ON chunks(document_id);
+CREATE INDEX IF NOT EXISTS idx_chunks_parent_id ON chunks(parent_id);
+CREATE INDEX IF NOT EXISTS idx_chunks_content_tsv ON chunks USING GIN (content_tsv);
+CREATE INDEX IF NOT EXISTS idx_chunks_metadata ON chunks USING GIN (metadata jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_parent_chunks_document_id ON parent_chunks(document_id);
+CREATE INDEX IF NOT EXISTS idx_documents_metadata ON documents USING GIN (metadata jsonb_path_ops);
+CREATE INDEX IF NOT EXISTS idx_documents_url_pattern ON documents(url text_pattern_ops);
+CREATE INDEX IF NOT EXISTS idx_documents_created_at ON documents(created_at);
+CREATE INDEX IF NOT EXISTS idx_documents_updated_at ON documents(updated_at);
 CREATE INDEX IF NOT EXISTS idx_knowledge_nodes_document_id ON knowledge_nodes(document_id);
+CREATE INDEX IF NOT EXISTS idx_knowledge_nodes_lower_name ON knowledge_nodes(lower(name));
 CREATE INDEX IF NOT EXISTS idx_knowledge_edges_document_id ON knowledge_edges(document_id);
 CREATE INDEX IF NOT EXISTS idx_knowledge_edges_source_id ON knowledge_edges(source_id);
 CREATE INDEX IF NOT EXISTS idx_knowledge_edges_target_id ON knowledge_edges(target_id);
@@ -75,4 +110,113 @@ CREATE INDEX IF NOT EXISTS idx_url_queue_created_at ON url_queue(created_at);
 
 -- Create unique indexes to prevent duplicate URLs
 CREATE UNIQUE INDEX IF NOT EXISTS idx_documents_url_unique ON documents(url);
-CREATE UNIQUE INDEX IF NOT EXISTS idx_url_queue_url_unique ON url_queue(url); 
\ No newline at end of file
+CREATE UNIQUE INDEX IF NOT EXISTS idx_url_queue_url_unique ON url_queue(url);
+
+-- Create embedding cache table, keyed by content hash and embedding model
+CREATE TABLE IF NOT EXISTS embedding_cache (
+    content_hash CHAR(64) NOT NULL,
+    model TEXT NOT NULL,
+    dimensions INTEGER NOT NULL,
+    embedding vector NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (content_hash, model, dimensions)
+);
+
+CREATE INDEX IF NOT EXISTS idx_embedding_cache_model ON embedding_cache(model);
+
+-- Create embedding migrations table, tracking re-embedding of the corpus with a new model
+CREATE TABLE IF NOT EXISTS embedding_migrations (
+    id SERIAL PRIMARY KEY,
+    provider TEXT NOT NULL,
+    from_model TEXT,
+    from_dimensions INTEGER,
+    to_model TEXT NOT NULL,
+    to_dimensions INTEGER NOT NULL,
+    status TEXT NOT NULL DEFAULT 'running',
+    total_count INTEGER DEFAULT 0,
+    processed_count INTEGER DEFAULT 0,
+    failed_count INTEGER DEFAULT 0,
+    error TEXT,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    completed_at TIMESTAMP WITH TIME ZONE
+);
+
+-- Create chat sessions table, conversations whose follow-up questions are rewritten using earlier turns
+CREATE TABLE IF NOT EXISTS chat_sessions (
+    id SERIAL PRIMARY KEY,
+    title TEXT NOT NULL DEFAULT '',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    updated_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+-- Create chat turns table, one question and its answer per row
+CREATE TABLE IF NOT EXISTS chat_turns (
+    id SERIAL PRIMARY KEY,
+    session_id INTEGER NOT NULL REFERENCES chat_sessions(id) ON DELETE CASCADE,
+    question TEXT NOT NULL,
+    query TEXT NOT NULL,
+    answer TEXT NOT NULL,
+    citations JSONB NOT NULL DEFAULT '[]',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_chat_turns_session_id ON chat_turns(session_id);
+
+-- Create node mentions table, linking knowledge nodes to every document and chunk they were extracted from
+CREATE TABLE IF NOT EXISTS node_mentions (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL REFERENCES knowledge_nodes(id) ON DELETE CASCADE,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    chunk_id INTEGER REFERENCES chunks(id) ON DELETE CASCADE,
+    start_position INTEGER,
+    end_position INTEGER,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (node_id, document_id, chunk_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_mentions_node_id ON node_mentions(node_id);
+CREATE INDEX IF NOT EXISTS idx_node_mentions_document_id ON node_mentions(document_id);
+CREATE INDEX IF NOT EXISTS idx_node_mentions_chunk_id ON node_mentions(chunk_id);
+-- NULL chunk IDs are distinct to the table constraint, so whole-document mentions need their own
+CREATE UNIQUE INDEX IF NOT EXISTS idx_node_mentions_document_node ON node_mentions(node_id, document_id) WHERE chunk_id IS NULL;
+
+-- Create edge mentions table, linking knowledge edges to every document they were extracted from
+CREATE TABLE IF NOT EXISTS edge_mentions (
+    id SERIAL PRIMARY KEY,
+    edge_id INTEGER NOT NULL REFERENCES knowledge_edges(id) ON DELETE CASCADE,
+    document_id INTEGER NOT NULL REFERENCES documents(id) ON DELETE CASCADE,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (edge_id, document_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_edge_mentions_document_id ON edge_mentions(document_id);
+
+-- Create node aliases table, the names of the nodes merged into a node; extraction resolves them to the node
+CREATE TABLE IF NOT EXISTS node_aliases (
+    id SERIAL PRIMARY KEY,
+    node_id INTEGER NOT NULL REFERENCES knowledge_nodes(id) ON DELETE CASCADE,
+    alias TEXT NOT NULL,
+    type TEXT NOT NULL,
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    UNIQUE (alias, type)
+);
+
+CREATE INDEX IF NOT EXISTS idx_node_aliases_node_id ON node_aliases(node_id);
+
+-- Create entity merge proposals table; node IDs are not foreign keys so that decisions outlive merged nodes
+CREATE TABLE IF NOT EXISTS entity_merge_proposals (
+    id SERIAL PRIMARY KEY,
+    source_id INTEGER NOT NULL,
+    source_name TEXT NOT NULL,
+    target_id INTEGER NOT NULL,
+    target_name TEXT NOT NULL,
+    similarity DOUBLE PRECISION,
+    reasons TEXT[] NOT NULL DEFAULT '{}',
+    status TEXT NOT NULL DEFAULT 'pending',
+    created_at TIMESTAMP WITH TIME ZONE DEFAULT CURRENT_TIMESTAMP,
+    decided_at TIMESTAMP WITH TIME ZONE
+);
+
+CREATE INDEX IF NOT EXISTS idx_entity_merge_proposals_status ON entity_merge_proposals(status);
+CREATE INDEX IF NOT EXISTS idx_entity_merge_proposals_nodes ON entity_merge_proposals(source_id, target_id);
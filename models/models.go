@@ -12,8 +12,12 @@ type Document struct {
 	Title     string    `json:"title"`
 	Content   string    `json:"content"`
 	Embedding []float32 `json:"-"`
-	CreatedAt time.Time `json:"created_at"`
-	UpdatedAt time.Time `json:"updated_at"`
+	// EmbeddingModel and EmbeddingDimensions describe the model that produced Embedding
+	EmbeddingModel      string         `json:"embedding_model,omitempty"`
+	EmbeddingDimensions int            `json:"embedding_dimensions,omitempty"`
+	Metadata            map[string]any `json:"metadata,omitempty"`
+	CreatedAt           time.Time      `json:"created_at"`
+	UpdatedAt           time.Time      `json:"updated_at"`
 }
 
 // Chunk represents a text chunk from a document
@@ -27,7 +31,15 @@ type Chunk struct {
 	EndPosition   int       `json:"end_position"`
 	URL           string    `json:"url"`
 	Score         float32   `json:"score"`
-	CreatedAt     time.Time `json:"created_at"`
+	// EmbeddingModel and EmbeddingDimensions describe the model that produced Embedding
+	EmbeddingModel      string `json:"embedding_model,omitempty"`
+	EmbeddingDimensions int    `json:"embedding_dimensions,omitempty"`
+	// SectionPath is the heading breadcrumb of the chunk, e.g. "Install > Linux > Troubleshooting"
+	SectionPath string         `json:"section_path,omitempty"`
+	Metadata    map[string]any `json:"metadata,omitempty"`
+	// ParentID is the parent section the chunk belongs to
+	ParentID  *int      `json:"parent_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 // KnowledgeNode represents a node in the knowledge graph
@@ -52,6 +64,10 @@ type KnowledgeNodeResponse struct {
 	DocumentID *int           `json:"document_id,omitempty"`
 	URL        *string        `json:"url,omitempty"`
 	Title      *string        `json:"title,omitempty"`
+	// DocumentIDs are the documents mentioning the node; DocumentID is the first of them
+	DocumentIDs []int `json:"document_ids,omitempty"`
+	// Aliases are the names of the nodes merged into this one
+	Aliases []string `json:"aliases,omitempty"`
 }
 
 // ToResponse converts KnowledgeNode to KnowledgeNodeResponse
@@ -130,6 +146,8 @@ type URLQueueItem struct {
 	UpdatedAt  time.Time `json:"updated_at"`
 	RetryCount int       `json:"retry_count"`
 	DocumentID int       `json:"document_id,omitempty"`
+	// Metadata is stored on the document when the URL is processed
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // MCPLog represents a log entry for an MCP request/response
@@ -143,6 +161,33 @@ type MCPLog struct {
 	CreatedAt time.Time       `json:"created_at"`
 }
 
+// EmbeddingCacheStats represents embedding cache counters and size
+type EmbeddingCacheStats struct {
+	Enabled bool   `json:"enabled"`
+	Model   string `json:"model"`
+	Hits    int64  `json:"hits"`
+	Misses  int64  `json:"misses"`
+	Entries int64  `json:"entries"`
+}
+
+// EmbeddingMigration represents a background job that re-embeds the corpus with a new model
+type EmbeddingMigration struct {
+	ID             int        `json:"id"`
+	Provider       string     `json:"provider"`
+	FromModel      string     `json:"from_model"`
+	FromDimensions int        `json:"from_dimensions"`
+	ToModel        string     `json:"to_model"`
+	ToDimensions   int        `json:"to_dimensions"`
+	Status         string     `json:"status"` // running, completed, failed or cancelled
+	TotalCount     int        `json:"total_count"`
+	ProcessedCount int        `json:"processed_count"`
+	FailedCount    int        `json:"failed_count"`
+	Error          string     `json:"error,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+	UpdatedAt      time.Time  `json:"updated_at"`
+	CompletedAt    *time.Time `json:"completed_at,omitempty"`
+}
+
 // VectorData represents a vector embedding with position information
 type VectorData struct {
 	ID            int       `json:"id"`
@@ -160,6 +205,20 @@ type ProcessDocumentRequest struct {
 	URL     string `json:"url"`
 	Title   string `json:"title"`
 	Content string `json:"content"`
+	// Optional chunking settings; unset values fall back to the configured defaults
+	ChunkStrategy string `json:"chunk_strategy,omitempty"` // markdown, sentence, token_window or recursive
+	ChunkSize     int    `json:"chunk_size,omitempty"`     // maximum tokens per chunk
+	ChunkOverlap  *int   `json:"chunk_overlap,omitempty"`  // tokens shared between consecutive chunks
+	// Metadata is stored on the document and inherited by its chunks; when
+	// omitted on re-ingest the stored metadata is kept
+	Metadata map[string]any `json:"metadata,omitempty"`
+}
+
+// StartEmbeddingMigrationRequest represents a request to re-embed the corpus with a new model
+type StartEmbeddingMigrationRequest struct {
+	Provider   string `json:"provider,omitempty"`
+	Model      string `json:"model"`
+	Dimensions int    `json:"dimensions"`
 }
 
 // QueryRequest represents a request to query the service
@@ -169,11 +228,125 @@ type QueryRequest struct {
 	Content string `json:"content,omitempty"`
 	Query   string `json:"query,omitempty"`
 	Limit   int    `json:"limit,omitempty"`
+	// Offset or Cursor (the next_cursor of a previous response) select the page of results
+	Offset int    `json:"offset,omitempty"`
+	Cursor string `json:"cursor,omitempty"`
+	// Optional scoring settings; unset values fall back to the configured defaults
+	MinScore      *float64 `json:"min_score,omitempty"`      // minimum fused score of a result, from 0 to 1
+	MaxDistance   *float64 `json:"max_distance,omitempty"`   // cosine distance cutoff for matching chunks
+	VectorWeight  *float64 `json:"vector_weight,omitempty"`  // weight of the vector ranking in the fused score
+	KeywordWeight *float64 `json:"keyword_weight,omitempty"` // weight of the full-text ranking in the fused score
+	// ReturnParents matches on chunks but returns the text of their parent
+	// sections, with each parent returned once
+	ReturnParents bool `json:"return_parents,omitempty"`
+	// ContextWindow is the number of neighboring chunks added on each side of every result
+	ContextWindow int `json:"context_window,omitempty"`
+	// Rerank turns the configured reranker off (false) for this request;
+	// RerankCandidates overrides the number of chunks passed to it
+	Rerank           *bool `json:"rerank,omitempty"`
+	RerankCandidates int   `json:"rerank_candidates,omitempty"`
+	// MMR diversifies the results by maximal marginal relevance over the chunk
+	// embeddings, trading relevance for diversity by MMRLambda (1 is pure relevance)
+	MMR       bool     `json:"mmr,omitempty"`
+	MMRLambda *float64 `json:"mmr_lambda,omitempty"`
+	// MaxPerDocument caps the number of results from one document, 0 for no limit
+	MaxPerDocument *int `json:"max_per_document,omitempty"`
+	// Filters restrict the chunks that are searched
+	Filters *QueryFilters `json:"filters,omitempty"`
+	// Expansion selects how the query is expanded before searching: "none",
+	// "multi_query" (search Paraphrases rewordings as well and fuse the
+	// rankings) or "hyde" (embed a hypothetical answer instead of the query)
+	Expansion   string `json:"expansion,omitempty"`
+	Paraphrases int    `json:"paraphrases,omitempty"`
+	// Explain adds how each result was ranked and how long each stage took to the response
+	Explain bool `json:"explain,omitempty"`
+	// Graph links the query to knowledge graph nodes, walks GraphHops (1 or 2)
+	// edges from them and ranks chunks of the documents of the reached nodes
+	// alongside the vector and full-text rankings
+	Graph     bool `json:"graph,omitempty"`
+	GraphHops int  `json:"graph_hops,omitempty"`
+}
+
+// QueryFilters restrict a query to matching documents and chunks. All set
+// filters must match.
+type QueryFilters struct {
+	DocumentIDs []int  `json:"document_ids,omitempty"`
+	URLPrefix   string `json:"url_prefix,omitempty"`
+	Domain      string `json:"domain,omitempty"` // host name, subdomains included
+	Title       string `json:"title,omitempty"`  // case-insensitive substring of the title
+	// Date ranges include their start and exclude their end
+	CreatedAfter  *time.Time `json:"created_after,omitempty"`
+	CreatedBefore *time.Time `json:"created_before,omitempty"`
+	UpdatedAfter  *time.Time `json:"updated_after,omitempty"`
+	UpdatedBefore *time.Time `json:"updated_before,omitempty"`
+	// Metadata holds key/values that the chunk metadata, which includes the
+	// document metadata, must contain
+	Metadata map[string]any `json:"metadata,omitempty"`
 }
 
 // QueryResponse represents the response from a query
 type QueryResponse struct {
 	Results []SearchResult `json:"results"`
+	Limit   int            `json:"limit"`
+	Offset  int            `json:"offset"`
+	// NextOffset and NextCursor are set when there may be more results
+	NextOffset int    `json:"next_offset,omitempty"`
+	NextCursor string `json:"next_cursor,omitempty"`
+	// Reranker names the reranker that ordered the results, if any
+	Reranker string `json:"reranker,omitempty"`
+	// Expansion records how the query was expanded, if it was
+	Expansion *QueryExpansion `json:"expansion,omitempty"`
+	// Explain is set for requests with explain
+	Explain *QueryExplanation `json:"explain,omitempty"`
+	// Graph is the knowledge graph traversed for requests with graph
+	Graph *KnowledgeGraph `json:"graph,omitempty"`
+}
+
+// QueryExplanation describes the effective settings of a query and the time
+// spent in each stage
+type QueryExplanation struct {
+	// Keywords are the query terms that results are checked for
+	Keywords      []string      `json:"keywords"`
+	Filters       *QueryFilters `json:"filters,omitempty"`
+	MaxDistance   float64       `json:"max_distance"`
+	MinScore      float64       `json:"min_score"`
+	VectorWeight  float64       `json:"vector_weight"`
+	KeywordWeight float64       `json:"keyword_weight"`
+	RRFK          int           `json:"rrf_k"`
+	Timings       []StageTiming `json:"timings"`
+}
+
+// StageTiming is the time spent in one stage of a query
+type StageTiming struct {
+	Stage      string  `json:"stage"`
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// ResultExplanation describes how a result was ranked. The vector and lexical
+// fields are unset when the chunk was not among that ranking's candidates. For
+// multi_query expansion they describe the first query that found the chunk.
+type ResultExplanation struct {
+	VectorDistance *float64 `json:"vector_distance,omitempty"` // cosine distance to the query embedding
+	VectorRank     *int     `json:"vector_rank,omitempty"`
+	LexicalScore   *float64 `json:"lexical_score,omitempty"` // full-text ts_rank_cd score
+	LexicalRank    *int     `json:"lexical_rank,omitempty"`
+	// FusionScore and FusionRank place the chunk in the reciprocal rank fusion of both rankings
+	FusionScore float64  `json:"fusion_score"`
+	FusionRank  int      `json:"fusion_rank"`
+	RerankScore *float64 `json:"rerank_score,omitempty"`
+	// GraphRank places the chunk in the ranking of chunks reached through the knowledge graph
+	GraphRank *int `json:"graph_rank,omitempty"`
+	// MatchedKeywords are the query keywords found in the chunk
+	MatchedKeywords []string `json:"matched_keywords"`
+}
+
+// QueryExpansion records the texts a query was expanded into
+type QueryExpansion struct {
+	Mode string `json:"mode"`
+	// Queries are the paraphrases searched alongside the original query
+	Queries []string `json:"queries,omitempty"`
+	// HypotheticalAnswer is the generated passage whose embedding replaced the query's
+	HypotheticalAnswer string `json:"hypothetical_answer,omitempty"`
 }
 
 // SearchResult represents a search result with comprehensive information
@@ -183,8 +356,212 @@ type SearchResult struct {
 	DocumentID   int      `json:"document_id"`
 	URL          string   `json:"url"`
 	Title        string   `json:"title"`
+	SectionPath  string   `json:"section_path,omitempty"`
 	Source       string   `json:"source,omitempty"`        // For backward compatibility
-	RelatedNodes []string `json:"related_nodes,omitempty"` // For backward compatibility
+	RelatedNodes []string `json:"related_nodes,omitempty"` // knowledge graph nodes of the document reached by graph queries
+	// ChunkID, ChunkIndex and the positions identify the best matching chunk
+	ChunkID       int `json:"chunk_id,omitempty"`
+	ChunkIndex    int `json:"chunk_index"`
+	StartPosition int `json:"start_position"`
+	EndPosition   int `json:"end_position"`
+	// Parent is set when Content holds the parent section of the matched chunks
+	Parent *ChunkPosition `json:"parent,omitempty"`
+	// Context is set when Content holds the neighboring chunks around the matched chunks
+	Context       *ContextWindow  `json:"context,omitempty"`
+	MatchedChunks []ChunkPosition `json:"matched_chunks,omitempty"`
+	// RetrievalScore and RerankScore are the scores before and after
+	// reranking; Score holds the rerank score when the results were reranked
+	RetrievalScore *float64 `json:"retrieval_score,omitempty"`
+	RerankScore    *float64 `json:"rerank_score,omitempty"`
+	// Explain is set for requests with explain
+	Explain *ResultExplanation `json:"explain,omitempty"`
+}
+
+// AnswerRequest represents a request to answer a question from the knowledge
+// base. The query options select the sources the answer is grounded in.
+type AnswerRequest struct {
+	QueryRequest
+	// Model overrides the configured chat completion model
+	Model string `json:"model,omitempty"`
+}
+
+// AnswerResponse represents a generated answer with its citations
+type AnswerResponse struct {
+	Query  string `json:"query"`
+	Answer string `json:"answer"`
+	Model  string `json:"model,omitempty"`
+	// Citations lists the sources referenced as [n] in the answer, by number
+	Citations []Citation `json:"citations"`
+}
+
+// Citation maps the number of a source cited in an answer to the document
+// text it was taken from
+type Citation struct {
+	Number     int    `json:"number"`
+	DocumentID int    `json:"document_id"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	ChunkID    int    `json:"chunk_id,omitempty"`
+	// StartPosition and EndPosition are the character offsets of the source in
+	// the document content, unlike the byte offsets of chunk positions
+	StartPosition int `json:"start_position"`
+	EndPosition   int `json:"end_position"`
+}
+
+// ChatSession represents a conversation with the knowledge base
+type ChatSession struct {
+	ID        int        `json:"id"`
+	Title     string     `json:"title"`
+	Turns     []ChatTurn `json:"turns,omitempty"`
+	CreatedAt time.Time  `json:"created_at"`
+	UpdatedAt time.Time  `json:"updated_at"`
+}
+
+// ChatTurn represents a question asked in a chat session and its answer
+type ChatTurn struct {
+	ID        int    `json:"id"`
+	SessionID int    `json:"session_id"`
+	Question  string `json:"question"`
+	// Query is the question rewritten to stand on its own, which was used for retrieval
+	Query     string     `json:"query"`
+	Answer    string     `json:"answer"`
+	Citations []Citation `json:"citations"`
+	CreatedAt time.Time  `json:"created_at"`
+}
+
+// CreateChatSessionRequest represents a request to start a chat session
+type CreateChatSessionRequest struct {
+	Title string `json:"title,omitempty"`
+}
+
+// MergeProposal proposes merging a knowledge node into another node that
+// names the same entity
+type MergeProposal struct {
+	ID         int    `json:"id"`
+	SourceID   int    `json:"source_id"`
+	SourceName string `json:"source_name"`
+	TargetID   int    `json:"target_id"`
+	TargetName string `json:"target_name"`
+	// Similarity is the cosine similarity of the node embeddings when they are close
+	Similarity *float64 `json:"similarity,omitempty"`
+	// Reasons are the rules that matched: normalized_name and embedding
+	Reasons   []string   `json:"reasons"`
+	Status    string     `json:"status"`
+	CreatedAt time.Time  `json:"created_at"`
+	DecidedAt *time.Time `json:"decided_at,omitempty"`
+}
+
+// EntityResolutionResult lists the merge proposals created by an entity resolution pass
+type EntityResolutionResult struct {
+	Proposals []MergeProposal `json:"proposals"`
+}
+
+// MergeNodesRequest represents a request to merge knowledge nodes into a target node
+type MergeNodesRequest struct {
+	TargetID  int   `json:"target_id"`
+	SourceIDs []int `json:"source_ids"`
+}
+
+// SplitNodeRequest represents a request to split a new node off a knowledge
+// node, taking over the mentions and edges of the given documents
+type SplitNodeRequest struct {
+	Name        string `json:"name"`
+	Type        string `json:"type,omitempty"`
+	DocumentIDs []int  `json:"document_ids,omitempty"`
+}
+
+// NeighborsRequest represents a request for the nodes adjacent to a knowledge
+// node. Direction is out, in or both; the type lists are optional filters.
+type NeighborsRequest struct {
+	NodeID            int      `json:"node_id"`
+	Direction         string   `json:"direction,omitempty"`
+	RelationshipTypes []string `json:"relationship_types,omitempty"`
+	NodeTypes         []string `json:"node_types,omitempty"`
+	Limit             int      `json:"limit,omitempty"`
+}
+
+// NodeNeighbor is a node adjacent to another node and the edge linking them
+type NodeNeighbor struct {
+	Node KnowledgeNodeResponse `json:"node"`
+	Edge KnowledgeEdgeResponse `json:"edge"`
+	// Direction is out when the edge leaves the requested node and in when it enters it
+	Direction string `json:"direction"`
+}
+
+// NeighborsResponse lists the neighbors of a knowledge node
+type NeighborsResponse struct {
+	Node      KnowledgeNodeResponse `json:"node"`
+	Neighbors []NodeNeighbor        `json:"neighbors"`
+}
+
+// SubgraphRequest represents a request for the nodes within a number of hops
+// of a seed node and the edges between them
+type SubgraphRequest struct {
+	NodeID            int      `json:"node_id"`
+	Hops              int      `json:"hops,omitempty"`
+	Direction         string   `json:"direction,omitempty"`
+	RelationshipTypes []string `json:"relationship_types,omitempty"`
+	MaxNodes          int      `json:"max_nodes,omitempty"`
+}
+
+// SubgraphNode is a node of a subgraph with its distance in hops from the seed
+type SubgraphNode struct {
+	KnowledgeNodeResponse
+	Hop int `json:"hop"`
+}
+
+// SubgraphResponse is the subgraph around a seed node, closest nodes first.
+// Truncated is set when more nodes were reachable than max_nodes.
+type SubgraphResponse struct {
+	SeedID    int                     `json:"seed_id"`
+	Hops      int                     `json:"hops"`
+	Nodes     []SubgraphNode          `json:"nodes"`
+	Edges     []KnowledgeEdgeResponse `json:"edges"`
+	Truncated bool                    `json:"truncated"`
+}
+
+// PathRequest represents a request for the shortest path between two knowledge nodes
+type PathRequest struct {
+	SourceID          int      `json:"source_id"`
+	TargetID          int      `json:"target_id"`
+	MaxHops           int      `json:"max_hops,omitempty"`
+	Direction         string   `json:"direction,omitempty"`
+	RelationshipTypes []string `json:"relationship_types,omitempty"`
+}
+
+// PathResponse is a shortest path between two knowledge nodes. Nodes run from
+// the source to the target and Edges[i] links Nodes[i] to Nodes[i+1].
+type PathResponse struct {
+	Found bool                    `json:"found"`
+	Hops  int                     `json:"hops"`
+	Nodes []KnowledgeNodeResponse `json:"nodes"`
+	Edges []KnowledgeEdgeResponse `json:"edges"`
+}
+
+// GraphExportRequest represents a request to export the knowledge graph. The
+// whole graph is exported unless a document or a node name query restricts it.
+type GraphExportRequest struct {
+	// Format is graphml, gexf, dot, jsonld or cypher
+	Format     string `json:"format"`
+	DocumentID *int   `json:"document_id,omitempty"`
+	Query      string `json:"query,omitempty"`
+}
+
+// ContextWindow describes the run of chunks stitched together for a result
+type ContextWindow struct {
+	FirstChunkIndex int `json:"first_chunk_index"`
+	LastChunkIndex  int `json:"last_chunk_index"`
+	StartPosition   int `json:"start_position"`
+	EndPosition     int `json:"end_position"`
+}
+
+// ChunkPosition identifies a chunk or parent section and its position in the document
+type ChunkPosition struct {
+	ID            int     `json:"id"`
+	ChunkIndex    int     `json:"chunk_index"`
+	StartPosition int     `json:"start_position"`
+	EndPosition   int     `json:"end_position"`
+	Score         float64 `json:"score,omitempty"`
 }
 
 // IngestRequest represents a request to ingest new data
@@ -1,13 +1,21 @@
-import React, { useState } from 'react';
+import React, { useEffect, useRef, useState } from 'react';
 import { MagnifyingGlassIcon, DocumentTextIcon, ShareIcon } from '@heroicons/react/24/outline';
-import apiService, { QueryResponse, KnowledgeGraphResponse } from '../services/api';
+import apiService, { QueryResponse, KnowledgeGraphResponse, Citation } from '../services/api';
 
 const Query: React.FC = () => {
   const [query, setQuery] = useState('');
   const [loading, setLoading] = useState(false);
   const [searchResults, setSearchResults] = useState<QueryResponse | null>(null);
   const [knowledgeGraph, setKnowledgeGraph] = useState<KnowledgeGraphResponse | null>(null);
-  const [activeTab, setActiveTab] = useState<'vector' | 'graph'>('vector');
+  const [activeTab, setActiveTab] = useState<'vector' | 'graph' | 'answer'>('vector');
+  const [answer, setAnswer] = useState<string | null>(null);
+  const [sources, setSources] = useState<Citation[]>([]);
+  const [citations, setCitations] = useState<Citation[]>([]);
+  const [answerError, setAnswerError] = useState<string | null>(null);
+  const answerAbort = useRef<AbortController | null>(null);
+
+  // Stop a running answer when leaving the page
+  useEffect(() => () => answerAbort.current?.abort(), []);
 
   const handleVectorSearch = async (e: React.FormEvent) => {
     e.preventDefault();
@@ -39,9 +47,45 @@ const Query: React.FC = () => {
     }
   };
 
+  const handleAnswer = async (e: React.FormEvent) => {
+    e.preventDefault();
+    if (!query.trim()) return;
+
+    answerAbort.current?.abort();
+    const controller = new AbortController();
+    answerAbort.current = controller;
+
+    setLoading(true);
+    setAnswer('');
+    setSources([]);
+    setCitations([]);
+    setAnswerError(null);
+    try {
+      await apiService.streamAnswer(
+        { query: query.trim() },
+        {
+          onSources: setSources,
+          onDelta: (content) => setAnswer((previous) => (previous || '') + content),
+          onCitations: (response) => setCitations(response.citations),
+          onError: setAnswerError,
+        },
+        controller.signal
+      );
+    } catch (error) {
+      if (!controller.signal.aborted) {
+        console.error('Failed to generate answer:', error);
+        setAnswerError(String(error));
+      }
+    } finally {
+      setLoading(false);
+    }
+  };
+
   const handleSearch = (e: React.FormEvent) => {
     if (activeTab === 'vector') {
       handleVectorSearch(e);
+    } else if (activeTab === 'answer') {
+      handleAnswer(e);
     } else {
       handleKnowledgeGraphSearch(e);
     }
@@ -122,6 +166,16 @@ const Query: React.FC = () => {
           >
             Knowledge Graph
           </button>
+          <button
+            onClick={() => setActiveTab('answer')}
+            className={`py-2 px-1 border-b-2 font-medium text-sm ${
+              activeTab === 'answer'
+                ? 'border-indigo-500 text-indigo-600'
+                : 'border-transparent text-gray-500 hover:text-gray-700 hover:border-gray-300'
+            }`}
+          >
+            Answer
+          </button>
         </nav>
       </div>
 
@@ -274,8 +328,43 @@ const Query: React.FC = () => {
         </div>
       )}
 
+      {activeTab === 'answer' && answer !== null && (
+        <div className="bg-white shadow overflow-hidden sm:rounded-md">
+          <div className="px-4 py-5 sm:px-6">
+            <h3 className="text-lg leading-6 font-medium text-gray-900">Answer</h3>
+            <p className="mt-1 max-w-2xl text-sm text-gray-500">
+              Grounded in {sources.length} sources
+            </p>
+          </div>
+          <div className="border-t border-gray-200 px-4 py-4 space-y-4">
+            <p className="text-sm text-gray-900 whitespace-pre-wrap">
+              {answer}
+              {loading && <span className="animate-pulse">▍</span>}
+            </p>
+            {answerError && <p className="text-sm text-red-600">{answerError}</p>}
+            {(citations.length > 0 ? citations : sources).length > 0 && (
+              <div>
+                <h4 className="text-md font-medium text-gray-900 mb-2">
+                  {citations.length > 0 ? 'Citations' : 'Sources'}
+                </h4>
+                <ol className="space-y-1">
+                  {(citations.length > 0 ? citations : sources).map((citation) => (
+                    <li key={citation.number} className="text-xs text-gray-500">
+                      <span className="font-medium text-gray-900">[{citation.number}]</span>{' '}
+                      {citation.title || 'No Title'} — Doc ID: {citation.document_id}, characters{' '}
+                      {citation.start_position}–{citation.end_position}
+                      <div className="text-gray-400 truncate">{citation.url}</div>
+                    </li>
+                  ))}
+                </ol>
+              </div>
+            )}
+          </div>
+        </div>
+      )}
+
       {/* No Results State */}
-      {!loading && !searchResults && !knowledgeGraph && (
+      {!loading && !searchResults && !knowledgeGraph && answer === null && (
         <div className="text-center py-12">
           <ShareIcon className="mx-auto h-12 w-12 text-gray-400" />
           <h3 className="mt-2 text-sm font-medium text-gray-900">No search performed</h3>
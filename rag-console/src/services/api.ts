@@ -29,6 +29,30 @@ export interface QueryResponse {
   }>;
 }
 
+export interface Citation {
+  number: number;
+  document_id: number;
+  url: string;
+  title: string;
+  chunk_id?: number;
+  start_position: number;
+  end_position: number;
+}
+
+export interface AnswerResponse {
+  query: string;
+  answer: string;
+  model?: string;
+  citations: Citation[];
+}
+
+export interface AnswerStreamHandlers {
+  onSources?: (sources: Citation[]) => void;
+  onDelta?: (content: string) => void;
+  onCitations?: (answer: AnswerResponse) => void;
+  onError?: (message: string) => void;
+}
+
 export interface KnowledgeGraphResponse {
   nodes: Array<{
     id: number;
@@ -72,6 +96,46 @@ export const apiService = {
     return response.data;
   },
 
+  // Streamed answer over Server-Sent Events; abort the signal to stop generation
+  streamAnswer: async (data: QueryRequest, handlers: AnswerStreamHandlers, signal?: AbortSignal) => {
+    const response = await fetch(`${API_BASE_URL}/answer/stream`, {
+      method: 'POST',
+      headers: { 'Content-Type': 'application/json' },
+      body: JSON.stringify(data),
+      signal,
+    });
+    if (!response.ok || !response.body) {
+      throw new Error(await response.text());
+    }
+
+    const reader = response.body.getReader();
+    const decoder = new TextDecoder();
+    let buffer = '';
+    for (;;) {
+      const { done, value } = await reader.read();
+      if (done) break;
+      buffer += decoder.decode(value, { stream: true });
+
+      let boundary;
+      while ((boundary = buffer.indexOf('\n\n')) >= 0) {
+        const message = buffer.slice(0, boundary);
+        buffer = buffer.slice(boundary + 2);
+
+        let event = 'message';
+        let payload = '';
+        for (const line of message.split('\n')) {
+          if (line.startsWith('event: ')) event = line.slice(7);
+          if (line.startsWith('data: ')) payload += line.slice(6);
+        }
+        const parsed = payload ? JSON.parse(payload) : {};
+        if (event === 'sources') handlers.onSources?.(parsed.sources);
+        if (event === 'delta') handlers.onDelta?.(parsed.content);
+        if (event === 'citations') handlers.onCitations?.(parsed);
+        if (event === 'error') handlers.onError?.(parsed.error);
+      }
+    }
+  },
+
   // Knowledge graph
   getKnowledgeGraph: async (query: string): Promise<KnowledgeGraphResponse> => {
     const response = await api.get(`/graph?query=${encodeURIComponent(query)}`);
@@ -0,0 +1,351 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// answerSystemPrompt instructs the model to answer from the numbered sources only
+const answerSystemPrompt = `You answer questions using only the numbered sources provided by the user.
+Cite the sources that support each statement with their number in square brackets, such as [1] or [2][3].
+If the sources do not contain the answer, say that you do not know instead of guessing.`
+
+// noSourcesAnswer is returned without calling the model when nothing relevant was retrieved
+const noSourcesAnswer = "I could not find any relevant information in the knowledge base to answer this question."
+
+// answerSource is a search result numbered for citation in a prompt
+type answerSource struct {
+	number  int
+	result  models.SearchResult
+	content string // the content shown to the model, possibly truncated
+	// start and end are the span of content in the document, as byte offsets
+	// until characterSpans converts them to character offsets
+	start, end int
+}
+
+// citationPattern matches citations such as [1] and [2, 3]
+var citationPattern = regexp.MustCompile(`\[(\d+(?:\s*,\s*\d+)*)\]`)
+
+// Answer retrieves sources for the question with the query options of the
+// request and generates an answer grounded in them, citing them by number.
+// Invalid query options are reported as ErrInvalidQuery.
+func (s *RAGService) Answer(ctx context.Context, req *models.AnswerRequest) (*models.AnswerResponse, error) {
+	sources, err := s.retrieveAnswerSources(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.generateAnswer(ctx, req.Query, s.answerModel(req), sources)
+}
+
+// retrieveAnswerSources runs the query of an answer request and numbers the
+// results that fit in the prompt
+func (s *RAGService) retrieveAnswerSources(ctx context.Context, req *models.AnswerRequest) ([]answerSource, error) {
+	resp, err := s.QueryWithOptions(ctx, &req.QueryRequest)
+	if err != nil {
+		return nil, err
+	}
+	sources := selectAnswerSources(resp.Results, s.answer.MaxContextTokens)
+	if err := s.characterSpans(ctx, sources); err != nil {
+		return nil, err
+	}
+	return sources, nil
+}
+
+// characterSpans converts the spans of the sources from byte offsets, which
+// positions are stored as, to character offsets in the document content
+func (s *RAGService) characterSpans(ctx context.Context, sources []answerSource) error {
+	if len(sources) == 0 {
+		return nil
+	}
+	documentIDs := make([]int, len(sources))
+	starts := make([]int, len(sources))
+	ends := make([]int, len(sources))
+	for i, source := range sources {
+		documentIDs[i] = source.result.DocumentID
+		starts[i] = source.start
+		ends[i] = source.end
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT s.n,
+			char_length(convert_from(substring(convert_to(d.content, 'UTF8') FROM 1 FOR s.start_byte), 'UTF8')),
+			char_length(convert_from(substring(convert_to(d.content, 'UTF8') FROM 1 FOR s.end_byte), 'UTF8'))
+		FROM unnest($1::integer[], $2::integer[], $3::integer[]) WITH ORDINALITY AS s(document_id, start_byte, end_byte, n)
+		JOIN documents d ON d.id = s.document_id
+	`, pq.Array(documentIDs), pq.Array(starts), pq.Array(ends))
+	if err != nil {
+		return fmt.Errorf("failed to convert source positions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var n, start, end int
+		if err := rows.Scan(&n, &start, &end); err != nil {
+			return fmt.Errorf("failed to scan source positions: %w", err)
+		}
+		sources[n-1].start, sources[n-1].end = start, end
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("error iterating source positions: %w", err)
+	}
+	return nil
+}
+
+// answerModel returns the chat completion model of an answer request
+func (s *RAGService) answerModel(req *models.AnswerRequest) string {
+	if req.Model != "" {
+		return req.Model
+	}
+	return s.answer.Model
+}
+
+// generateAnswer asks the chat model to answer the question from the sources
+func (s *RAGService) generateAnswer(ctx context.Context, question, model string, sources []answerSource) (*models.AnswerResponse, error) {
+	resp := &models.AnswerResponse{
+		Query:     question,
+		Model:     model,
+		Citations: []models.Citation{},
+	}
+	if len(sources) == 0 {
+		resp.Answer = noSourcesAnswer
+		resp.Model = ""
+		return resp, nil
+	}
+
+	completion, err := s.openaiClient.CreateChatCompletion(ctx, s.answerCompletionRequest(question, model, sources))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+	if len(completion.Choices) == 0 {
+		return nil, fmt.Errorf("failed to generate answer: no choices returned")
+	}
+
+	resp.Answer = completion.Choices[0].Message.Content
+	resp.Citations = citationsFor(resp.Answer, sources)
+	return resp, nil
+}
+
+// AnswerStreamHandler receives the parts of a streamed answer as they become available
+type AnswerStreamHandler struct {
+	// Sources is called once with the numbered sources before generation starts
+	Sources func(sources []models.Citation) error
+	// Delta is called with each piece of answer text
+	Delta func(content string) error
+}
+
+// StreamAnswer works like Answer but streams the sources and the answer text
+// to the handler as they are produced. Cancelling ctx stops the generation.
+// The complete answer is returned once the model is done.
+func (s *RAGService) StreamAnswer(ctx context.Context, req *models.AnswerRequest, handler AnswerStreamHandler) (*models.AnswerResponse, error) {
+	sources, err := s.retrieveAnswerSources(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	return s.streamGeneratedAnswer(ctx, req.Query, s.answerModel(req), sources, handler)
+}
+
+// streamGeneratedAnswer passes the sources to the handler and streams the
+// answer generated from them
+func (s *RAGService) streamGeneratedAnswer(ctx context.Context, question, model string, sources []answerSource, handler AnswerStreamHandler) (*models.AnswerResponse, error) {
+	listed := make([]models.Citation, len(sources))
+	for i, source := range sources {
+		listed[i] = sourceCitation(source)
+	}
+	if err := handler.Sources(listed); err != nil {
+		return nil, err
+	}
+
+	if len(sources) == 0 {
+		resp, err := s.generateAnswer(ctx, question, model, nil)
+		if err != nil {
+			return nil, err
+		}
+		if err := handler.Delta(resp.Answer); err != nil {
+			return nil, err
+		}
+		return resp, nil
+	}
+
+	stream, err := s.openaiClient.CreateChatCompletionStream(ctx, s.answerCompletionRequest(question, model, sources))
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate answer: %w", err)
+	}
+	defer stream.Close()
+
+	var answer strings.Builder
+	for {
+		chunk, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate answer: %w", err)
+		}
+		if len(chunk.Choices) == 0 || chunk.Choices[0].Delta.Content == "" {
+			continue
+		}
+
+		delta := chunk.Choices[0].Delta.Content
+		answer.WriteString(delta)
+		if err := handler.Delta(delta); err != nil {
+			return nil, err
+		}
+	}
+
+	return &models.AnswerResponse{
+		Query:     question,
+		Answer:    answer.String(),
+		Model:     model,
+		Citations: citationsFor(answer.String(), sources),
+	}, nil
+}
+
+// answerCompletionRequest builds the chat completion request of an answer
+func (s *RAGService) answerCompletionRequest(question, model string, sources []answerSource) openai.ChatCompletionRequest {
+	return openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: answerSystemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: answerPrompt(question, sources)},
+		},
+		MaxTokens:   s.answer.MaxTokens,
+		Temperature: 0,
+	}
+}
+
+// selectAnswerSources numbers results in rank order until their content
+// reaches maxTokens estimated tokens. The first result is always included,
+// truncated if it does not fit on its own.
+func selectAnswerSources(results []models.SearchResult, maxTokens int) []answerSource {
+	var sources []answerSource
+	remaining := maxTokens
+	for _, result := range results {
+		content := result.Content
+		tokens := estimateTokens(content)
+		if tokens > remaining {
+			if len(sources) > 0 {
+				break
+			}
+			content = truncateRunes(content, remaining*4)
+			tokens = remaining
+		}
+		remaining -= tokens
+
+		start, end := resultSpan(result)
+		if len(content) < len(result.Content) {
+			// Only the start of a truncated source is shown; being a byte
+			// prefix of the content, its length is a byte offset too
+			end = start + len(content)
+		}
+		sources = append(sources, answerSource{
+			number:  len(sources) + 1,
+			result:  result,
+			content: content,
+			start:   start,
+			end:     end,
+		})
+	}
+	return sources
+}
+
+// truncateRunes returns the first n runes of s, cut at a rune boundary so the
+// result is always a byte prefix of s
+func truncateRunes(s string, n int) string {
+	for i := range s {
+		if n == 0 {
+			return s[:i]
+		}
+		n--
+	}
+	return s
+}
+
+// answerPrompt lists the numbered sources followed by the question
+func answerPrompt(question string, sources []answerSource) string {
+	var b strings.Builder
+	b.WriteString("Sources:\n\n")
+	for _, source := range sources {
+		fmt.Fprintf(&b, "[%d] %s", source.number, source.result.Title)
+		if source.result.URL != "" {
+			fmt.Fprintf(&b, " (%s)", source.result.URL)
+		}
+		if source.result.SectionPath != "" {
+			fmt.Fprintf(&b, "\nSection: %s", source.result.SectionPath)
+		}
+		fmt.Fprintf(&b, "\n%s\n\n", source.content)
+	}
+	fmt.Fprintf(&b, "Question: %s", question)
+	return b.String()
+}
+
+// citationsFor returns the citations of the sources referenced in an answer,
+// ordered by number. References to unknown sources are ignored.
+func citationsFor(answer string, sources []answerSource) []models.Citation {
+	byNumber := make(map[int]answerSource, len(sources))
+	for _, source := range sources {
+		byNumber[source.number] = source
+	}
+
+	cited := make(map[int]bool)
+	for _, match := range citationPattern.FindAllStringSubmatch(answer, -1) {
+		for _, number := range strings.Split(match[1], ",") {
+			n, err := strconv.Atoi(strings.TrimSpace(number))
+			if err != nil {
+				continue
+			}
+			if _, ok := byNumber[n]; ok {
+				cited[n] = true
+			}
+		}
+	}
+
+	numbers := make([]int, 0, len(cited))
+	for n := range cited {
+		numbers = append(numbers, n)
+	}
+	sort.Ints(numbers)
+
+	citations := make([]models.Citation, 0, len(numbers))
+	for _, n := range numbers {
+		citations = append(citations, sourceCitation(byNumber[n]))
+	}
+	return citations
+}
+
+// sourceCitation describes the document text of a source
+func sourceCitation(source answerSource) models.Citation {
+	r := source.result
+	return models.Citation{
+		Number:        source.number,
+		DocumentID:    r.DocumentID,
+		URL:           r.URL,
+		Title:         r.Title,
+		ChunkID:       r.ChunkID,
+		StartPosition: source.start,
+		EndPosition:   source.end,
+	}
+}
+
+// resultSpan returns the span of the document content held by a result,
+// which covers its context window or parent section when those were returned
+func resultSpan(r models.SearchResult) (int, int) {
+	switch {
+	case r.Context != nil:
+		return r.Context.StartPosition, r.Context.EndPosition
+	case r.Parent != nil:
+		return r.Parent.StartPosition, r.Parent.EndPosition
+	default:
+		return r.StartPosition, r.EndPosition
+	}
+}
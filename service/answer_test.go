@@ -0,0 +1,176 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rag-data-service/models"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSelectAnswerSources(t *testing.T) {
+	results := []models.SearchResult{
+		{Content: strings.Repeat("a", 40)}, // 10 tokens
+		{Content: strings.Repeat("b", 40)},
+		{Content: strings.Repeat("c", 40)},
+	}
+
+	sources := selectAnswerSources(results, 25)
+	require.Len(t, sources, 2)
+	assert.Equal(t, 1, sources[0].number)
+	assert.Equal(t, 2, sources[1].number)
+
+	// The first result is truncated rather than dropped
+	sources = selectAnswerSources(results, 5)
+	require.Len(t, sources, 1)
+	assert.Equal(t, strings.Repeat("a", 20), sources[0].content)
+
+	assert.Empty(t, selectAnswerSources(nil, 100))
+}
+
+func TestCitationsFor(t *testing.T) {
+	sources := selectAnswerSources([]models.SearchResult{
+		{DocumentID: 1, URL: "https://example.com/a", Content: "alpha", StartPosition: 10, EndPosition: 15},
+		{DocumentID: 2, URL: "https://example.com/b", Content: "beta", Context: &models.ContextWindow{StartPosition: 100, EndPosition: 180}},
+		{DocumentID: 3, Content: "gamma"},
+	}, 100)
+
+	citations := citationsFor("Alpha holds [2, 1]. Beta as well [2][7].", sources)
+	require.Len(t, citations, 2)
+
+	assert.Equal(t, models.Citation{Number: 1, DocumentID: 1, URL: "https://example.com/a", StartPosition: 10, EndPosition: 15}, citations[0])
+	// The span of a context window covers the whole window
+	assert.Equal(t, 2, citations[1].Number)
+	assert.Equal(t, 100, citations[1].StartPosition)
+	assert.Equal(t, 180, citations[1].EndPosition)
+
+	assert.Empty(t, citationsFor("No citations here.", sources))
+
+	// A truncated source is cited up to the byte offset it was cut at
+	sources = selectAnswerSources([]models.SearchResult{
+		{DocumentID: 4, Content: strings.Repeat("é", 40), StartPosition: 10, EndPosition: 90},
+	}, 5)
+	require.Len(t, sources, 1)
+	assert.Equal(t, strings.Repeat("é", 20), sources[0].content)
+	citations = citationsFor("Accents [1].", sources)
+	require.Len(t, citations, 1)
+	assert.Equal(t, 50, citations[0].EndPosition)
+}
+
+func TestAnswerPrompt(t *testing.T) {
+	prompt := answerPrompt("How do I install it?", []answerSource{
+		{number: 1, result: models.SearchResult{Title: "Guide", URL: "https://example.com/guide", SectionPath: "Install > Linux"}, content: "Run the installer."},
+	})
+
+	assert.Contains(t, prompt, "[1] Guide (https://example.com/guide)\nSection: Install > Linux\nRun the installer.")
+	assert.True(t, strings.HasSuffix(prompt, "Question: How do I install it?"))
+}
+
+func TestGenerateAnswer(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"role": "assistant", "content": "Run the installer [1]."}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+	sources := selectAnswerSources([]models.SearchResult{
+		{DocumentID: 4, URL: "https://example.com/guide", Content: "Run the installer.", StartPosition: 0, EndPosition: 18},
+	}, 100)
+
+	resp, err := s.generateAnswer(context.Background(), "How do I install it?", "gpt-4o-mini", sources)
+	require.NoError(t, err)
+
+	assert.Equal(t, "gpt-4o-mini", received.Model)
+	require.Len(t, received.Messages, 2)
+	assert.Contains(t, received.Messages[1].Content, "Run the installer.")
+
+	assert.Equal(t, "Run the installer [1].", resp.Answer)
+	require.Len(t, resp.Citations, 1)
+	assert.Equal(t, 4, resp.Citations[0].DocumentID)
+	assert.Equal(t, 18, resp.Citations[0].EndPosition)
+}
+
+func TestGenerateAnswer_NoSources(t *testing.T) {
+	s := NewRAGService(nil, "test", "http://127.0.0.1:0", "")
+
+	resp, err := s.generateAnswer(context.Background(), "anything", "gpt-4o-mini", nil)
+	require.NoError(t, err)
+	assert.Equal(t, noSourcesAnswer, resp.Answer)
+	assert.Empty(t, resp.Citations)
+}
+
+func TestStreamGeneratedAnswer(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for _, delta := range []string{"Run the ", "installer [1]."} {
+			chunk, _ := json.Marshal(map[string]interface{}{
+				"choices": []map[string]interface{}{{"index": 0, "delta": map[string]string{"content": delta}}},
+			})
+			fmt.Fprintf(w, "data: %s\n\n", chunk)
+		}
+		fmt.Fprint(w, "data: [DONE]\n\n")
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+	sources := selectAnswerSources([]models.SearchResult{
+		{DocumentID: 4, URL: "https://example.com/guide", Content: "Run the installer.", EndPosition: 18},
+	}, 100)
+
+	var events []string
+	resp, err := s.streamGeneratedAnswer(context.Background(), "How do I install it?", "gpt-4o-mini", sources, AnswerStreamHandler{
+		Sources: func(sources []models.Citation) error {
+			events = append(events, fmt.Sprintf("sources:%d", len(sources)))
+			return nil
+		},
+		Delta: func(content string) error {
+			events = append(events, "delta:"+content)
+			return nil
+		},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{"sources:1", "delta:Run the ", "delta:installer [1]."}, events)
+	assert.Equal(t, "Run the installer [1].", resp.Answer)
+	require.Len(t, resp.Citations, 1)
+	assert.Equal(t, 4, resp.Citations[0].DocumentID)
+}
+
+func TestStreamGeneratedAnswer_Cancelled(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		fmt.Fprint(w, `data: {"choices": [{"index": 0, "delta": {"content": "Run"}}]}`+"\n\n")
+		w.(http.Flusher).Flush()
+		// Hold the stream open until the client goes away
+		<-r.Context().Done()
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+	sources := selectAnswerSources([]models.SearchResult{{Content: "Run the installer."}}, 100)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	_, err := s.streamGeneratedAnswer(ctx, "q", "gpt-4o-mini", sources, AnswerStreamHandler{
+		Sources: func([]models.Citation) error { return nil },
+		Delta: func(string) error {
+			// The client disconnects after the first token
+			cancel()
+			return nil
+		},
+	})
+	assert.Error(t, err)
+}
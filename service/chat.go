@@ -0,0 +1,237 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"rag-data-service/models"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// ErrChatSessionNotFound is returned for chat session IDs that do not exist
+var ErrChatSessionNotFound = errors.New("chat session not found")
+
+// maxChatTitleRunes bounds the title a session takes from its first question
+const maxChatTitleRunes = 80
+
+// rewriteSystemPrompt instructs the model to turn a follow-up into a standalone question
+const rewriteSystemPrompt = `You rewrite the latest question of a conversation into a standalone search query.
+Resolve pronouns and references such as "it", "they" or "that approach" using the earlier turns, and keep every detail of the question.
+If the question already stands on its own, return it unchanged.
+Reply with only the rewritten question.`
+
+// CreateChatSession starts a new chat session
+func (s *RAGService) CreateChatSession(ctx context.Context, title string) (*models.ChatSession, error) {
+	var session models.ChatSession
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO chat_sessions (title)
+		VALUES ($1)
+		RETURNING id, title, created_at, updated_at
+	`, title).Scan(&session.ID, &session.Title, &session.CreatedAt, &session.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create chat session: %w", err)
+	}
+	return &session, nil
+}
+
+// GetChatSession retrieves a chat session with its turns in order
+func (s *RAGService) GetChatSession(ctx context.Context, id int) (*models.ChatSession, error) {
+	var session models.ChatSession
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, title, created_at, updated_at
+		FROM chat_sessions
+		WHERE id = $1
+	`, id).Scan(&session.ID, &session.Title, &session.CreatedAt, &session.UpdatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrChatSessionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat session: %w", err)
+	}
+
+	session.Turns, err = s.chatTurns(ctx, id, 0)
+	if err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+// DeleteChatSession removes a chat session and its turns
+func (s *RAGService) DeleteChatSession(ctx context.Context, id int) error {
+	result, err := s.db.ExecContext(ctx, `DELETE FROM chat_sessions WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete chat session: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		return ErrChatSessionNotFound
+	}
+	return nil
+}
+
+// Chat answers the next question of a chat session. The question is first
+// rewritten into a standalone query using the earlier turns of the session,
+// the answer is generated from the sources retrieved for that query, and the
+// turn is stored with the session.
+func (s *RAGService) Chat(ctx context.Context, sessionID int, req *models.AnswerRequest) (*models.ChatTurn, error) {
+	var exists bool
+	err := s.db.QueryRowContext(ctx, `SELECT EXISTS(SELECT 1 FROM chat_sessions WHERE id = $1)`, sessionID).Scan(&exists)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get chat session: %w", err)
+	}
+	if !exists {
+		return nil, ErrChatSessionNotFound
+	}
+
+	// A history of zero turns disables rewriting
+	var history []models.ChatTurn
+	if s.chat.HistoryTurns > 0 {
+		history, err = s.chatTurns(ctx, sessionID, s.chat.HistoryTurns)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	question := req.Query
+	query := question
+	if len(history) > 0 {
+		rewritten, err := s.rewriteQuery(ctx, history, question)
+		if err != nil {
+			log.Printf("Warning: failed to rewrite chat question, using it as is: %v", err)
+		} else {
+			query = rewritten
+		}
+	}
+
+	// Retrieval and generation use the standalone query with the options of the request
+	answerReq := *req
+	answerReq.Query = query
+	answer, err := s.Answer(ctx, &answerReq)
+	if err != nil {
+		return nil, err
+	}
+
+	citations, err := json.Marshal(answer.Citations)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal citations: %w", err)
+	}
+
+	turn := &models.ChatTurn{
+		SessionID: sessionID,
+		Question:  question,
+		Query:     query,
+		Answer:    answer.Answer,
+		Citations: answer.Citations,
+	}
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO chat_turns (session_id, question, query, answer, citations)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at
+	`, sessionID, question, query, answer.Answer, citations).Scan(&turn.ID, &turn.CreatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to store chat turn: %w", err)
+	}
+
+	// Untitled sessions are named after their first question
+	_, err = s.db.ExecContext(ctx, `
+		UPDATE chat_sessions
+		SET title = CASE WHEN title = '' THEN $2 ELSE title END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+	`, sessionID, truncateRunes(question, maxChatTitleRunes))
+	if err != nil {
+		log.Printf("Warning: failed to update chat session %d: %v", sessionID, err)
+	}
+
+	return turn, nil
+}
+
+// chatTurns returns the turns of a session in order. A positive limit
+// returns only the most recent turns.
+func (s *RAGService) chatTurns(ctx context.Context, sessionID, limit int) ([]models.ChatTurn, error) {
+	var limitArg interface{}
+	if limit > 0 {
+		limitArg = limit
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, session_id, question, query, answer, citations, created_at
+		FROM (
+			SELECT * FROM chat_turns
+			WHERE session_id = $1
+			ORDER BY id DESC
+			LIMIT $2
+		) recent
+		ORDER BY id
+	`, sessionID, limitArg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chat turns: %w", err)
+	}
+	defer rows.Close()
+
+	var turns []models.ChatTurn
+	for rows.Next() {
+		var turn models.ChatTurn
+		var citations []byte
+		if err := rows.Scan(&turn.ID, &turn.SessionID, &turn.Question, &turn.Query, &turn.Answer, &citations, &turn.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan chat turn: %w", err)
+		}
+		if err := json.Unmarshal(citations, &turn.Citations); err != nil {
+			return nil, fmt.Errorf("failed to unmarshal citations: %w", err)
+		}
+		turns = append(turns, turn)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chat turn rows: %w", err)
+	}
+
+	return turns, nil
+}
+
+// rewriteQuery asks the chat model to rewrite a follow-up question into a
+// standalone question using the earlier turns
+func (s *RAGService) rewriteQuery(ctx context.Context, history []models.ChatTurn, question string) (string, error) {
+	model := s.chat.RewriteModel
+	if model == "" {
+		model = s.answer.Model
+	}
+
+	resp, err := s.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: rewriteSystemPrompt},
+			{Role: openai.ChatMessageRoleUser, Content: rewritePrompt(history, question)},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to call chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	rewritten := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if rewritten == "" {
+		return "", fmt.Errorf("empty rewritten question")
+	}
+	return rewritten, nil
+}
+
+// rewritePrompt lists the earlier turns followed by the question to rewrite.
+// Answers are shortened, since only what they refer to matters.
+func rewritePrompt(history []models.ChatTurn, question string) string {
+	var b strings.Builder
+	b.WriteString("Conversation:\n")
+	for _, turn := range history {
+		fmt.Fprintf(&b, "User: %s\nAssistant: %s\n", turn.Question, truncateRunes(turn.Answer, 500))
+	}
+	fmt.Fprintf(&b, "\nLatest question: %s", question)
+	return b.String()
+}
@@ -0,0 +1,59 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"rag-data-service/models"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRewritePrompt(t *testing.T) {
+	prompt := rewritePrompt([]models.ChatTurn{
+		{Question: "How do I install the CLI?", Answer: "Run the installer [1]."},
+		{Question: "Does it need admin rights?", Answer: strings.Repeat("x", 600)},
+	}, "And on Windows?")
+
+	assert.Contains(t, prompt, "User: How do I install the CLI?\nAssistant: Run the installer [1].\n")
+	// Long answers are shortened
+	assert.Contains(t, prompt, "Assistant: "+strings.Repeat("x", 500)+"\n")
+	assert.NotContains(t, prompt, strings.Repeat("x", 501))
+	assert.True(t, strings.HasSuffix(prompt, "Latest question: And on Windows?"))
+}
+
+func TestRewriteQuery(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"role": "assistant", "content": " How do I install the CLI on Windows?\n"}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+	history := []models.ChatTurn{{Question: "How do I install the CLI?", Answer: "Run the installer [1]."}}
+
+	rewritten, err := s.rewriteQuery(context.Background(), history, "And on Windows?")
+	require.NoError(t, err)
+	assert.Equal(t, "How do I install the CLI on Windows?", rewritten)
+
+	// Without a rewrite model the answer model is used
+	assert.Equal(t, s.answer.Model, received.Model)
+	require.Len(t, received.Messages, 2)
+	assert.Contains(t, received.Messages[1].Content, "How do I install the CLI?")
+
+	s.chat.RewriteModel = "gpt-4o"
+	_, err = s.rewriteQuery(context.Background(), history, "And on Windows?")
+	require.NoError(t, err)
+	assert.Equal(t, "gpt-4o", received.Model)
+}
@@ -0,0 +1,410 @@
+package service
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Chunking strategies
+const (
+	ChunkStrategySentence    = "sentence"
+	ChunkStrategyTokenWindow = "token_window"
+	ChunkStrategyRecursive   = "recursive"
+	ChunkStrategyMarkdown    = "markdown"
+)
+
+// Chunker defines the interface for splitting document content into chunks.
+// Chunk sizes are measured in estimated tokens (see estimateTokens) and
+// chunk positions are byte offsets into the content.
+type Chunker interface {
+	Chunk(content string) []ChunkInfo
+}
+
+// NewChunker creates a chunker for the given strategy. size is the maximum
+// number of tokens per chunk and overlap the number of tokens repeated from
+// the end of one chunk at the start of the next.
+func NewChunker(strategy string, size, overlap int) (Chunker, error) {
+	if size <= 0 {
+		return nil, fmt.Errorf("chunk size must be positive")
+	}
+	if overlap < 0 || overlap >= size {
+		return nil, fmt.Errorf("chunk overlap must be between 0 and the chunk size")
+	}
+
+	switch strategy {
+	case ChunkStrategySentence:
+		return &SentenceChunker{Size: size, Overlap: overlap}, nil
+	case ChunkStrategyTokenWindow:
+		return &TokenWindowChunker{Size: size, Overlap: overlap}, nil
+	case ChunkStrategyRecursive:
+		return &RecursiveChunker{Size: size, Overlap: overlap}, nil
+	case ChunkStrategyMarkdown:
+		return &MarkdownChunker{Size: size, Overlap: overlap}, nil
+	default:
+		return nil, fmt.Errorf("unknown chunk strategy: %s", strategy)
+	}
+}
+
+// span is a half-open byte range of the content being chunked
+type span struct {
+	start int
+	end   int
+}
+
+// spansToChunks trims whitespace from each span and converts the non-empty
+// ones into chunks whose content is the exact text at their position
+func spansToChunks(content string, spans []span) []ChunkInfo {
+	chunks := make([]ChunkInfo, 0, len(spans))
+	for _, sp := range spans {
+		sp = trimSpan(content, sp)
+		if sp.start >= sp.end {
+			continue
+		}
+		chunks = append(chunks, ChunkInfo{
+			Content:       content[sp.start:sp.end],
+			ChunkIndex:    len(chunks),
+			StartPosition: sp.start,
+			EndPosition:   sp.end,
+		})
+	}
+	return chunks
+}
+
+// trimSpan shrinks a span so that it neither starts nor ends with whitespace
+func trimSpan(content string, sp span) span {
+	for sp.start < sp.end {
+		r, size := utf8.DecodeRuneInString(content[sp.start:sp.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		sp.start += size
+	}
+	for sp.end > sp.start {
+		r, size := utf8.DecodeLastRuneInString(content[sp.start:sp.end])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		sp.end -= size
+	}
+	return sp
+}
+
+// mergeSpans greedily joins consecutive spans into chunks of at most size
+// tokens. When a chunk is full, the next one starts with the trailing spans of
+// the previous chunk that fit within overlap tokens. Spans larger than size
+// on their own become a chunk by themselves.
+func mergeSpans(content string, spans []span, size, overlap int) []span {
+	// regionTokens measures the merged text, including the gaps between spans
+	regionTokens := func(from, to span) int {
+		return estimateTokens(content[from.start:to.end])
+	}
+
+	var merged []span
+	var current []span
+
+	for _, sp := range spans {
+		if len(current) > 0 && regionTokens(current[0], sp) > size {
+			merged = append(merged, span{start: current[0].start, end: current[len(current)-1].end})
+
+			// Carry the trailing spans into the next chunk as overlap
+			first := len(current)
+			for i := len(current) - 1; i > 0; i-- {
+				if regionTokens(current[i], current[len(current)-1]) > overlap || regionTokens(current[i], sp) > size {
+					break
+				}
+				first = i
+			}
+			current = append([]span(nil), current[first:]...)
+		}
+		current = append(current, sp)
+	}
+	if len(current) > 0 {
+		merged = append(merged, span{start: current[0].start, end: current[len(current)-1].end})
+	}
+
+	return merged
+}
+
+// SentenceChunker packs whole sentences into chunks. Sentence boundaries are
+// detected without breaking on decimals, URLs, initials or common abbreviations.
+type SentenceChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk splits content into sentence-aligned chunks
+func (c *SentenceChunker) Chunk(content string) []ChunkInfo {
+	var spans []span
+	for _, sentence := range splitSentences(content) {
+		if estimateTokens(content[sentence.start:sentence.end]) > c.Size {
+			// A single sentence longer than a chunk falls back to a token window
+			spans = append(spans, tokenWindowSpans(content, sentence, c.Size, c.Overlap)...)
+			continue
+		}
+		spans = append(spans, sentence)
+	}
+	return spansToChunks(content, mergeSpans(content, spans, c.Size, c.Overlap))
+}
+
+// abbreviations lists lowercase words that end with a period without ending a sentence
+var abbreviations = map[string]bool{
+	"mr": true, "mrs": true, "ms": true, "dr": true, "prof": true, "sr": true, "jr": true, "st": true,
+	"inc": true, "ltd": true, "co": true, "corp": true, "vs": true, "etc": true, "no": true, "fig": true,
+	"e.g": true, "i.e": true, "u.s": true, "u.k": true, "approx": true, "dept": true, "est": true,
+	"jan": true, "feb": true, "mar": true, "apr": true, "jun": true, "jul": true, "aug": true,
+	"sep": true, "sept": true, "oct": true, "nov": true, "dec": true,
+}
+
+// splitSentences returns the spans of the sentences in content. A sentence
+// ends at '.', '!' or '?' (optionally followed by closing quotes or brackets)
+// that is followed by whitespace, or at a blank line.
+func splitSentences(content string) []span {
+	var sentences []span
+	start := 0
+
+	for i := 0; i < len(content); i++ {
+		ch := content[i]
+
+		// Blank lines always separate sentences
+		if ch == '\n' && strings.HasPrefix(strings.TrimLeft(content[i+1:], " \t\r"), "\n") {
+			sentences = append(sentences, span{start: start, end: i})
+			start = i + 1
+			continue
+		}
+
+		if ch != '.' && ch != '!' && ch != '?' {
+			continue
+		}
+
+		// Include closing punctuation in the sentence
+		end := i + 1
+		for end < len(content) && strings.IndexByte(`.!?"')]`, content[end]) >= 0 {
+			end++
+		}
+
+		// Decimals, URLs and file names have no whitespace after the period
+		if end < len(content) && !isSpaceByte(content[end]) {
+			i = end - 1
+			continue
+		}
+
+		if ch == '.' && !endsSentence(content, start, i, end) {
+			i = end - 1
+			continue
+		}
+
+		sentences = append(sentences, span{start: start, end: end})
+		start = end
+		i = end - 1
+	}
+
+	if start < len(content) {
+		sentences = append(sentences, span{start: start, end: len(content)})
+	}
+
+	// Drop whitespace-only spans
+	result := sentences[:0]
+	for _, sentence := range sentences {
+		if trimmed := trimSpan(content, sentence); trimmed.start < trimmed.end {
+			result = append(result, trimmed)
+		}
+	}
+	return result
+}
+
+// endsSentence reports whether the period at dot ends a sentence
+func endsSentence(content string, sentenceStart, dot, end int) bool {
+	// Find the word before the period
+	wordStart := dot
+	for wordStart > sentenceStart && !isSpaceByte(content[wordStart-1]) {
+		wordStart--
+	}
+	word := strings.ToLower(strings.TrimLeft(content[wordStart:dot], `"'([`))
+
+	if abbreviations[word] {
+		return false
+	}
+	// Single letter initials such as "J. Smith"
+	if len(word) == 1 && unicode.IsLetter(rune(word[0])) {
+		return false
+	}
+
+	// A following lowercase word indicates the sentence continues
+	rest := strings.TrimLeft(content[end:], " \t")
+	if r, _ := utf8.DecodeRuneInString(rest); unicode.IsLower(r) {
+		return false
+	}
+
+	return true
+}
+
+func isSpaceByte(b byte) bool {
+	return b == ' ' || b == '\n' || b == '\t' || b == '\r'
+}
+
+// wordPattern matches whitespace-delimited words
+var wordPattern = regexp.MustCompile(`\S+`)
+
+// TokenWindowChunker slides a fixed window of tokens over the content,
+// aligned to word boundaries
+type TokenWindowChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk splits content into fixed-size token windows
+func (c *TokenWindowChunker) Chunk(content string) []ChunkInfo {
+	return spansToChunks(content, tokenWindowSpans(content, span{start: 0, end: len(content)}, c.Size, c.Overlap))
+}
+
+// tokenWindowSpans splits the region sp of content into windows of at most
+// size tokens, each starting overlap tokens before the end of the previous one
+func tokenWindowSpans(content string, sp span, size, overlap int) []span {
+	var words []span
+	var tokens []int
+	for _, loc := range wordPattern.FindAllStringIndex(content[sp.start:sp.end], -1) {
+		word := span{start: sp.start + loc[0], end: sp.start + loc[1]}
+		t := estimateTokens(content[word.start:word.end])
+		if t < 1 {
+			t = 1
+		}
+		words = append(words, word)
+		tokens = append(tokens, t)
+	}
+
+	var windows []span
+	for i := 0; i < len(words); {
+		// Extend the window until it is full; a single oversized word still forms a window
+		j, windowTokens := i, 0
+		for j < len(words) && (j == i || windowTokens+tokens[j] <= size) {
+			windowTokens += tokens[j]
+			j++
+		}
+		windows = append(windows, span{start: words[i].start, end: words[j-1].end})
+		if j == len(words) {
+			break
+		}
+
+		// Step back so the next window repeats up to overlap tokens
+		next, overlapTokens := j, 0
+		for next-1 > i && overlapTokens+tokens[next-1] <= overlap {
+			next--
+			overlapTokens += tokens[next]
+		}
+		i = next
+	}
+
+	return windows
+}
+
+// defaultSeparators are tried in order from the coarsest to the finest
+var defaultSeparators = []string{"\n\n", "\n", ". ", "? ", "! ", "; ", ", ", " "}
+
+// RecursiveChunker splits content on the coarsest separator that yields
+// pieces within the chunk size, recursing into oversized pieces with finer
+// separators, then merges adjacent pieces back up to the chunk size
+type RecursiveChunker struct {
+	Size       int
+	Overlap    int
+	Separators []string
+}
+
+// Chunk splits content recursively by separators
+func (c *RecursiveChunker) Chunk(content string) []ChunkInfo {
+	separators := c.Separators
+	if len(separators) == 0 {
+		separators = defaultSeparators
+	}
+	pieces := c.split(content, span{start: 0, end: len(content)}, separators)
+	return spansToChunks(content, mergeSpans(content, pieces, c.Size, c.Overlap))
+}
+
+// split breaks sp into pieces of at most c.Size tokens
+func (c *RecursiveChunker) split(content string, sp span, separators []string) []span {
+	if estimateTokens(content[sp.start:sp.end]) <= c.Size {
+		return []span{sp}
+	}
+
+	for i, sep := range separators {
+		if !strings.Contains(content[sp.start:sp.end], sep) {
+			continue
+		}
+
+		var pieces []span
+		pos := sp.start
+		for pos < sp.end {
+			idx := strings.Index(content[pos:sp.end], sep)
+			end := sp.end
+			if idx >= 0 {
+				// Keep the separator with the preceding piece
+				end = pos + idx + len(sep)
+			}
+			piece := span{start: pos, end: end}
+			if estimateTokens(content[piece.start:piece.end]) > c.Size {
+				pieces = append(pieces, c.split(content, piece, separators[i+1:])...)
+			} else {
+				pieces = append(pieces, piece)
+			}
+			pos = end
+		}
+		return pieces
+	}
+
+	// No separator left, fall back to fixed token windows
+	return tokenWindowSpans(content, sp, c.Size, 0)
+}
+
+// chunkHierarchy splits content into parent sections of at most parentSize
+// tokens and cuts each parent into chunks with chunker. children[i] holds the
+// chunks of parents[i], positioned in content and indexed across the document.
+func chunkHierarchy(content string, chunker Chunker, parentSize int) (parents []ChunkInfo, children [][]ChunkInfo) {
+	parents = (&MarkdownChunker{Size: parentSize}).Chunk(content)
+	children = make([][]ChunkInfo, len(parents))
+
+	index := 0
+	for i, parent := range parents {
+		for _, chunk := range chunker.Chunk(parent.Content) {
+			chunk.ChunkIndex = index
+			chunk.StartPosition += parent.StartPosition
+			chunk.EndPosition += parent.StartPosition
+			// Parents never span sections, so the parent's path is the full breadcrumb
+			chunk.SectionPath = parent.SectionPath
+			children[i] = append(children[i], chunk)
+			index++
+		}
+	}
+
+	return parents, children
+}
+
+// chunkerFor returns the chunker for a request; empty values fall back to the configured defaults
+func (s *RAGService) chunkerFor(strategy string, size int, overlap *int) (Chunker, error) {
+	if strategy == "" {
+		strategy = s.chunking.Strategy
+	}
+	if size <= 0 {
+		size = s.chunking.Size
+	}
+	chunkOverlap := s.chunking.Overlap
+	if overlap != nil {
+		chunkOverlap = *overlap
+	} else if chunkOverlap >= size {
+		// A request that only shrinks the size keeps a proportional default overlap
+		chunkOverlap = size / 10
+	}
+
+	return NewChunker(strategy, size, chunkOverlap)
+}
+
+// defaultChunker returns the chunker built from the configured defaults
+func (s *RAGService) defaultChunker() Chunker {
+	chunker, err := NewChunker(s.chunking.Strategy, s.chunking.Size, s.chunking.Overlap)
+	if err != nil {
+		// The configuration is validated at startup, so this only guards against misuse
+		return &MarkdownChunker{Size: 250, Overlap: 25}
+	}
+	return chunker
+}
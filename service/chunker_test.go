@@ -0,0 +1,102 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitSentences(t *testing.T) {
+	content := "Pi is roughly 3.14 today. See https://example.com/docs.html for details. " +
+		"Dr. Smith met J. Doe, e.g. at the U.S. office! Was it fun? Yes.\n\nNew paragraph"
+
+	var sentences []string
+	for _, sp := range splitSentences(content) {
+		sentences = append(sentences, content[sp.start:sp.end])
+	}
+
+	assert.Equal(t, []string{
+		"Pi is roughly 3.14 today.",
+		"See https://example.com/docs.html for details.",
+		"Dr. Smith met J. Doe, e.g. at the U.S. office!",
+		"Was it fun?",
+		"Yes.",
+		"New paragraph",
+	}, sentences)
+}
+
+func TestChunkers_PositionsMatchContent(t *testing.T) {
+	content := strings.Repeat("The quick brown fox jumps over the lazy dog. ", 40) +
+		"\n\n" + strings.Repeat("Version 1.2 ships on example.org today, finally. ", 30)
+
+	for _, strategy := range []string{ChunkStrategySentence, ChunkStrategyTokenWindow, ChunkStrategyRecursive} {
+		t.Run(strategy, func(t *testing.T) {
+			chunker, err := NewChunker(strategy, 60, 10)
+			require.NoError(t, err)
+
+			chunks := chunker.Chunk(content)
+			require.Greater(t, len(chunks), 1)
+			for i, chunk := range chunks {
+				assert.Equal(t, i, chunk.ChunkIndex)
+				assert.Equal(t, content[chunk.StartPosition:chunk.EndPosition], chunk.Content)
+				assert.LessOrEqual(t, estimateTokens(chunk.Content), 60)
+				if i > 0 {
+					assert.Greater(t, chunk.StartPosition, chunks[i-1].StartPosition)
+				}
+			}
+		})
+	}
+}
+
+func TestTokenWindowChunker_Overlap(t *testing.T) {
+	// Every word is a single token
+	content := "a b c d e f g h i j"
+	chunker := &TokenWindowChunker{Size: 4, Overlap: 2}
+
+	var windows []string
+	for _, chunk := range chunker.Chunk(content) {
+		windows = append(windows, chunk.Content)
+	}
+
+	assert.Equal(t, []string{"a b c d", "c d e f", "e f g h", "g h i j"}, windows)
+}
+
+func TestNewChunker_Validation(t *testing.T) {
+	_, err := NewChunker("unknown", 100, 10)
+	assert.Error(t, err)
+
+	_, err = NewChunker(ChunkStrategySentence, 100, 100)
+	assert.Error(t, err)
+
+	_, err = NewChunker(ChunkStrategyRecursive, 0, 0)
+	assert.Error(t, err)
+}
+
+func TestChunkHierarchy(t *testing.T) {
+	content := "# Guide\n\n" + strings.Repeat("Parents hold several small chunks. ", 30) +
+		"\n\n## Details\n\n" + strings.Repeat("Details are split the same way. ", 20)
+
+	chunker, err := NewChunker(ChunkStrategySentence, 30, 0)
+	require.NoError(t, err)
+	parents, children := chunkHierarchy(content, chunker, 200)
+
+	require.Len(t, children, len(parents))
+	require.Greater(t, len(parents), 1)
+
+	index := 0
+	for i, parent := range parents {
+		assert.Equal(t, content[parent.StartPosition:parent.EndPosition], parent.Content)
+		require.NotEmpty(t, children[i])
+		for _, chunk := range children[i] {
+			assert.Equal(t, index, chunk.ChunkIndex)
+			assert.Equal(t, content[chunk.StartPosition:chunk.EndPosition], chunk.Content)
+			assert.GreaterOrEqual(t, chunk.StartPosition, parent.StartPosition)
+			assert.LessOrEqual(t, chunk.EndPosition, parent.EndPosition)
+			assert.Equal(t, parent.SectionPath, chunk.SectionPath)
+			index++
+		}
+	}
+	assert.Equal(t, "Guide > Details", parents[len(parents)-1].SectionPath)
+}
@@ -0,0 +1,197 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"unicode/utf8"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+)
+
+// MaxContextWindow is the largest number of neighboring chunks that may be
+// added on each side of a query result
+const MaxContextWindow = 10
+
+// windowGroup is a run of neighboring chunks of one document that covers the
+// context windows of one or more results
+type windowGroup struct {
+	documentID int
+	first      int // first chunk index
+	last       int // last chunk index
+	members    []int
+}
+
+// mergeContextWindows computes the chunk index range of window chunks on
+// either side of each result and merges ranges of the same document that
+// overlap or touch. Groups are ordered by their best ranked member and
+// members are listed in rank order.
+func mergeContextWindows(results []models.SearchResult, window int) []windowGroup {
+	byDocument := make(map[int][]windowGroup)
+	var documentOrder []int
+	for i, result := range results {
+		first, last := result.ChunkIndex-window, result.ChunkIndex+window
+		if first < 0 {
+			first = 0
+		}
+		if _, ok := byDocument[result.DocumentID]; !ok {
+			documentOrder = append(documentOrder, result.DocumentID)
+		}
+		byDocument[result.DocumentID] = append(byDocument[result.DocumentID],
+			windowGroup{documentID: result.DocumentID, first: first, last: last, members: []int{i}})
+	}
+
+	var groups []windowGroup
+	for _, documentID := range documentOrder {
+		windows := byDocument[documentID]
+		sort.SliceStable(windows, func(i, j int) bool { return windows[i].first < windows[j].first })
+
+		current := windows[0]
+		for _, w := range windows[1:] {
+			if w.first <= current.last+1 {
+				if w.last > current.last {
+					current.last = w.last
+				}
+				current.members = append(current.members, w.members...)
+				continue
+			}
+			groups = append(groups, current)
+			current = w
+		}
+		groups = append(groups, current)
+	}
+
+	for i := range groups {
+		sort.Ints(groups[i].members)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].members[0] < groups[j].members[0] })
+
+	return groups
+}
+
+// expandContextWindows replaces the content of each result with the text of
+// the window chunks around it, stitched from the document content. Results
+// whose windows overlap are merged into the best ranked one.
+func (s *RAGService) expandContextWindows(ctx context.Context, results []models.SearchResult, window int) ([]models.SearchResult, error) {
+	if window <= 0 || len(results) == 0 {
+		return results, nil
+	}
+
+	groups := mergeContextWindows(results, window)
+
+	// Look up the span of every window
+	documentIDs := make([]int64, len(groups))
+	firsts := make([]int64, len(groups))
+	lasts := make([]int64, len(groups))
+	for i, g := range groups {
+		documentIDs[i] = int64(g.documentID)
+		firsts[i] = int64(g.first)
+		lasts[i] = int64(g.last)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT w.ord - 1, MIN(c.chunk_index), MAX(c.chunk_index), MIN(c.start_position), MAX(c.end_position)
+		FROM unnest($1::integer[], $2::integer[], $3::integer[]) WITH ORDINALITY AS w(document_id, first_index, last_index, ord)
+		JOIN chunks c ON c.document_id = w.document_id AND c.chunk_index BETWEEN w.first_index AND w.last_index
+		GROUP BY w.ord
+	`, pq.Array(documentIDs), pq.Array(firsts), pq.Array(lasts))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query context windows: %w", err)
+	}
+	defer rows.Close()
+
+	windows := make(map[int]models.ContextWindow)
+	for rows.Next() {
+		var group int
+		var w models.ContextWindow
+		if err := rows.Scan(&group, &w.FirstChunkIndex, &w.LastChunkIndex, &w.StartPosition, &w.EndPosition); err != nil {
+			return nil, fmt.Errorf("failed to scan context window: %w", err)
+		}
+		windows[group] = w
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating context window rows: %w", err)
+	}
+
+	contents, err := s.documentContents(ctx, documentIDs)
+	if err != nil {
+		return nil, err
+	}
+
+	expanded := make([]models.SearchResult, 0, len(groups))
+	for i, g := range groups {
+		result := results[g.members[0]]
+		w, ok := windows[i]
+		if !ok {
+			expanded = append(expanded, result)
+			continue
+		}
+
+		// The window also covers the parent sections returned by small-to-big retrieval
+		for _, member := range g.members {
+			if parent := results[member].Parent; parent != nil {
+				w.StartPosition = min(w.StartPosition, parent.StartPosition)
+				w.EndPosition = max(w.EndPosition, parent.EndPosition)
+			}
+		}
+
+		content := contents[g.documentID]
+		if w.StartPosition < 0 || w.EndPosition > len(content) || w.StartPosition >= w.EndPosition ||
+			!utf8.ValidString(content[w.StartPosition:w.EndPosition]) {
+			// Positions from before chunk offsets were recorded cannot be trusted
+			expanded = append(expanded, result)
+			continue
+		}
+		result.Content = content[w.StartPosition:w.EndPosition]
+		result.Context = &w
+
+		// Keep track of every hit folded into this window
+		var matched []models.ChunkPosition
+		for _, member := range g.members {
+			m := results[member]
+			if m.MatchedChunks != nil {
+				matched = append(matched, m.MatchedChunks...)
+				continue
+			}
+			matched = append(matched, models.ChunkPosition{
+				ID:            m.ChunkID,
+				ChunkIndex:    m.ChunkIndex,
+				StartPosition: m.StartPosition,
+				EndPosition:   m.EndPosition,
+				Score:         m.Score,
+			})
+		}
+		result.MatchedChunks = matched
+
+		expanded = append(expanded, result)
+	}
+
+	return expanded, nil
+}
+
+// documentContents returns the content of the given documents keyed by ID
+func (s *RAGService) documentContents(ctx context.Context, documentIDs []int64) (map[int]string, error) {
+	rows, err := s.db.QueryContext(ctx, `SELECT id, content FROM documents WHERE id = ANY($1)`, pq.Array(documentIDs))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query document contents: %w", err)
+	}
+	defer rows.Close()
+
+	contents := make(map[int]string)
+	for rows.Next() {
+		var id int
+		var content string
+		if err := rows.Scan(&id, &content); err != nil {
+			return nil, fmt.Errorf("failed to scan document content: %w", err)
+		}
+		contents[id] = content
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating document rows: %w", err)
+	}
+
+	return contents, nil
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMergeContextWindows(t *testing.T) {
+	// Results in rank order
+	results := []models.SearchResult{
+		{DocumentID: 1, ChunkIndex: 10},
+		{DocumentID: 2, ChunkIndex: 0},
+		{DocumentID: 1, ChunkIndex: 2},
+		{DocumentID: 1, ChunkIndex: 12},
+		{DocumentID: 1, ChunkIndex: 5},
+	}
+
+	groups := mergeContextWindows(results, 1)
+
+	assert.Equal(t, []windowGroup{
+		// Chunks 9-11 and 11-13 overlap
+		{documentID: 1, first: 9, last: 13, members: []int{0, 3}},
+		// The window is clamped at the start of the document
+		{documentID: 2, first: 0, last: 1, members: []int{1}},
+		// Chunks 1-3 and 4-6 touch
+		{documentID: 1, first: 1, last: 6, members: []int{2, 4}},
+	}, groups)
+}
+
+func TestMergeContextWindows_NoOverlap(t *testing.T) {
+	results := []models.SearchResult{
+		{DocumentID: 1, ChunkIndex: 0},
+		{DocumentID: 1, ChunkIndex: 8},
+	}
+
+	groups := mergeContextWindows(results, 2)
+
+	assert.Equal(t, []windowGroup{
+		{documentID: 1, first: 0, last: 2, members: []int{0}},
+		{documentID: 1, first: 6, last: 10, members: []int{1}},
+	}, groups)
+}
@@ -0,0 +1,128 @@
+package service
+
+import (
+	"math"
+)
+
+// diversifyHits selects up to n hits in order, taking at most perDocument
+// hits from each document when perDocument is positive. With mmr set, hits
+// are picked by maximal marginal relevance over their chunk embeddings:
+//
+//	mmr = lambda * relevance - (1 - lambda) * max similarity to the hits already picked
+//
+// where relevance is the hit score scaled to [0, 1] over the candidates and
+// similarity is the cosine similarity of the chunk embeddings. Otherwise hits
+// keep their ranking order.
+func diversifyHits(hits []searchHit, n int, mmr bool, lambda float64, perDocument int) []searchHit {
+	perDocumentCount := make(map[int]int)
+	capped := func(hit searchHit) bool {
+		return perDocument > 0 && perDocumentCount[hit.result.DocumentID] >= perDocument
+	}
+
+	selected := make([]searchHit, 0, min(n, len(hits)))
+	if !mmr {
+		for _, hit := range hits {
+			if len(selected) == n {
+				break
+			}
+			if capped(hit) {
+				continue
+			}
+			perDocumentCount[hit.result.DocumentID]++
+			selected = append(selected, hit)
+		}
+		return selected
+	}
+
+	relevance := normalizedScores(hits)
+	vectors := make([][]float32, len(hits))
+	for i, hit := range hits {
+		vectors[i] = unitVector(hit.embedding)
+	}
+
+	// maxSimilarity[i] is the highest similarity of hit i to any selected hit
+	maxSimilarity := make([]float64, len(hits))
+	picked := make([]bool, len(hits))
+	for len(selected) < n {
+		best := -1
+		bestScore := math.Inf(-1)
+		for i, hit := range hits {
+			if picked[i] || capped(hit) {
+				continue
+			}
+			score := lambda*relevance[i] - (1-lambda)*maxSimilarity[i]
+			if score > bestScore {
+				best, bestScore = i, score
+			}
+		}
+		if best < 0 {
+			break
+		}
+
+		picked[best] = true
+		perDocumentCount[hits[best].result.DocumentID]++
+		selected = append(selected, hits[best])
+
+		for i := range hits {
+			if !picked[i] {
+				maxSimilarity[i] = math.Max(maxSimilarity[i], dotProduct(vectors[i], vectors[best]))
+			}
+		}
+	}
+
+	return selected
+}
+
+// normalizedScores scales the hit scores linearly to [0, 1]
+func normalizedScores(hits []searchHit) []float64 {
+	if len(hits) == 0 {
+		return nil
+	}
+
+	lo, hi := hits[0].result.Score, hits[0].result.Score
+	for _, hit := range hits {
+		lo = math.Min(lo, hit.result.Score)
+		hi = math.Max(hi, hit.result.Score)
+	}
+
+	scores := make([]float64, len(hits))
+	for i, hit := range hits {
+		if hi > lo {
+			scores[i] = (hit.result.Score - lo) / (hi - lo)
+		} else {
+			scores[i] = 1
+		}
+	}
+	return scores
+}
+
+// unitVector returns v scaled to unit length, or nil for an empty or zero vector
+func unitVector(v []float32) []float32 {
+	var norm float64
+	for _, x := range v {
+		norm += float64(x) * float64(x)
+	}
+	if norm == 0 {
+		return nil
+	}
+
+	norm = math.Sqrt(norm)
+	unit := make([]float32, len(v))
+	for i, x := range v {
+		unit[i] = float32(float64(x) / norm)
+	}
+	return unit
+}
+
+// dotProduct returns the dot product of two vectors, or 0 if their lengths differ
+func dotProduct(a, b []float32) float64 {
+	if len(a) != len(b) {
+		return 0
+	}
+
+	var sum float64
+	for i := range a {
+		sum += float64(a[i]) * float64(b[i])
+	}
+	return sum
+}
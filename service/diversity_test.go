@@ -0,0 +1,63 @@
+package service
+
+import (
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func diversityHit(chunkID, documentID int, score float64, embedding ...float32) searchHit {
+	return searchHit{
+		result:    models.SearchResult{ChunkID: chunkID, DocumentID: documentID, Score: score},
+		embedding: embedding,
+	}
+}
+
+func chunkIDs(hits []searchHit) []int {
+	ids := make([]int, len(hits))
+	for i, hit := range hits {
+		ids[i] = hit.result.ChunkID
+	}
+	return ids
+}
+
+func TestDiversifyHits_MMR(t *testing.T) {
+	// Chunks 1 and 2 are near duplicates, chunk 3 is less relevant but different
+	hits := []searchHit{
+		diversityHit(1, 1, 0.9, 1, 0),
+		diversityHit(2, 1, 0.85, 0.99, 0.01),
+		diversityHit(3, 2, 0.5, 0, 1),
+	}
+
+	assert.Equal(t, []int{1, 3, 2}, chunkIDs(diversifyHits(hits, 3, true, 0.5, 0)))
+	// A lambda of 1 is pure relevance
+	assert.Equal(t, []int{1, 2, 3}, chunkIDs(diversifyHits(hits, 3, true, 1, 0)))
+	assert.Equal(t, []int{1, 3}, chunkIDs(diversifyHits(hits, 2, true, 0.5, 0)))
+}
+
+func TestDiversifyHits_PerDocumentCap(t *testing.T) {
+	hits := []searchHit{
+		diversityHit(1, 1, 0.9),
+		diversityHit(2, 1, 0.8),
+		diversityHit(3, 1, 0.7),
+		diversityHit(4, 2, 0.6),
+		diversityHit(5, 2, 0.5),
+	}
+
+	assert.Equal(t, []int{1, 2, 4, 5}, chunkIDs(diversifyHits(hits, 10, false, 0, 2)))
+	assert.Equal(t, []int{1, 4}, chunkIDs(diversifyHits(hits, 10, true, 0.5, 1)))
+	assert.Equal(t, []int{1, 2, 3}, chunkIDs(diversifyHits(hits, 3, false, 0, 0)))
+}
+
+func TestDiversifyHits_MissingEmbeddings(t *testing.T) {
+	// Chunks found only by full-text search may have no embedding
+	hits := []searchHit{
+		diversityHit(1, 1, 0.9, 1, 0),
+		diversityHit(2, 1, 0.8),
+		diversityHit(3, 2, 0.7, 1, 0),
+	}
+
+	assert.Equal(t, []int{1, 2, 3}, chunkIDs(diversifyHits(hits, 3, true, 0.5, 0)))
+}
@@ -0,0 +1,213 @@
+package service
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"unicode/utf8"
+
+	"rag-data-service/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Embedder defines the interface for turning text into embedding vectors
+type Embedder interface {
+	// Embed returns one embedding per input text, in the same order
+	Embed(ctx context.Context, texts []string) ([][]float32, error)
+	// Model returns the name of the embedding model
+	Model() string
+	// Dimensions returns the length of the vectors produced by the model
+	Dimensions() int
+}
+
+// NewEmbedder creates an embedder for the configured provider
+func NewEmbedder(cfg config.EmbeddingConfig, client *openai.Client) (Embedder, error) {
+	switch strings.ToLower(cfg.Provider) {
+	case "openai":
+		return NewOpenAIEmbedder(client, cfg.Model, cfg.Dimensions), nil
+	case "hash", "":
+		return NewHashEmbedder(cfg.Dimensions), nil
+	default:
+		return nil, fmt.Errorf("unknown embedding provider: %s", cfg.Provider)
+	}
+}
+
+// estimateTokens returns a rough token count for text using the common
+// approximation of four characters per token
+func estimateTokens(text string) int {
+	return (utf8.RuneCountInString(text) + 3) / 4
+}
+
+// batchTexts groups the indexes of texts into batches holding at most maxSize
+// texts and maxTokens estimated tokens. A single text that exceeds maxTokens
+// on its own is placed in a batch by itself.
+func batchTexts(texts []string, maxSize, maxTokens int) [][]int {
+	var batches [][]int
+	var current []int
+	currentTokens := 0
+
+	for i, text := range texts {
+		tokens := estimateTokens(text)
+		full := maxSize > 0 && len(current) >= maxSize
+		overBudget := maxTokens > 0 && currentTokens+tokens > maxTokens
+		if len(current) > 0 && (full || overBudget) {
+			batches = append(batches, current)
+			current = nil
+			currentTokens = 0
+		}
+		current = append(current, i)
+		currentTokens += tokens
+	}
+	if len(current) > 0 {
+		batches = append(batches, current)
+	}
+
+	return batches
+}
+
+// OpenAIEmbedder generates embeddings with the OpenAI embeddings API or any
+// OpenAI-compatible endpoint configured through the client's base URL
+type OpenAIEmbedder struct {
+	client     *openai.Client
+	model      string
+	dimensions int
+}
+
+// NewOpenAIEmbedder creates a new OpenAI embedder
+func NewOpenAIEmbedder(client *openai.Client, model string, dimensions int) *OpenAIEmbedder {
+	return &OpenAIEmbedder{
+		client:     client,
+		model:      model,
+		dimensions: dimensions,
+	}
+}
+
+// Embed generates embeddings for the given texts in a single API call
+func (e *OpenAIEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	if len(texts) == 0 {
+		return nil, nil
+	}
+
+	req := openai.EmbeddingRequest{
+		Input: texts,
+		Model: openai.EmbeddingModel(e.model),
+	}
+	// Only text-embedding-3 and later models accept a dimensions parameter,
+	// and OpenAI-compatible servers frequently reject it
+	if strings.HasPrefix(e.model, "text-embedding-3") {
+		req.Dimensions = e.dimensions
+	}
+
+	resp, err := e.client.CreateEmbeddings(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embeddings: %w", err)
+	}
+	if len(resp.Data) != len(texts) {
+		return nil, fmt.Errorf("expected %d embeddings, got %d", len(texts), len(resp.Data))
+	}
+
+	// The API does not guarantee ordering, so place results by index
+	sort.Slice(resp.Data, func(i, j int) bool {
+		return resp.Data[i].Index < resp.Data[j].Index
+	})
+
+	embeddings := make([][]float32, len(resp.Data))
+	for i, data := range resp.Data {
+		if len(data.Embedding) != e.dimensions {
+			return nil, fmt.Errorf("embedding %d has %d dimensions, expected %d", i, len(data.Embedding), e.dimensions)
+		}
+		embeddings[i] = data.Embedding
+	}
+
+	return embeddings, nil
+}
+
+// Model returns the name of the embedding model
+func (e *OpenAIEmbedder) Model() string {
+	return e.model
+}
+
+// Dimensions returns the embedding dimensions
+func (e *OpenAIEmbedder) Dimensions() int {
+	return e.dimensions
+}
+
+// HashEmbedder generates deterministic pseudo-random vectors seeded from the
+// text's word frequencies. It needs no network access and is intended for
+// offline development and tests; the vectors carry no semantic meaning.
+type HashEmbedder struct {
+	dimensions int
+}
+
+// NewHashEmbedder creates a new hash embedder
+func NewHashEmbedder(dimensions int) *HashEmbedder {
+	if dimensions <= 0 {
+		dimensions = 1536
+	}
+	return &HashEmbedder{dimensions: dimensions}
+}
+
+// Embed generates hash-seeded embeddings for the given texts
+func (e *HashEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	embeddings := make([][]float32, len(texts))
+	for i, text := range texts {
+		embeddings[i] = e.embed(text)
+	}
+	return embeddings, nil
+}
+
+func (e *HashEmbedder) embed(text string) []float32 {
+	vector := make([]float32, e.dimensions)
+
+	// Normalize and clean text for better feature extraction
+	text = strings.ToLower(strings.TrimSpace(text))
+	words := strings.Fields(text)
+
+	// Create a more sophisticated hash that considers word frequency and position
+	wordHash := make(map[string]int)
+	for i, word := range words {
+		// Give more weight to words at the beginning
+		weight := len(words) - i
+		wordHash[word] += weight
+	}
+
+	// Iterate words in sorted order so the hash does not depend on map ordering
+	uniqueWords := make([]string, 0, len(wordHash))
+	for word := range wordHash {
+		uniqueWords = append(uniqueWords, word)
+	}
+	sort.Strings(uniqueWords)
+
+	// Create a combined hash from word frequencies
+	combinedHash := 0
+	for _, word := range uniqueWords {
+		for _, char := range word {
+			combinedHash = (combinedHash*31 + int(char)) % 1000000
+		}
+		combinedHash = (combinedHash * wordHash[word]) % 1000000
+	}
+
+	// Use the combined hash to generate more distinctive vectors
+	seed := int64(combinedHash)
+	for i := range vector {
+		// More sophisticated pseudo-random generation
+		seed = (seed*1103515245 + 12345) & 0x7fffffff
+		// Add position-based variation to make vectors more unique
+		positionFactor := float32(i) / float32(e.dimensions)
+		vector[i] = float32(seed%1000)/1000.0 + positionFactor*0.1
+	}
+
+	return vector
+}
+
+// Model returns the name of the embedding model
+func (e *HashEmbedder) Model() string {
+	return "hash"
+}
+
+// Dimensions returns the embedding dimensions
+func (e *HashEmbedder) Dimensions() int {
+	return e.dimensions
+}
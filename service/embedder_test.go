@@ -0,0 +1,149 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rag-data-service/config"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHashEmbedder_Deterministic(t *testing.T) {
+	embedder := NewHashEmbedder(64)
+	ctx := context.Background()
+
+	first, err := embedder.Embed(ctx, []string{"the quick brown fox jumps over the lazy dog"})
+	require.NoError(t, err)
+	second, err := embedder.Embed(ctx, []string{"the quick brown fox jumps over the lazy dog"})
+	require.NoError(t, err)
+
+	assert.Equal(t, first, second)
+	assert.Len(t, first[0], 64)
+	assert.Equal(t, 64, embedder.Dimensions())
+}
+
+func TestOpenAIEmbedder_Embed(t *testing.T) {
+	var received openai.EmbeddingRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/embeddings", r.URL.Path)
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+
+		// Return results out of order to verify they are sorted by index
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"object": "list",
+			"model":  "text-embedding-3-small",
+			"data": []map[string]interface{}{
+				{"object": "embedding", "index": 1, "embedding": []float32{0, 1, 0}},
+				{"object": "embedding", "index": 0, "embedding": []float32{1, 0, 0}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL
+	embedder, err := NewEmbedder(config.EmbeddingConfig{
+		Provider:   "openai",
+		Model:      "text-embedding-3-small",
+		Dimensions: 3,
+	}, openai.NewClientWithConfig(clientConfig))
+	require.NoError(t, err)
+
+	embeddings, err := embedder.Embed(context.Background(), []string{"first", "second"})
+	require.NoError(t, err)
+
+	assert.Equal(t, 3, received.Dimensions)
+	assert.Equal(t, [][]float32{{1, 0, 0}, {0, 1, 0}}, embeddings)
+	assert.Equal(t, "text-embedding-3-small", embedder.Model())
+}
+
+func TestOpenAIEmbedder_DimensionMismatch(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"data": []map[string]interface{}{
+				{"index": 0, "embedding": []float32{1, 0}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	clientConfig := openai.DefaultConfig("test-key")
+	clientConfig.BaseURL = server.URL
+	embedder := NewOpenAIEmbedder(openai.NewClientWithConfig(clientConfig), "nomic-embed-text", 3)
+
+	_, err := embedder.Embed(context.Background(), []string{"text"})
+	assert.Error(t, err)
+}
+
+func TestNewEmbedder_UnknownProvider(t *testing.T) {
+	_, err := NewEmbedder(config.EmbeddingConfig{Provider: "unknown"}, nil)
+	assert.Error(t, err)
+}
+
+// failingEmbedder fails any request containing a text listed in fail
+type failingEmbedder struct {
+	HashEmbedder
+	fail  map[string]bool
+	calls [][]string
+}
+
+func (e *failingEmbedder) Embed(ctx context.Context, texts []string) ([][]float32, error) {
+	e.calls = append(e.calls, texts)
+	for _, text := range texts {
+		if e.fail[text] {
+			return nil, assert.AnError
+		}
+	}
+	return e.HashEmbedder.Embed(ctx, texts)
+}
+
+func TestBatchTexts(t *testing.T) {
+	texts := []string{"aaaa", "bbbb", "cccc", "dddddddddddddddddddd", "eeee"}
+
+	assert.Equal(t, [][]int{{0, 1}, {2, 3}, {4}}, batchTexts(texts, 2, 0))
+	// "dddd..." is five tokens on its own, so it overflows the token budget
+	assert.Equal(t, [][]int{{0, 1, 2}, {3}, {4}}, batchTexts(texts, 0, 5))
+	assert.Nil(t, batchTexts(nil, 2, 5))
+}
+
+func TestEmbedBatched_PartialFailure(t *testing.T) {
+	embedder := &failingEmbedder{
+		HashEmbedder: *NewHashEmbedder(8),
+		fail:         map[string]bool{"bad": true},
+	}
+	service := NewRAGService(nil, "test-key", "", "", WithEmbedder(embedder))
+	service.embeddingBatchSize = 3
+
+	embeddings := service.embedBatched(context.Background(), embedder, []string{"one", "bad", "three", "four"})
+
+	require.Len(t, embeddings, 4)
+	assert.NotNil(t, embeddings[0])
+	assert.Nil(t, embeddings[1])
+	assert.NotNil(t, embeddings[2])
+	assert.NotNil(t, embeddings[3])
+	// One failed batch, three individual retries, one final batch
+	assert.Len(t, embedder.calls, 5)
+}
+
+func TestEmbeddingSwapSQL(t *testing.T) {
+	sql := embeddingSwapSQL()
+
+	assert.Contains(t, sql, "ALTER TABLE chunks RENAME COLUMN embedding_next TO embedding;")
+	assert.Contains(t, sql, "ALTER INDEX idx_knowledge_nodes_embedding_next RENAME TO idx_knowledge_nodes_embedding;")
+	assert.NotContains(t, sql, "ALTER COLUMN embedding TYPE")
+}
+
+func TestEmbeddingResizeSQL(t *testing.T) {
+	sql := embeddingResizeSQL(768)
+
+	assert.Contains(t, sql, "ALTER TABLE chunks ALTER COLUMN embedding TYPE vector(768) USING NULL::vector(768);")
+	assert.Contains(t, sql, "CREATE INDEX IF NOT EXISTS idx_knowledge_nodes_embedding ON knowledge_nodes")
+}
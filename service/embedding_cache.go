@@ -0,0 +1,182 @@
+package service
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+// contentHash returns the hex encoded SHA-256 hash of text
+func contentHash(text string) string {
+	sum := sha256.Sum256([]byte(text))
+	return hex.EncodeToString(sum[:])
+}
+
+// embedTexts generates embeddings for texts with the given embedder, consulting
+// the embedding cache first and batching the misses. Texts that could not be
+// embedded are left nil.
+func (s *RAGService) embedTexts(ctx context.Context, embedder Embedder, texts []string) [][]float32 {
+	if !s.embeddingCacheEnabled {
+		return s.embedBatched(ctx, embedder, texts)
+	}
+
+	hashes := make([]string, len(texts))
+	for i, text := range texts {
+		hashes[i] = contentHash(text)
+	}
+
+	cached, err := s.lookupCachedEmbeddings(ctx, embedder, hashes)
+	if err != nil {
+		// The cache is an optimisation, so fall back to embedding everything
+		log.Printf("Warning: failed to read embedding cache: %v", err)
+		cached = nil
+	}
+
+	embeddings := make([][]float32, len(texts))
+	var missTexts []string
+	var missIndexes []int
+	for i, hash := range hashes {
+		if embedding, ok := cached[hash]; ok {
+			embeddings[i] = embedding
+			continue
+		}
+		missTexts = append(missTexts, texts[i])
+		missIndexes = append(missIndexes, i)
+	}
+	s.embeddingCacheHits.Add(int64(len(texts) - len(missTexts)))
+	s.embeddingCacheMisses.Add(int64(len(missTexts)))
+
+	if len(missTexts) == 0 {
+		return embeddings
+	}
+
+	generated := s.embedBatched(ctx, embedder, missTexts)
+	newEntries := make(map[string][]float32)
+	for i, embedding := range generated {
+		idx := missIndexes[i]
+		embeddings[idx] = embedding
+		if embedding != nil {
+			newEntries[hashes[idx]] = embedding
+		}
+	}
+
+	if err := s.storeCachedEmbeddings(ctx, embedder, newEntries); err != nil {
+		log.Printf("Warning: failed to write embedding cache: %v", err)
+	}
+
+	return embeddings
+}
+
+// generateCachedEmbedding generates an embedding for a single document or
+// knowledge node text, consulting the embedding cache first
+func (s *RAGService) generateCachedEmbedding(ctx context.Context, text string) (pgvector.Vector, error) {
+	if !s.embeddingCacheEnabled {
+		return s.generateEmbedding(ctx, text)
+	}
+
+	embeddings := s.embedTexts(ctx, s.currentEmbedder(), []string{text})
+	if embeddings[0] == nil {
+		return pgvector.Vector{}, fmt.Errorf("failed to generate embedding")
+	}
+
+	return pgvector.NewVector(embeddings[0]), nil
+}
+
+// lookupCachedEmbeddings returns cached embeddings for the embedder's model keyed by content hash
+func (s *RAGService) lookupCachedEmbeddings(ctx context.Context, embedder Embedder, hashes []string) (map[string][]float32, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT content_hash, embedding
+		FROM embedding_cache
+		WHERE model = $1 AND dimensions = $2 AND content_hash = ANY($3)
+	`, embedder.Model(), embedder.Dimensions(), pq.Array(hashes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query embedding cache: %w", err)
+	}
+	defer rows.Close()
+
+	cached := make(map[string][]float32)
+	for rows.Next() {
+		var hash string
+		var embedding pgvector.Vector
+		if err := rows.Scan(&hash, &embedding); err != nil {
+			return nil, fmt.Errorf("failed to scan embedding cache row: %w", err)
+		}
+		cached[hash] = embedding.Slice()
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating embedding cache rows: %w", err)
+	}
+
+	return cached, nil
+}
+
+// storeCachedEmbeddings writes new embeddings for the embedder's model to the cache
+func (s *RAGService) storeCachedEmbeddings(ctx context.Context, embedder Embedder, entries map[string][]float32) error {
+	if len(entries) == 0 {
+		return nil
+	}
+
+	var placeholders []string
+	args := []interface{}{embedder.Model(), embedder.Dimensions()}
+	for hash, embedding := range entries {
+		n := len(args)
+		placeholders = append(placeholders, fmt.Sprintf("($%d, $1, $2, $%d)", n+1, n+2))
+		args = append(args, hash, pgvector.NewVector(embedding))
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO embedding_cache (content_hash, model, dimensions, embedding)
+		VALUES `+strings.Join(placeholders, ", ")+`
+		ON CONFLICT (content_hash, model, dimensions) DO NOTHING
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to store embedding cache entries: %w", err)
+	}
+
+	return nil
+}
+
+// GetEmbeddingCacheStats returns the cache hit/miss counters since startup and the number of stored entries
+func (s *RAGService) GetEmbeddingCacheStats(ctx context.Context) (*models.EmbeddingCacheStats, error) {
+	stats := &models.EmbeddingCacheStats{
+		Enabled: s.embeddingCacheEnabled,
+		Model:   s.currentEmbedder().Model(),
+		Hits:    s.embeddingCacheHits.Load(),
+		Misses:  s.embeddingCacheMisses.Load(),
+	}
+
+	err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM embedding_cache`).Scan(&stats.Entries)
+	if err != nil {
+		return nil, fmt.Errorf("failed to count embedding cache entries: %w", err)
+	}
+
+	return stats, nil
+}
+
+// PurgeEmbeddingCache deletes cached embeddings, optionally only those of a single model
+func (s *RAGService) PurgeEmbeddingCache(ctx context.Context, model string) (int64, error) {
+	query := `DELETE FROM embedding_cache`
+	var args []interface{}
+	if model != "" {
+		query += ` WHERE model = $1`
+		args = append(args, model)
+	}
+
+	result, err := s.db.ExecContext(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge embedding cache: %w", err)
+	}
+
+	deleted, _ := result.RowsAffected()
+	log.Printf("Purged %d embedding cache entries (model: %q)", deleted, model)
+	return deleted, nil
+}
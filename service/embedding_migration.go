@@ -0,0 +1,665 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"rag-data-service/config"
+	"rag-data-service/models"
+
+	"github.com/pgvector/pgvector-go"
+)
+
+// embeddingTable describes a table holding embeddings and the column they are generated from
+type embeddingTable struct {
+	name       string
+	textColumn string
+	index      string
+}
+
+// embeddingTables lists every table whose embeddings must share the configured model
+var embeddingTables = []embeddingTable{
+	{name: "documents", textColumn: "content", index: "idx_documents_embedding"},
+	{name: "chunks", textColumn: "content", index: "idx_chunks_embedding"},
+	{name: "knowledge_nodes", textColumn: "name", index: "idx_knowledge_nodes_embedding"},
+}
+
+// migrationBatchSize is the number of rows re-embedded per backfill step
+const migrationBatchSize = 100
+
+// migrationAttempts is the number of backfill passes made before a migration
+// gives up on rows whose re-embedding keeps failing
+const migrationAttempts = 3
+
+// ErrMigrationRunning is returned when an embedding migration is started while another is running
+var ErrMigrationRunning = errors.New("embedding migration already running")
+
+// ErrInvalidMigration is returned when the target of an embedding migration cannot be migrated to
+var ErrInvalidMigration = errors.New("invalid embedding migration")
+
+// errEmbeddingsNotStaged reports rows that still lack a new-model embedding at cut-over
+var errEmbeddingsNotStaged = errors.New("rows could not be re-embedded")
+
+// embeddingMigration holds the state of the running embedding migration
+type embeddingMigration struct {
+	id       int
+	from     Embedder
+	embedder Embedder
+	cancel   context.CancelFunc
+}
+
+// currentEmbedder returns the embedder used for queries and new writes
+func (s *RAGService) currentEmbedder() Embedder {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.embedder
+}
+
+// activeMigration returns the running embedding migration, or nil if there is none
+func (s *RAGService) activeMigration() *embeddingMigration {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return s.migration
+}
+
+// holdCutover keeps an embedding migration from cutting over until the
+// returned function is called. Writers hold it from choosing the embedder
+// until their embeddings are stored, so nothing embedded with the old model
+// is stored after the switch; queries hold it from embedding the query until
+// it has been searched for.
+func (s *RAGService) holdCutover() func() {
+	s.cutoverMu.RLock()
+	return s.cutoverMu.RUnlock
+}
+
+// CheckEmbeddingSchema verifies at startup that the configured embedding model
+// matches the schema. Embedding columns are resized automatically while they
+// hold no embeddings; otherwise a mismatch is reported as an error. A completed
+// migration away from the configured model takes precedence over it.
+func (s *RAGService) CheckEmbeddingSchema(ctx context.Context) error {
+	// A migration interrupted by a restart cannot be resumed, as its target
+	// embedder only lived in memory
+	if _, err := s.db.ExecContext(ctx, `
+		UPDATE embedding_migrations
+		SET status = 'failed', error = 'interrupted by service restart', updated_at = CURRENT_TIMESTAMP
+		WHERE status = 'running'
+	`); err != nil {
+		return fmt.Errorf("failed to reset interrupted embedding migrations: %w", err)
+	}
+	if err := s.clearStagedEmbeddings(ctx); err != nil {
+		return err
+	}
+
+	if err := s.applyCompletedMigration(ctx); err != nil {
+		return err
+	}
+	embedder := s.currentEmbedder()
+	dimensions := embedder.Dimensions()
+
+	resize := false
+	for _, table := range embeddingTables {
+		// pgvector stores the declared dimension as the column's type modifier
+		var columnDimensions int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT atttypmod FROM pg_attribute
+			WHERE attrelid = $1::regclass AND attname = 'embedding'
+		`, table.name).Scan(&columnDimensions)
+		if err != nil {
+			return fmt.Errorf("failed to read embedding column of %s: %w", table.name, err)
+		}
+		if columnDimensions == dimensions {
+			continue
+		}
+
+		var stored int
+		err = s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE embedding IS NOT NULL`, table.name)).Scan(&stored)
+		if err != nil {
+			return fmt.Errorf("failed to count embeddings in %s: %w", table.name, err)
+		}
+		if stored > 0 {
+			return fmt.Errorf("%s.embedding has %d dimensions but the configured model %s produces %d; "+
+				"set EMBEDDING_DIMENSIONS=%d or migrate the corpus with an embedding migration",
+				table.name, columnDimensions, embedder.Model(), dimensions, columnDimensions)
+		}
+		resize = true
+	}
+
+	if resize {
+		log.Printf("Resizing empty embedding columns to %d dimensions", dimensions)
+		if _, err := s.db.ExecContext(ctx, embeddingResizeSQL(dimensions)); err != nil {
+			return fmt.Errorf("failed to resize embedding columns: %w", err)
+		}
+	}
+
+	for _, table := range embeddingTables {
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT DISTINCT embedding_model, embedding_dimensions
+			FROM %s
+			WHERE embedding_model IS NOT NULL
+		`, table.name))
+		if err != nil {
+			return fmt.Errorf("failed to read embedding models of %s: %w", table.name, err)
+		}
+
+		var mismatches []string
+		for rows.Next() {
+			var model string
+			var modelDimensions int
+			if err := rows.Scan(&model, &modelDimensions); err != nil {
+				rows.Close()
+				return fmt.Errorf("failed to scan embedding model: %w", err)
+			}
+			if model != embedder.Model() || modelDimensions != dimensions {
+				mismatches = append(mismatches, fmt.Sprintf("%s (%d)", model, modelDimensions))
+			}
+		}
+		rows.Close()
+
+		if len(mismatches) > 0 {
+			return fmt.Errorf("%s contains embeddings from %s but the configured model is %s (%d); "+
+				"set EMBEDDING_MODEL accordingly or migrate the corpus with an embedding migration",
+				table.name, strings.Join(mismatches, ", "), embedder.Model(), dimensions)
+		}
+	}
+
+	return nil
+}
+
+// applyCompletedMigration switches to the target model of the latest completed
+// migration when the configuration still names the model it migrated from,
+// and finishes relabelling the stored embeddings if a restart interrupted it
+func (s *RAGService) applyCompletedMigration(ctx context.Context) error {
+	var id, toDimensions int
+	var provider, toModel string
+	var fromModel sql.NullString
+	var fromDimensions sql.NullInt32
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, provider, from_model, from_dimensions, to_model, to_dimensions
+		FROM embedding_migrations
+		WHERE status = 'completed'
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&id, &provider, &fromModel, &fromDimensions, &toModel, &toDimensions)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to read completed embedding migrations: %w", err)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.embedder.Model() == fromModel.String && s.embedder.Dimensions() == int(fromDimensions.Int32) {
+		target, err := NewEmbedder(config.EmbeddingConfig{
+			Provider:   provider,
+			Model:      toModel,
+			Dimensions: toDimensions,
+		}, s.openaiClient)
+		if err != nil {
+			return fmt.Errorf("failed to create the embedder of embedding migration %d: %w", id, err)
+		}
+		log.Printf("Warning: embedding migration %d moved the corpus to %s (%d); set EMBEDDING_MODEL=%s and EMBEDDING_DIMENSIONS=%d",
+			id, toModel, toDimensions, toModel, toDimensions)
+		s.embedder = target
+		s.embeddingProvider = provider
+	}
+
+	if s.embedder.Model() != toModel || s.embedder.Dimensions() != toDimensions {
+		return nil
+	}
+	return s.relabelEmbeddings(ctx, fromModel.String, int(fromDimensions.Int32), s.embedder)
+}
+
+// StartEmbeddingMigration starts a background job that re-embeds every document,
+// chunk and knowledge node with a new model. The current embeddings keep serving
+// queries while the new ones are written to staging columns; new content is
+// written with both models until the job cuts over to the new model.
+func (s *RAGService) StartEmbeddingMigration(ctx context.Context, req *models.StartEmbeddingMigrationRequest) (*models.EmbeddingMigration, error) {
+	if req.Model == "" || req.Dimensions <= 0 {
+		return nil, fmt.Errorf("%w: model and positive dimensions are required", ErrInvalidMigration)
+	}
+	provider := req.Provider
+	if provider == "" {
+		provider = s.embeddingProvider
+	}
+
+	target, err := NewEmbedder(config.EmbeddingConfig{
+		Provider:   provider,
+		Model:      req.Model,
+		Dimensions: req.Dimensions,
+	}, s.openaiClient)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidMigration, err)
+	}
+
+	// Check the target model works before touching any data
+	if _, err := target.Embed(ctx, []string{"embedding migration check"}); err != nil {
+		return nil, fmt.Errorf("%w: target embedding model is not usable: %v", ErrInvalidMigration, err)
+	}
+
+	return s.startEmbeddingMigration(ctx, provider, target)
+}
+
+// startEmbeddingMigration prepares the staging columns for target and starts the migration job
+func (s *RAGService) startEmbeddingMigration(ctx context.Context, provider string, target Embedder) (*models.EmbeddingMigration, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.migration != nil {
+		return nil, fmt.Errorf("%w: migration %d", ErrMigrationRunning, s.migration.id)
+	}
+	current := s.embedder
+	if current.Model() == target.Model() && current.Dimensions() == target.Dimensions() {
+		return nil, fmt.Errorf("%w: the corpus already uses %s (%d)", ErrInvalidMigration, target.Model(), target.Dimensions())
+	}
+
+	total := 0
+	for _, table := range embeddingTables {
+		var count int
+		if err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s`, table.name)).Scan(&count); err != nil {
+			return nil, fmt.Errorf("failed to count rows of %s: %w", table.name, err)
+		}
+		total += count
+	}
+
+	// The staging columns take the target dimensions, so the new index can be
+	// built on them before the cut-over
+	if err := s.recreateStagingColumns(ctx, fmt.Sprintf("vector(%d)", target.Dimensions())); err != nil {
+		return nil, err
+	}
+
+	var migration models.EmbeddingMigration
+	err := s.db.QueryRowContext(ctx, `
+		INSERT INTO embedding_migrations (provider, from_model, from_dimensions, to_model, to_dimensions, total_count)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		RETURNING id, status, created_at, updated_at
+	`, provider, current.Model(), current.Dimensions(), target.Model(), target.Dimensions(), total).Scan(
+		&migration.ID, &migration.Status, &migration.CreatedAt, &migration.UpdatedAt)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create embedding migration: %w", err)
+	}
+	migration.Provider = provider
+	migration.FromModel = current.Model()
+	migration.FromDimensions = current.Dimensions()
+	migration.ToModel = target.Model()
+	migration.ToDimensions = target.Dimensions()
+	migration.TotalCount = total
+
+	// The job outlives the request that started it
+	jobCtx, cancel := context.WithCancel(context.Background())
+	s.migration = &embeddingMigration{
+		id:       migration.ID,
+		from:     current,
+		embedder: target,
+		cancel:   cancel,
+	}
+	go s.runEmbeddingMigration(jobCtx, s.migration)
+
+	log.Printf("Started embedding migration %d: %s (%d) -> %s (%d), %d rows",
+		migration.ID, migration.FromModel, migration.FromDimensions, migration.ToModel, migration.ToDimensions, total)
+	return &migration, nil
+}
+
+// CancelEmbeddingMigration stops the running embedding migration and discards its staged embeddings
+func (s *RAGService) CancelEmbeddingMigration(ctx context.Context) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.migration == nil {
+		return fmt.Errorf("no embedding migration is running")
+	}
+	s.migration.cancel()
+	return nil
+}
+
+// GetEmbeddingMigration returns the most recent embedding migration, or nil if none was started
+func (s *RAGService) GetEmbeddingMigration(ctx context.Context) (*models.EmbeddingMigration, error) {
+	var migration models.EmbeddingMigration
+	var fromModel, errorText sql.NullString
+	var fromDimensions sql.NullInt32
+	var completedAt sql.NullTime
+	err := s.db.QueryRowContext(ctx, `
+		SELECT id, provider, from_model, from_dimensions, to_model, to_dimensions, status,
+			total_count, processed_count, failed_count, error, created_at, updated_at, completed_at
+		FROM embedding_migrations
+		ORDER BY id DESC
+		LIMIT 1
+	`).Scan(&migration.ID, &migration.Provider, &fromModel, &fromDimensions, &migration.ToModel, &migration.ToDimensions,
+		&migration.Status, &migration.TotalCount, &migration.ProcessedCount, &migration.FailedCount, &errorText,
+		&migration.CreatedAt, &migration.UpdatedAt, &completedAt)
+	if err == sql.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get embedding migration: %w", err)
+	}
+
+	migration.FromModel = fromModel.String
+	migration.FromDimensions = int(fromDimensions.Int32)
+	migration.Error = errorText.String
+	if completedAt.Valid {
+		migration.CompletedAt = &completedAt.Time
+	}
+
+	return &migration, nil
+}
+
+// runEmbeddingMigration backfills the staging columns and then cuts over to
+// the new model. Rows whose re-embedding failed are retried by further passes;
+// if some still fail, the migration fails and the current embeddings are kept.
+func (s *RAGService) runEmbeddingMigration(ctx context.Context, m *embeddingMigration) {
+	processed, failed := 0, 0
+	var runErr error
+
+	for attempt := 1; attempt <= migrationAttempts; attempt++ {
+		failed = 0
+		for _, table := range embeddingTables {
+			processed, failed, runErr = s.backfillEmbeddings(ctx, m, table, processed, failed)
+			if runErr != nil {
+				break
+			}
+		}
+		if runErr != nil {
+			break
+		}
+
+		var missing int
+		missing, runErr = s.cutOverEmbeddings(ctx, m, processed)
+		if !errors.Is(runErr, errEmbeddingsNotStaged) {
+			break
+		}
+		failed = missing
+		log.Printf("Embedding migration %d: %v after pass %d", m.id, runErr, attempt)
+	}
+
+	if runErr == nil {
+		// The swapped embeddings still carry the old model's name; a restart
+		// finishes this if it is interrupted
+		if err := s.relabelEmbeddings(context.Background(), m.from.Model(), m.from.Dimensions(), m.embedder); err != nil {
+			log.Printf("Embedding migration %d: %v", m.id, err)
+		}
+		log.Printf("Embedding migration %d completed: %d processed", m.id, processed)
+		log.Printf("Embedding migration %d: set EMBEDDING_MODEL=%s and EMBEDDING_DIMENSIONS=%d",
+			m.id, m.embedder.Model(), m.embedder.Dimensions())
+		return
+	}
+
+	// Status updates use a fresh context as the job context may be cancelled
+	statusCtx := context.Background()
+	status := "failed"
+	if ctx.Err() != nil {
+		status = "cancelled"
+	}
+
+	s.mu.Lock()
+	s.migration = nil
+	s.mu.Unlock()
+
+	if err := s.recreateStagingColumns(statusCtx, "vector"); err != nil {
+		log.Printf("Embedding migration %d: %v", m.id, err)
+	}
+
+	_, err := s.db.ExecContext(statusCtx, `
+		UPDATE embedding_migrations
+		SET status = $1, error = $2, processed_count = $3, failed_count = $4,
+			updated_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $5
+	`, status, runErr.Error(), processed, failed, m.id)
+	if err != nil {
+		log.Printf("Embedding migration %d: failed to update status: %v", m.id, err)
+	}
+
+	log.Printf("Embedding migration %d %s: %d processed, %d failed: %v", m.id, status, processed, failed, runErr)
+}
+
+// backfillEmbeddings writes new-model embeddings for every row of table that
+// does not have one staged yet, returning the updated progress counters.
+// Rows that fail are skipped for the rest of the pass.
+func (s *RAGService) backfillEmbeddings(ctx context.Context, m *embeddingMigration, table embeddingTable, processed, failed int) (int, int, error) {
+	lastID := 0
+	for {
+		if err := ctx.Err(); err != nil {
+			return processed, failed, err
+		}
+
+		rows, err := s.db.QueryContext(ctx, fmt.Sprintf(`
+			SELECT id, COALESCE(%s, '')
+			FROM %s
+			WHERE id > $1 AND embedding_next IS NULL
+			ORDER BY id
+			LIMIT $2
+		`, table.textColumn, table.name), lastID, migrationBatchSize)
+		if err != nil {
+			return processed, failed, fmt.Errorf("failed to read %s: %w", table.name, err)
+		}
+
+		var ids []int
+		var texts []string
+		for rows.Next() {
+			var id int
+			var text string
+			if err := rows.Scan(&id, &text); err != nil {
+				rows.Close()
+				return processed, failed, fmt.Errorf("failed to scan %s row: %w", table.name, err)
+			}
+			ids = append(ids, id)
+			texts = append(texts, text)
+		}
+		rows.Close()
+
+		if len(ids) == 0 {
+			return processed, failed, nil
+		}
+		lastID = ids[len(ids)-1]
+
+		embeddings := s.embedTexts(ctx, m.embedder, texts)
+		var placeholders []string
+		var args []interface{}
+		for i, embedding := range embeddings {
+			if embedding == nil {
+				failed++
+				continue
+			}
+			n := len(args)
+			placeholders = append(placeholders, fmt.Sprintf("($%d::integer, $%d::vector)", n+1, n+2))
+			args = append(args, ids[i], pgvector.NewVector(embedding))
+		}
+
+		if len(placeholders) > 0 {
+			_, err = s.db.ExecContext(ctx, fmt.Sprintf(`
+				UPDATE %s AS t
+				SET embedding_next = v.embedding
+				FROM (VALUES %s) AS v(id, embedding)
+				WHERE t.id = v.id
+			`, table.name, strings.Join(placeholders, ", ")), args...)
+			if err != nil {
+				return processed, failed, fmt.Errorf("failed to stage embeddings for %s: %w", table.name, err)
+			}
+		}
+		processed += len(placeholders)
+
+		_, err = s.db.ExecContext(ctx, `
+			UPDATE embedding_migrations
+			SET processed_count = $1, failed_count = $2, updated_at = CURRENT_TIMESTAMP
+			WHERE id = $3
+		`, processed, failed, m.id)
+		if err != nil {
+			log.Printf("Embedding migration %d: failed to update progress: %v", m.id, err)
+		}
+	}
+}
+
+// cutOverEmbeddings swaps the staged embeddings into the live columns, marks
+// the migration completed and switches the service to the new model. The new
+// indexes are built concurrently beforehand, so the swap itself only renames
+// columns and holds its locks briefly. If embedded rows lack a staged embedding
+// nothing is changed and their number is returned with errEmbeddingsNotStaged.
+func (s *RAGService) cutOverEmbeddings(ctx context.Context, m *embeddingMigration, processed int) (int, error) {
+	for _, table := range embeddingTables {
+		// CREATE INDEX CONCURRENTLY cannot run in a transaction, so each statement runs on its own
+		if _, err := s.db.ExecContext(ctx, fmt.Sprintf(`DROP INDEX IF EXISTS %s_next`, table.index)); err != nil {
+			return 0, fmt.Errorf("failed to drop staging index of %s: %w", table.name, err)
+		}
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`CREATE INDEX CONCURRENTLY %s_next ON %s USING ivfflat (embedding_next vector_cosine_ops)`,
+			table.index, table.name))
+		if err != nil {
+			return 0, fmt.Errorf("failed to index staged embeddings of %s: %w", table.name, err)
+		}
+	}
+
+	s.cutoverMu.Lock()
+	defer s.cutoverMu.Unlock()
+
+	// Content stored since the last pass must have been staged too
+	missing := 0
+	for _, table := range embeddingTables {
+		var count int
+		err := s.db.QueryRowContext(ctx, fmt.Sprintf(`SELECT COUNT(*) FROM %s WHERE embedding IS NOT NULL AND embedding_next IS NULL`,
+			table.name)).Scan(&count)
+		if err != nil {
+			return 0, fmt.Errorf("failed to count unstaged embeddings of %s: %w", table.name, err)
+		}
+		missing += count
+	}
+	if missing > 0 {
+		return missing, fmt.Errorf("%w: %d rows", errEmbeddingsNotStaged, missing)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("failed to begin cut-over: %w", err)
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, embeddingSwapSQL()); err != nil {
+		return 0, fmt.Errorf("failed to cut over embeddings: %w", err)
+	}
+	// Completing the migration in the same transaction records the switch for restarts
+	_, err = tx.ExecContext(ctx, `
+		UPDATE embedding_migrations
+		SET status = 'completed', error = NULL, processed_count = $1, failed_count = 0,
+			updated_at = CURRENT_TIMESTAMP, completed_at = CURRENT_TIMESTAMP
+		WHERE id = $2
+	`, processed, m.id)
+	if err != nil {
+		return 0, fmt.Errorf("failed to complete embedding migration: %w", err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("failed to commit cut-over: %w", err)
+	}
+
+	s.mu.Lock()
+	s.embedder = m.embedder
+	s.migration = nil
+	s.mu.Unlock()
+	return 0, nil
+}
+
+// relabelEmbeddings records to as the model of the stored embeddings that
+// carry the from model, or none, after a cut-over from it
+func (s *RAGService) relabelEmbeddings(ctx context.Context, fromModel string, fromDimensions int, to Embedder) error {
+	for _, table := range embeddingTables {
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`
+			UPDATE %s SET embedding_model = $1, embedding_dimensions = $2
+			WHERE embedding IS NOT NULL
+				AND (embedding_model IS NULL OR (embedding_model = $3 AND embedding_dimensions = $4))
+		`, table.name), to.Model(), to.Dimensions(), fromModel, fromDimensions)
+		if err != nil {
+			return fmt.Errorf("failed to relabel embeddings of %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// embeddingSwapSQL builds the statements that replace every embedding column
+// with its staging column and the index built on it, then add an empty
+// staging column. Renames and dropping a column only change the catalog, so
+// the statements do not rewrite the tables.
+func embeddingSwapSQL() string {
+	var b strings.Builder
+	for _, table := range embeddingTables {
+		fmt.Fprintf(&b, "ALTER TABLE %s RENAME COLUMN embedding TO embedding_previous;\n", table.name)
+		fmt.Fprintf(&b, "ALTER TABLE %s RENAME COLUMN embedding_next TO embedding;\n", table.name)
+		fmt.Fprintf(&b, "ALTER TABLE %s DROP COLUMN embedding_previous;\n", table.name)
+		fmt.Fprintf(&b, "ALTER INDEX %s_next RENAME TO %s;\n", table.index, table.index)
+		fmt.Fprintf(&b, "ALTER TABLE %s ADD COLUMN embedding_next vector;\n", table.name)
+	}
+	return b.String()
+}
+
+// embeddingResizeSQL builds the statements that retype every empty embedding
+// column to dimensions. The statements run as a single simple query without
+// parameters, which PostgreSQL executes in one implicit transaction.
+func embeddingResizeSQL(dimensions int) string {
+	var b strings.Builder
+	for _, table := range embeddingTables {
+		fmt.Fprintf(&b, "DROP INDEX IF EXISTS %s;\n", table.index)
+		fmt.Fprintf(&b, "ALTER TABLE %s ALTER COLUMN embedding TYPE vector(%d) USING NULL::vector(%d);\n", table.name, dimensions, dimensions)
+		fmt.Fprintf(&b, "UPDATE %s SET embedding_model = NULL, embedding_dimensions = NULL WHERE embedding_model IS NOT NULL;\n", table.name)
+		fmt.Fprintf(&b, "CREATE INDEX IF NOT EXISTS %s ON %s USING ivfflat (embedding vector_cosine_ops);\n",
+			table.index, table.name)
+	}
+	return b.String()
+}
+
+// recreateStagingColumns replaces every staging column with an empty one of
+// columnType, discarding staged embeddings and any index built on them
+func (s *RAGService) recreateStagingColumns(ctx context.Context, columnType string) error {
+	for _, table := range embeddingTables {
+		_, err := s.db.ExecContext(ctx, fmt.Sprintf(`ALTER TABLE %s DROP COLUMN IF EXISTS embedding_next, ADD COLUMN embedding_next %s`,
+			table.name, columnType))
+		if err != nil {
+			return fmt.Errorf("failed to recreate staging column of %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// clearStagedEmbeddings discards embeddings staged by an unfinished migration.
+// Staging columns left typed by one are recreated untyped.
+func (s *RAGService) clearStagedEmbeddings(ctx context.Context) error {
+	for _, table := range embeddingTables {
+		var stagingDimensions int
+		err := s.db.QueryRowContext(ctx, `
+			SELECT atttypmod FROM pg_attribute
+			WHERE attrelid = $1::regclass AND attname = 'embedding_next'
+		`, table.name).Scan(&stagingDimensions)
+		if err != nil {
+			return fmt.Errorf("failed to read staging column of %s: %w", table.name, err)
+		}
+		if stagingDimensions > 0 {
+			return s.recreateStagingColumns(ctx, "vector")
+		}
+
+		_, err = s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET embedding_next = NULL WHERE embedding_next IS NOT NULL`, table.name))
+		if err != nil {
+			return fmt.Errorf("failed to clear staged embeddings of %s: %w", table.name, err)
+		}
+	}
+	return nil
+}
+
+// stageEmbedding writes the new-model embedding of a single row while a
+// migration is running, so content ingested mid-migration is not left behind
+func (s *RAGService) stageEmbedding(ctx context.Context, table string, id int, text string) {
+	m := s.activeMigration()
+	if m == nil {
+		return
+	}
+
+	embeddings := s.embedTexts(ctx, m.embedder, []string{text})
+	if embeddings[0] == nil {
+		log.Printf("Warning: failed to stage migration embedding for %s %d", table, id)
+		return
+	}
+
+	_, err := s.db.ExecContext(ctx, fmt.Sprintf(`UPDATE %s SET embedding_next = $1 WHERE id = $2`, table), pgvector.NewVector(embeddings[0]), id)
+	if err != nil {
+		log.Printf("Warning: failed to stage migration embedding for %s %d: %v", table, id, err)
+	}
+}
@@ -0,0 +1,35 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStartEmbeddingMigration_Rejected(t *testing.T) {
+	s := NewRAGService(nil, "", "", "")
+	ctx := context.Background()
+
+	for name, req := range map[string]*models.StartEmbeddingMigrationRequest{
+		"missing model":    {Dimensions: 8},
+		"zero dimensions":  {Model: "hash"},
+		"unknown provider": {Provider: "carrier-pigeon", Model: "hash", Dimensions: 8},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.StartEmbeddingMigration(ctx, req)
+			assert.True(t, errors.Is(err, ErrInvalidMigration), "expected ErrInvalidMigration, got %v", err)
+		})
+	}
+
+	// Neither check reaches the database
+	_, err := s.startEmbeddingMigration(ctx, "hash", NewHashEmbedder(1536))
+	assert.True(t, errors.Is(err, ErrInvalidMigration), "expected ErrInvalidMigration, got %v", err)
+
+	s.migration = &embeddingMigration{id: 3}
+	_, err = s.startEmbeddingMigration(ctx, "hash", NewHashEmbedder(8))
+	assert.True(t, errors.Is(err, ErrMigrationRunning), "expected ErrMigrationRunning, got %v", err)
+}
@@ -0,0 +1,655 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+	"unicode"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrNodeNotFound is returned for knowledge node IDs that do not exist
+var ErrNodeNotFound = errors.New("knowledge node not found")
+
+// ErrMergeProposalNotFound is returned for merge proposal IDs that do not exist
+var ErrMergeProposalNotFound = errors.New("merge proposal not found")
+
+// ErrInvalidResolution is returned for merges and splits that cannot be made
+var ErrInvalidResolution = errors.New("invalid entity resolution request")
+
+// Merge proposal statuses
+const (
+	MergeStatusPending  = "pending"
+	MergeStatusAccepted = "accepted"
+	MergeStatusRejected = "rejected"
+)
+
+// Reasons a merge is proposed for
+const (
+	mergeReasonName      = "normalized_name"
+	mergeReasonEmbedding = "embedding"
+)
+
+// execQueryer runs statements on the database or within one of its transactions
+type execQueryer interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// resolutionNeighbors is the number of nearest nodes each node is compared with
+const resolutionNeighbors = 5
+
+// nodeAliasesSQL selects the aliases of the knowledge node kn
+const nodeAliasesSQL = `ARRAY(SELECT a.alias FROM node_aliases a WHERE a.node_id = kn.id ORDER BY a.alias)`
+
+// resolutionNode is a knowledge node considered by entity resolution
+type resolutionNode struct {
+	id       int
+	name     string
+	nodeType string
+	mentions int
+}
+
+// similarPair is a pair of nodes whose embeddings are close
+type similarPair struct {
+	a, b     int
+	distance float64
+}
+
+// normalizeEntityName reduces an entity name to a key that spellings of the
+// same name share: lowercase letters and digits only, without trailing
+// suffixes such as "Inc". "OpenAI", "OpenAI Inc." and "Open AI" all
+// normalize to "openai".
+func normalizeEntityName(name string, suffixes []string) string {
+	words := strings.FieldsFunc(strings.ToLower(name), func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	suffix := make(map[string]bool, len(suffixes))
+	for _, s := range suffixes {
+		suffix[strings.ToLower(s)] = true
+	}
+	for len(words) > 1 && suffix[words[len(words)-1]] {
+		words = words[:len(words)-1]
+	}
+
+	return strings.Join(words, "")
+}
+
+// preferredNode reports whether a should absorb b in a merge: the node
+// mentioned by more documents, or else the older one
+func preferredNode(a, b resolutionNode) bool {
+	if a.mentions != b.mentions {
+		return a.mentions > b.mentions
+	}
+	return a.id < b.id
+}
+
+// proposeMerges proposes merging nodes with the same normalized name, and
+// nodes with close embeddings, into the preferred node of each pair. With
+// sameType only nodes of the same type are merged. Proposals are ordered by
+// target and then source.
+func proposeMerges(nodes []resolutionNode, similar []similarPair, suffixes []string, sameType bool) []models.MergeProposal {
+	byID := make(map[int]resolutionNode, len(nodes))
+	for _, n := range nodes {
+		byID[n.id] = n
+	}
+
+	type pairKey struct{ source, target int }
+	proposals := make(map[pairKey]*models.MergeProposal)
+	propose := func(a, b resolutionNode, reason string) *models.MergeProposal {
+		if sameType && a.nodeType != b.nodeType {
+			return nil
+		}
+		if preferredNode(a, b) {
+			a, b = b, a
+		}
+		key := pairKey{source: a.id, target: b.id}
+		p, ok := proposals[key]
+		if !ok {
+			p = &models.MergeProposal{SourceID: a.id, SourceName: a.name, TargetID: b.id, TargetName: b.name, Status: MergeStatusPending}
+			proposals[key] = p
+		}
+		for _, r := range p.Reasons {
+			if r == reason {
+				return p
+			}
+		}
+		p.Reasons = append(p.Reasons, reason)
+		return p
+	}
+
+	// Nodes sharing a normalized name are merged into the preferred one
+	groups := make(map[string][]resolutionNode)
+	var keys []string
+	for _, n := range nodes {
+		key := normalizeEntityName(n.name, suffixes)
+		if key == "" {
+			continue
+		}
+		if sameType {
+			key = n.nodeType + "\x00" + key
+		}
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], n)
+	}
+	for _, key := range keys {
+		group := groups[key]
+		if len(group) < 2 {
+			continue
+		}
+		canonical := group[0]
+		for _, n := range group[1:] {
+			if preferredNode(n, canonical) {
+				canonical = n
+			}
+		}
+		for _, n := range group {
+			if n.id != canonical.id {
+				propose(n, canonical, mergeReasonName)
+			}
+		}
+	}
+
+	for _, pair := range similar {
+		a, okA := byID[pair.a]
+		b, okB := byID[pair.b]
+		if !okA || !okB || a.id == b.id {
+			continue
+		}
+		if p := propose(a, b, mergeReasonEmbedding); p != nil {
+			similarity := 1 - pair.distance
+			if p.Similarity == nil || similarity > *p.Similarity {
+				p.Similarity = &similarity
+			}
+		}
+	}
+
+	result := make([]models.MergeProposal, 0, len(proposals))
+	for _, p := range proposals {
+		result = append(result, *p)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].TargetID != result[j].TargetID {
+			return result[i].TargetID < result[j].TargetID
+		}
+		return result[i].SourceID < result[j].SourceID
+	})
+	return result
+}
+
+// ResolveEntities runs an entity resolution pass over the knowledge graph and
+// stores a pending proposal for every pair of nodes that seem to name the same
+// entity. Pairs that were proposed before, whatever the decision, are not
+// proposed again. The new proposals are returned.
+func (s *RAGService) ResolveEntities(ctx context.Context) (*models.EntityResolutionResult, error) {
+	nodes, err := s.resolutionNodes(ctx)
+	if err != nil {
+		return nil, err
+	}
+	similar, err := s.similarNodePairs(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &models.EntityResolutionResult{Proposals: []models.MergeProposal{}}
+	for _, p := range proposeMerges(nodes, similar, s.resolution.NameSuffixes, s.resolution.SameType) {
+		var similarity sql.NullFloat64
+		if p.Similarity != nil {
+			similarity = sql.NullFloat64{Float64: *p.Similarity, Valid: true}
+		}
+		err := s.db.QueryRowContext(ctx, `
+			INSERT INTO entity_merge_proposals (source_id, source_name, target_id, target_name, similarity, reasons)
+			SELECT $1::integer, $2::text, $3::integer, $4::text, $5::float8, $6::text[]
+			WHERE NOT EXISTS (
+				SELECT 1 FROM entity_merge_proposals p
+				WHERE (p.source_id = $1 AND p.target_id = $3) OR (p.source_id = $3 AND p.target_id = $1)
+			)
+			RETURNING id, created_at
+		`, p.SourceID, p.SourceName, p.TargetID, p.TargetName, similarity, pq.Array(p.Reasons)).Scan(&p.ID, &p.CreatedAt)
+		if err == sql.ErrNoRows {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to store merge proposal: %w", err)
+		}
+		result.Proposals = append(result.Proposals, p)
+	}
+
+	log.Printf("Entity resolution proposed %d merges", len(result.Proposals))
+	return result, nil
+}
+
+// resolutionNodes loads every knowledge node with the number of documents mentioning it
+func (s *RAGService) resolutionNodes(ctx context.Context) ([]resolutionNode, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT kn.id, kn.name, kn.type,
+			(SELECT COUNT(DISTINCT m.document_id) FROM node_mentions m WHERE m.node_id = kn.id)
+		FROM knowledge_nodes kn
+		ORDER BY kn.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []resolutionNode
+	for rows.Next() {
+		var n resolutionNode
+		if err := rows.Scan(&n.id, &n.name, &n.nodeType, &n.mentions); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		nodes = append(nodes, n)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+	return nodes, nil
+}
+
+// similarNodePairs returns the pairs of nodes whose embeddings are within the
+// configured distance, comparing each node with its nearest neighbours
+func (s *RAGService) similarNodePairs(ctx context.Context) ([]similarPair, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT a.id, n.id, n.distance
+		FROM knowledge_nodes a
+		CROSS JOIN LATERAL (
+			SELECT b.id, a.embedding <=> b.embedding AS distance
+			FROM knowledge_nodes b
+			WHERE b.id <> a.id AND b.embedding IS NOT NULL
+			  AND (NOT $2::boolean OR b.type = a.type)
+			ORDER BY a.embedding <=> b.embedding, b.id
+			LIMIT $3
+		) n
+		WHERE a.embedding IS NOT NULL AND n.distance < $1::float8
+		ORDER BY a.id, n.distance
+	`, s.resolution.MaxDistance, s.resolution.SameType, resolutionNeighbors)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compare knowledge node embeddings: %w", err)
+	}
+	defer rows.Close()
+
+	var pairs []similarPair
+	for rows.Next() {
+		var p similarPair
+		if err := rows.Scan(&p.a, &p.b, &p.distance); err != nil {
+			return nil, fmt.Errorf("failed to scan similar nodes: %w", err)
+		}
+		pairs = append(pairs, p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating similar node rows: %w", err)
+	}
+	return pairs, nil
+}
+
+// ListMergeProposals returns the merge proposals with the given status, or
+// all of them for an empty status, newest first
+func (s *RAGService) ListMergeProposals(ctx context.Context, status string) ([]models.MergeProposal, error) {
+	switch status {
+	case "", MergeStatusPending, MergeStatusAccepted, MergeStatusRejected:
+	default:
+		return nil, fmt.Errorf("%w: status must be one of: %s, %s, %s", ErrInvalidResolution, MergeStatusPending, MergeStatusAccepted, MergeStatusRejected)
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, source_id, source_name, target_id, target_name, similarity, reasons, status, created_at, decided_at
+		FROM entity_merge_proposals
+		WHERE $1 = '' OR status = $1
+		ORDER BY created_at DESC, id DESC
+	`, status)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query merge proposals: %w", err)
+	}
+	defer rows.Close()
+
+	proposals := []models.MergeProposal{}
+	for rows.Next() {
+		p, err := scanMergeProposal(rows)
+		if err != nil {
+			return nil, err
+		}
+		proposals = append(proposals, *p)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating merge proposal rows: %w", err)
+	}
+	return proposals, nil
+}
+
+// scanMergeProposal scans a merge proposal row selected by ListMergeProposals
+func scanMergeProposal(row interface{ Scan(...interface{}) error }) (*models.MergeProposal, error) {
+	var p models.MergeProposal
+	var similarity sql.NullFloat64
+	var decidedAt sql.NullTime
+	var reasons pq.StringArray
+	err := row.Scan(&p.ID, &p.SourceID, &p.SourceName, &p.TargetID, &p.TargetName, &similarity, &reasons, &p.Status, &p.CreatedAt, &decidedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMergeProposalNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to scan merge proposal: %w", err)
+	}
+	if similarity.Valid {
+		p.Similarity = &similarity.Float64
+	}
+	if decidedAt.Valid {
+		p.DecidedAt = &decidedAt.Time
+	}
+	p.Reasons = []string(reasons)
+	if p.Reasons == nil {
+		p.Reasons = []string{}
+	}
+	return &p, nil
+}
+
+// AcceptMergeProposal merges the source node of a pending proposal into its
+// target and returns the merged node
+func (s *RAGService) AcceptMergeProposal(ctx context.Context, id int) (*models.KnowledgeNodeResponse, error) {
+	p, err := scanMergeProposal(s.db.QueryRowContext(ctx, `
+		SELECT id, source_id, source_name, target_id, target_name, similarity, reasons, status, created_at, decided_at
+		FROM entity_merge_proposals
+		WHERE id = $1
+	`, id))
+	if err != nil {
+		return nil, err
+	}
+	if p.Status != MergeStatusPending {
+		return nil, fmt.Errorf("%w: merge proposal %d is %s", ErrInvalidResolution, id, p.Status)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	// Decide first, so that the merge does not discard the proposal with the
+	// other pending proposals of the source node. Both are rolled back together.
+	if err := s.decideMergeProposal(ctx, tx, id, MergeStatusAccepted); err != nil {
+		return nil, err
+	}
+	if err := s.mergeNodes(ctx, tx, p.TargetID, []int{p.SourceID}); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return s.GetKnowledgeNode(ctx, p.TargetID)
+}
+
+// RejectMergeProposal rejects a pending proposal. Rejected pairs are not proposed again.
+func (s *RAGService) RejectMergeProposal(ctx context.Context, id int) error {
+	return s.decideMergeProposal(ctx, s.db, id, MergeStatusRejected)
+}
+
+// decideMergeProposal records the decision on a pending proposal
+func (s *RAGService) decideMergeProposal(ctx context.Context, q execQueryer, id int, status string) error {
+	result, err := q.ExecContext(ctx, `
+		UPDATE entity_merge_proposals
+		SET status = $2, decided_at = CURRENT_TIMESTAMP
+		WHERE id = $1 AND status = $3
+	`, id, status, MergeStatusPending)
+	if err != nil {
+		return fmt.Errorf("failed to update merge proposal: %w", err)
+	}
+	if n, err := result.RowsAffected(); err == nil && n == 0 {
+		var current string
+		err := q.QueryRowContext(ctx, `SELECT status FROM entity_merge_proposals WHERE id = $1`, id).Scan(&current)
+		if err == sql.ErrNoRows {
+			return ErrMergeProposalNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("failed to get merge proposal: %w", err)
+		}
+		return fmt.Errorf("%w: merge proposal %d is %s", ErrInvalidResolution, id, current)
+	}
+	return nil
+}
+
+// MergeNodes merges the source nodes into the target node. The names of the
+// sources become aliases of the target, which also takes over their mentions
+// and edges; edges the target already has and edges between the merged nodes
+// are dropped. The merge runs in a single transaction. The merged node is returned.
+func (s *RAGService) MergeNodes(ctx context.Context, targetID int, sourceIDs []int) (*models.KnowledgeNodeResponse, error) {
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin merge: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := s.mergeNodes(ctx, tx, targetID, sourceIDs); err != nil {
+		return nil, err
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit merge: %w", err)
+	}
+	return s.GetKnowledgeNode(ctx, targetID)
+}
+
+// mergeNodes checks and merges the source nodes into the target node within tx
+func (s *RAGService) mergeNodes(ctx context.Context, tx *sql.Tx, targetID int, sourceIDs []int) error {
+	if len(sourceIDs) == 0 {
+		return fmt.Errorf("%w: source nodes are required", ErrInvalidResolution)
+	}
+	seen := make(map[int]bool)
+	for _, id := range sourceIDs {
+		if id == targetID || seen[id] {
+			return fmt.Errorf("%w: source nodes must be distinct from each other and from the target", ErrInvalidResolution)
+		}
+		seen[id] = true
+	}
+
+	if _, err := s.GetKnowledgeNode(ctx, targetID); err != nil {
+		return err
+	}
+	sources := make([]*models.KnowledgeNodeResponse, len(sourceIDs))
+	for i, id := range sourceIDs {
+		source, err := s.GetKnowledgeNode(ctx, id)
+		if err != nil {
+			return err
+		}
+		sources[i] = source
+	}
+
+	for _, source := range sources {
+		if err := mergeNode(ctx, tx, targetID, source); err != nil {
+			return err
+		}
+		log.Printf("Merging knowledge node %d (%s) into %d", source.ID, source.Name, targetID)
+	}
+	return nil
+}
+
+// mergeNode merges a single source node into the target node within tx
+func mergeNode(ctx context.Context, tx *sql.Tx, targetID int, source *models.KnowledgeNodeResponse) error {
+	steps := []struct {
+		description string
+		query       string
+		args        []interface{}
+	}{
+		{"move aliases", `UPDATE node_aliases SET node_id = $1 WHERE node_id = $2`, []interface{}{targetID, source.ID}},
+		{"store alias", `
+			INSERT INTO node_aliases (node_id, alias, type)
+			VALUES ($1, $2, $3)
+			ON CONFLICT (alias, type) DO UPDATE SET node_id = EXCLUDED.node_id
+		`, []interface{}{targetID, source.Name, source.Type}},
+		{"move mentions", `
+			INSERT INTO node_mentions (node_id, document_id, chunk_id, start_position, end_position, created_at)
+			SELECT $1, document_id, chunk_id, start_position, end_position, created_at
+			FROM node_mentions WHERE node_id = $2
+			ON CONFLICT DO NOTHING
+		`, []interface{}{targetID, source.ID}},
+		{"re-point outgoing edges", `
+			UPDATE knowledge_edges e SET source_id = $1
+			WHERE e.source_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM knowledge_edges x
+				WHERE x.source_id = $1 AND x.target_id = e.target_id AND x.relationship_type = e.relationship_type
+			)
+		`, []interface{}{targetID, source.ID}},
+		{"re-point incoming edges", `
+			UPDATE knowledge_edges e SET target_id = $1
+			WHERE e.target_id = $2 AND NOT EXISTS (
+				SELECT 1 FROM knowledge_edges x
+				WHERE x.source_id = e.source_id AND x.target_id = $1 AND x.relationship_type = e.relationship_type
+			)
+		`, []interface{}{targetID, source.ID}},
+		{"move edge mentions", `
+			INSERT INTO edge_mentions (edge_id, document_id, created_at)
+			SELECT x.id, m.document_id, m.created_at
+			FROM knowledge_edges e
+			JOIN edge_mentions m ON m.edge_id = e.id
+			JOIN knowledge_edges x ON x.relationship_type = e.relationship_type
+				AND x.source_id = CASE WHEN e.source_id = $2 THEN $1 ELSE e.source_id END
+				AND x.target_id = CASE WHEN e.target_id = $2 THEN $1 ELSE e.target_id END
+			WHERE (e.source_id = $2 OR e.target_id = $2) AND x.id <> e.id
+			ON CONFLICT DO NOTHING
+		`, []interface{}{targetID, source.ID}},
+		{"delete duplicate edges", `
+			DELETE FROM knowledge_edges WHERE source_id = $2 OR target_id = $2 OR (source_id = $1 AND target_id = $1)
+		`, []interface{}{targetID, source.ID}},
+		{"keep document", `
+			UPDATE knowledge_nodes SET document_id = COALESCE(document_id, $2) WHERE id = $1
+		`, []interface{}{targetID, source.DocumentID}},
+		{"discard pending proposals", `
+			DELETE FROM entity_merge_proposals WHERE status = $2 AND (source_id = $1 OR target_id = $1)
+		`, []interface{}{source.ID, MergeStatusPending}},
+		{"delete node", `DELETE FROM knowledge_nodes WHERE id = $1`, []interface{}{source.ID}},
+	}
+
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return fmt.Errorf("failed to %s of node %d: %w", step.description, source.ID, err)
+		}
+	}
+	return nil
+}
+
+// splitEdgeSQL matches the edges e that the documents $3 support and no other document does
+const splitEdgeSQL = `EXISTS (SELECT 1 FROM edge_mentions m WHERE m.edge_id = e.id AND m.document_id = ANY($3))
+			AND NOT EXISTS (SELECT 1 FROM edge_mentions m WHERE m.edge_id = e.id AND m.document_id <> ALL($3))`
+
+// SplitNode splits a new node off a knowledge node, undoing a wrong merge or
+// separating two entities that share a name. The new node takes over the
+// mentions of the given documents, the edges only they support, and the alias
+// of its name if the node has one. The split runs in a single transaction.
+// The new node is returned.
+func (s *RAGService) SplitNode(ctx context.Context, id int, req *models.SplitNodeRequest) (*models.KnowledgeNodeResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, fmt.Errorf("%w: name is required", ErrInvalidResolution)
+	}
+
+	node, err := s.GetKnowledgeNode(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	nodeType := req.Type
+	if nodeType == "" {
+		nodeType = node.Type
+	}
+
+	documents := make([]int64, len(req.DocumentIDs))
+	var documentID interface{}
+	for i, d := range req.DocumentIDs {
+		documents[i] = int64(d)
+	}
+	if len(documents) > 0 {
+		documentID = req.DocumentIDs[0]
+	}
+
+	release := s.holdCutover()
+	defer release()
+
+	embedding, err := s.generateCachedEmbedding(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to generate embedding for node %s: %w", name, err)
+	}
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin split: %w", err)
+	}
+	defer tx.Rollback()
+
+	embedder := s.currentEmbedder()
+	var newID int
+	err = tx.QueryRowContext(ctx, `
+		INSERT INTO knowledge_nodes (name, type, properties, embedding, embedding_model, embedding_dimensions, document_id)
+		VALUES ($1, $2, jsonb_build_object('split_from', $3::integer), $4, $5, $6, $7)
+		ON CONFLICT (name, type) DO NOTHING
+		RETURNING id
+	`, name, nodeType, id, embedding, embedder.Model(), embedder.Dimensions(), documentID).Scan(&newID)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: a node named %q of type %s exists", ErrInvalidResolution, name, nodeType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to create knowledge node: %w", err)
+	}
+
+	steps := []struct {
+		description string
+		query       string
+		args        []interface{}
+	}{
+		{"move mentions", `
+			UPDATE node_mentions SET node_id = $1 WHERE node_id = $2 AND document_id = ANY($3)
+		`, []interface{}{newID, id, pq.Array(documents)}},
+		{"re-point outgoing edges", `
+			UPDATE knowledge_edges e SET source_id = $1
+			WHERE e.source_id = $2 AND ` + splitEdgeSQL + `
+		`, []interface{}{newID, id, pq.Array(documents)}},
+		{"re-point incoming edges", `
+			UPDATE knowledge_edges e SET target_id = $1
+			WHERE e.target_id = $2 AND ` + splitEdgeSQL + `
+		`, []interface{}{newID, id, pq.Array(documents)}},
+		{"remove alias", `
+			DELETE FROM node_aliases WHERE node_id = $1 AND alias = $2 AND type = $3
+		`, []interface{}{id, name, nodeType}},
+		{"reassign document", `
+			UPDATE knowledge_nodes kn SET document_id = (
+				SELECT MIN(m.document_id) FROM node_mentions m WHERE m.node_id = kn.id
+			)
+			WHERE kn.id = $1 AND kn.document_id = ANY($2)
+		`, []interface{}{id, pq.Array(documents)}},
+	}
+	for _, step := range steps {
+		if _, err := tx.ExecContext(ctx, step.query, step.args...); err != nil {
+			return nil, fmt.Errorf("failed to %s of node %d: %w", step.description, id, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return nil, fmt.Errorf("failed to commit split: %w", err)
+	}
+	s.stageEmbedding(ctx, "knowledge_nodes", newID, name)
+
+	log.Printf("Split knowledge node %d (%s) off node %d", newID, name, id)
+	return s.GetKnowledgeNode(ctx, newID)
+}
+
+// GetKnowledgeNode retrieves a knowledge node with its documents and aliases
+func (s *RAGService) GetKnowledgeNode(ctx context.Context, id int) (*models.KnowledgeNodeResponse, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+knowledgeNodeColumns+`
+		FROM knowledge_nodes kn
+		LEFT JOIN documents d ON kn.document_id = d.id
+		WHERE kn.id = $1
+	`, id)
+	node, err := scanKnowledgeNode(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, id)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get knowledge node: %w", err)
+	}
+	return &node, nil
+}
@@ -0,0 +1,65 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNormalizeEntityName(t *testing.T) {
+	suffixes := []string{"inc", "corp"}
+
+	assert.Equal(t, "openai", normalizeEntityName("OpenAI", suffixes))
+	assert.Equal(t, "openai", normalizeEntityName("OpenAI Inc.", suffixes))
+	assert.Equal(t, "openai", normalizeEntityName("Open AI", suffixes))
+	assert.Equal(t, "openai", normalizeEntityName("open-ai, corp", suffixes))
+	// A suffix on its own is a name
+	assert.Equal(t, "inc", normalizeEntityName("Inc", suffixes))
+	assert.Equal(t, "", normalizeEntityName("--", suffixes))
+}
+
+func TestProposeMerges(t *testing.T) {
+	nodes := []resolutionNode{
+		{id: 1, name: "OpenAI Inc", nodeType: "organization", mentions: 1},
+		{id: 2, name: "OpenAI", nodeType: "organization", mentions: 3},
+		{id: 3, name: "Open AI", nodeType: "organization", mentions: 1},
+		{id: 4, name: "OpenAI", nodeType: "concept", mentions: 5},
+		{id: 5, name: "Anthropic", nodeType: "organization", mentions: 2},
+		{id: 6, name: "Anthropic PBC", nodeType: "organization", mentions: 1},
+	}
+	similar := []similarPair{
+		{a: 6, b: 5, distance: 0.05},
+		{a: 5, b: 6, distance: 0.05},
+		{a: 3, b: 2, distance: 0.08},
+	}
+
+	proposals := proposeMerges(nodes, similar, []string{"inc"}, true)
+
+	require.Len(t, proposals, 3)
+	// Nodes of the same type and normalized name merge into the most mentioned one
+	assert.Equal(t, 1, proposals[0].SourceID)
+	assert.Equal(t, 2, proposals[0].TargetID)
+	assert.Equal(t, []string{mergeReasonName}, proposals[0].Reasons)
+	assert.Nil(t, proposals[0].Similarity)
+
+	assert.Equal(t, 3, proposals[1].SourceID)
+	assert.Equal(t, 2, proposals[1].TargetID)
+	assert.Equal(t, []string{mergeReasonName, mergeReasonEmbedding}, proposals[1].Reasons)
+	require.NotNil(t, proposals[1].Similarity)
+	assert.InDelta(t, 0.92, *proposals[1].Similarity, 1e-9)
+
+	// Close embeddings alone propose a merge, once per pair
+	assert.Equal(t, 6, proposals[2].SourceID)
+	assert.Equal(t, 5, proposals[2].TargetID)
+	assert.Equal(t, "Anthropic PBC", proposals[2].SourceName)
+	assert.Equal(t, "Anthropic", proposals[2].TargetName)
+	assert.Equal(t, MergeStatusPending, proposals[2].Status)
+
+	// Without the same type rule the concept absorbs the organizations
+	proposals = proposeMerges(nodes, nil, []string{"inc"}, false)
+	require.Len(t, proposals, 3)
+	for _, p := range proposals {
+		assert.Equal(t, 4, p.TargetID)
+	}
+}
@@ -0,0 +1,84 @@
+package service
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+
+	"rag-data-service/models"
+)
+
+// stageTimer records how long each stage of a query takes. A nil timer
+// records nothing, so stages can be timed unconditionally.
+type stageTimer struct {
+	last    time.Time
+	timings []models.StageTiming
+}
+
+// newStageTimer starts timing the first stage
+func newStageTimer() *stageTimer {
+	return &stageTimer{last: time.Now(), timings: []models.StageTiming{}}
+}
+
+// lap ends the current stage under the given name and starts the next one
+func (t *stageTimer) lap(stage string) {
+	if t == nil {
+		return
+	}
+	now := time.Now()
+	t.timings = append(t.timings, models.StageTiming{
+		Stage:      stage,
+		DurationMs: float64(now.Sub(t.last).Microseconds()) / 1000,
+	})
+	t.last = now
+}
+
+// resultExplanation describes the rankings of a chunk returned by searchChunks
+// at the given position of the fused ranking
+func resultExplanation(fusionRank int, fusionScore float64, vectorDistance sql.NullFloat64, vectorRank sql.NullInt64,
+	lexicalScore sql.NullFloat64, lexicalRank sql.NullInt64) *models.ResultExplanation {
+	e := &models.ResultExplanation{
+		FusionScore:     fusionScore,
+		FusionRank:      fusionRank,
+		MatchedKeywords: []string{},
+	}
+	if vectorDistance.Valid && vectorRank.Valid {
+		distance, rank := vectorDistance.Float64, int(vectorRank.Int64)
+		e.VectorDistance, e.VectorRank = &distance, &rank
+	}
+	if lexicalScore.Valid && lexicalRank.Valid {
+		score, rank := lexicalScore.Float64, int(lexicalRank.Int64)
+		e.LexicalScore, e.LexicalRank = &score, &rank
+	}
+	return e
+}
+
+// matchedKeywords returns the keywords that occur in the content, ignoring case
+func matchedKeywords(keywords []string, content string) []string {
+	content = strings.ToLower(content)
+	matched := []string{}
+	for _, keyword := range keywords {
+		if strings.Contains(content, keyword) {
+			matched = append(matched, keyword)
+		}
+	}
+	return matched
+}
+
+// queryExplanation describes the effective settings of a query
+func queryExplanation(req *models.QueryRequest, opts queryOptions, timer *stageTimer) *models.QueryExplanation {
+	keywords := extractKeywords(req.Query)
+	if keywords == nil {
+		keywords = []string{}
+	}
+	return &models.QueryExplanation{
+		Keywords:      keywords,
+		Filters:       req.Filters,
+		MaxDistance:   opts.maxDistance,
+		MinScore:      opts.minScore,
+		VectorWeight:  opts.vectorWeight,
+		KeywordWeight: opts.keywordWeight,
+		RRFK:          opts.rrfK,
+		Timings:       timer.timings,
+	}
+}
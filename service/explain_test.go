@@ -0,0 +1,65 @@
+package service
+
+import (
+	"database/sql"
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStageTimer(t *testing.T) {
+	// A nil timer records nothing
+	var disabled *stageTimer
+	disabled.lap("retrieval")
+
+	timer := newStageTimer()
+	timer.lap("embedding")
+	timer.lap("retrieval")
+
+	require.Len(t, timer.timings, 2)
+	assert.Equal(t, "embedding", timer.timings[0].Stage)
+	assert.Equal(t, "retrieval", timer.timings[1].Stage)
+	assert.GreaterOrEqual(t, timer.timings[1].DurationMs, 0.0)
+}
+
+func TestResultExplanation(t *testing.T) {
+	e := resultExplanation(2, 0.016, sql.NullFloat64{Float64: 0.21, Valid: true}, sql.NullInt64{Int64: 4, Valid: true},
+		sql.NullFloat64{}, sql.NullInt64{})
+
+	assert.Equal(t, 2, e.FusionRank)
+	assert.Equal(t, 0.016, e.FusionScore)
+	require.NotNil(t, e.VectorDistance)
+	assert.Equal(t, 0.21, *e.VectorDistance)
+	assert.Equal(t, 4, *e.VectorRank)
+	// The chunk was not a full-text candidate
+	assert.Nil(t, e.LexicalScore)
+	assert.Nil(t, e.LexicalRank)
+	assert.Empty(t, e.MatchedKeywords)
+}
+
+func TestMatchedKeywords(t *testing.T) {
+	keywords := extractKeywords("How to install the service on Linux?")
+	assert.Equal(t, []string{"install", "linux"}, matchedKeywords(keywords, "Linux: install the package"))
+	assert.Equal(t, []string{}, matchedKeywords(keywords, "Nothing relevant"))
+}
+
+func TestQueryExplanation(t *testing.T) {
+	s := NewRAGService(nil, "", "", "")
+	req := &models.QueryRequest{Query: "install linux", Explain: true, Filters: &models.QueryFilters{Domain: "example.com"}}
+	opts, err := s.resolveQueryOptions(req)
+	require.NoError(t, err)
+	assert.True(t, opts.explain)
+
+	timer := newStageTimer()
+	timer.lap("retrieval")
+	e := queryExplanation(req, opts, timer)
+
+	assert.Equal(t, []string{"install", "linux"}, e.Keywords)
+	assert.Equal(t, "example.com", e.Filters.Domain)
+	assert.Equal(t, 0.5, e.MaxDistance)
+	assert.Equal(t, 60, e.RRFK)
+	require.Len(t, e.Timings, 1)
+}
@@ -0,0 +1,282 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"rag-data-service/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Extraction providers
+const (
+	ExtractionProviderRegex = "regex"
+	ExtractionProviderLLM   = "llm"
+)
+
+// regexConfidence is the confidence of everything the regex extractor finds,
+// which has no notion of how sure a pattern match is
+const regexConfidence = 0.5
+
+// maxExtractionTextRunes bounds the length of the text sent to the LLM extractor
+const maxExtractionTextRunes = 8000
+
+// ExtractedEntity is an entity found in a text
+type ExtractedEntity struct {
+	Name       string
+	Type       string
+	Confidence float64
+	Properties map[string]any
+}
+
+// ExtractedRelation is a relation between two entities, which it refers to
+// by name. The entities may come from other extractions of the same document.
+type ExtractedRelation struct {
+	Source     string
+	Target     string
+	Type       string
+	Confidence float64
+	Properties map[string]any
+}
+
+// Extraction is what an extractor found in a text
+type Extraction struct {
+	Entities  []ExtractedEntity
+	Relations []ExtractedRelation
+}
+
+// Extractor finds the entities of a text and the relations between them
+type Extractor interface {
+	// Extract returns the typed entities and relations of the text
+	Extract(ctx context.Context, text string) (*Extraction, error)
+	// Name identifies the extractor in the provenance of nodes and edges
+	Name() string
+}
+
+// NewExtractor creates the extractor selected by the configuration
+func NewExtractor(cfg config.ExtractionConfig, client *openai.Client) (Extractor, error) {
+	switch cfg.Provider {
+	case "", ExtractionProviderRegex:
+		return NewRegexExtractor(), nil
+	case ExtractionProviderLLM:
+		if cfg.Model == "" {
+			return nil, fmt.Errorf("llm extractor requires EXTRACTION_MODEL")
+		}
+		if len(cfg.EntityTypes) == 0 || len(cfg.RelationTypes) == 0 {
+			return nil, fmt.Errorf("llm extractor requires entity and relation types")
+		}
+		return NewLLMExtractor(client, cfg.Model, cfg.EntityTypes, cfg.RelationTypes), nil
+	default:
+		return nil, fmt.Errorf("unknown extraction provider: %s", cfg.Provider)
+	}
+}
+
+// RegexExtractor finds entities and relations with capitalization and
+// phrase patterns. It needs no model and is the default.
+type RegexExtractor struct{}
+
+// NewRegexExtractor creates a new pattern matching extractor
+func NewRegexExtractor() *RegexExtractor {
+	return &RegexExtractor{}
+}
+
+// Name returns the extractor name
+func (e *RegexExtractor) Name() string {
+	return ExtractionProviderRegex
+}
+
+// Extract matches the entity and relation patterns against the text
+func (e *RegexExtractor) Extract(ctx context.Context, text string) (*Extraction, error) {
+	extraction := &Extraction{}
+	names := make(map[string]bool)
+	for _, entity := range extractEntities(text) {
+		extraction.Entities = append(extraction.Entities, ExtractedEntity{
+			Name:       entity.Name,
+			Type:       entity.Type,
+			Confidence: regexConfidence,
+			Properties: entity.Properties,
+		})
+		names[entity.Name] = true
+	}
+	extraction.Relations = extractRelationships(text, names)
+	return extraction, nil
+}
+
+// LLMExtractor asks a chat model for the entities and relations of a text,
+// restricted to a schema of entity and relation types
+type LLMExtractor struct {
+	client        *openai.Client
+	model         string
+	entityTypes   []string
+	relationTypes []string
+}
+
+// NewLLMExtractor creates a new chat model extractor
+func NewLLMExtractor(client *openai.Client, model string, entityTypes, relationTypes []string) *LLMExtractor {
+	return &LLMExtractor{
+		client:        client,
+		model:         model,
+		entityTypes:   entityTypes,
+		relationTypes: relationTypes,
+	}
+}
+
+// Name returns the extractor name
+func (e *LLMExtractor) Name() string {
+	return "llm:" + e.model
+}
+
+// Extract asks the chat model for a JSON extraction of the text and validates it
+func (e *LLMExtractor) Extract(ctx context.Context, text string) (*Extraction, error) {
+	if strings.TrimSpace(text) == "" {
+		return &Extraction{}, nil
+	}
+	if runes := []rune(text); len(runes) > maxExtractionTextRunes {
+		text = string(runes[:maxExtractionTextRunes])
+	}
+
+	prompt := fmt.Sprintf(`Extract the named entities of the text below and the relations between them.
+Entity types: %s
+Relation types: %s
+Use only these types. Name each entity as it appears in the text. Relations connect two of the extracted entities, from source to target. Give each entity and relation a confidence between 0 and 1.
+Respond with only a JSON object of the form {"entities": [{"name": "...", "type": "...", "confidence": 0.9}], "relations": [{"source": "...", "target": "...", "type": "...", "confidence": 0.8}]}.
+
+Text:
+%s`, strings.Join(e.entityTypes, ", "), strings.Join(e.relationTypes, ", "), text)
+
+	resp, err := e.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: e.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "You extract knowledge graphs from text. You only reply with JSON."},
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		ResponseFormat: &openai.ChatCompletionResponseFormat{Type: openai.ChatCompletionResponseFormatTypeJSONObject},
+		Temperature:    0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned")
+	}
+
+	return parseExtraction(resp.Choices[0].Message.Content, e.entityTypes, e.relationTypes)
+}
+
+// parseExtraction validates the JSON extraction of a chat reply. Entities and
+// relations of types outside the schema are dropped, as are repeated
+// entities and relations to dropped entities. Relation ends that are not
+// extracted entities are kept, as they may name entities found elsewhere in
+// the document. Confidences are clamped to [0, 1].
+func parseExtraction(reply string, entityTypes, relationTypes []string) (*Extraction, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+
+	var parsed struct {
+		Entities []struct {
+			Name       string   `json:"name"`
+			Type       string   `json:"type"`
+			Confidence *float64 `json:"confidence"`
+		} `json:"entities"`
+		Relations []struct {
+			Source     string   `json:"source"`
+			Target     string   `json:"target"`
+			Type       string   `json:"type"`
+			Confidence *float64 `json:"confidence"`
+		} `json:"relations"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, fmt.Errorf("failed to decode extraction: %w", err)
+	}
+
+	allowedEntities := typeSet(entityTypes)
+	allowedRelations := typeSet(relationTypes)
+
+	extraction := &Extraction{}
+	names := make(map[string]string) // lowercase name -> name as extracted
+	dropped := make(map[string]bool)
+	for _, entity := range parsed.Entities {
+		name := strings.TrimSpace(entity.Name)
+		entityType, ok := allowedEntities[strings.ToLower(strings.TrimSpace(entity.Type))]
+		key := strings.ToLower(name)
+		if !ok {
+			dropped[key] = true
+		}
+		if name == "" || !ok || names[key] != "" {
+			continue
+		}
+		names[key] = name
+		extraction.Entities = append(extraction.Entities, ExtractedEntity{
+			Name:       name,
+			Type:       entityType,
+			Confidence: clampConfidence(entity.Confidence),
+			Properties: map[string]any{},
+		})
+	}
+
+	seen := make(map[string]bool)
+	// endpoint resolves a relation end to the extracted name, "" if it was dropped
+	endpoint := func(name string) string {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if extracted := names[key]; extracted != "" {
+			return extracted
+		}
+		if dropped[key] {
+			return ""
+		}
+		return name
+	}
+	for _, relation := range parsed.Relations {
+		source := endpoint(relation.Source)
+		target := endpoint(relation.Target)
+		relationType, ok := allowedRelations[strings.ToLower(strings.TrimSpace(relation.Type))]
+		if source == "" || target == "" || source == target || !ok {
+			continue
+		}
+		key := source + "\x00" + target + "\x00" + relationType
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		extraction.Relations = append(extraction.Relations, ExtractedRelation{
+			Source:     source,
+			Target:     target,
+			Type:       relationType,
+			Confidence: clampConfidence(relation.Confidence),
+			Properties: map[string]any{},
+		})
+	}
+
+	return extraction, nil
+}
+
+// typeSet maps the lowercase form of each type to the type as configured
+func typeSet(types []string) map[string]string {
+	set := make(map[string]string, len(types))
+	for _, t := range types {
+		set[strings.ToLower(t)] = t
+	}
+	return set
+}
+
+// clampConfidence bounds a confidence to [0, 1]. A missing confidence counts
+// as certain, since the model chose to report the item.
+func clampConfidence(confidence *float64) float64 {
+	switch {
+	case confidence == nil:
+		return 1
+	case *confidence < 0:
+		return 0
+	case *confidence > 1:
+		return 1
+	default:
+		return *confidence
+	}
+}
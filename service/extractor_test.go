@@ -0,0 +1,151 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rag-data-service/config"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewExtractor(t *testing.T) {
+	extractor, err := NewExtractor(config.ExtractionConfig{Provider: "regex"}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "regex", extractor.Name())
+
+	extractor, err = NewExtractor(config.ExtractionConfig{
+		Provider:      "llm",
+		Model:         "gpt-4o-mini",
+		EntityTypes:   []string{"person"},
+		RelationTypes: []string{"works_at"},
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "llm:gpt-4o-mini", extractor.Name())
+
+	_, err = NewExtractor(config.ExtractionConfig{Provider: "llm", Model: "gpt-4o-mini"}, nil)
+	assert.Error(t, err)
+	_, err = NewExtractor(config.ExtractionConfig{Provider: "spacy"}, nil)
+	assert.Error(t, err)
+}
+
+func TestRegexExtractor(t *testing.T) {
+	extraction, err := NewRegexExtractor().Extract(context.Background(),
+		"Jane Smith works at Acme Corp. Jane Smith studied at Stanford University.")
+	require.NoError(t, err)
+
+	require.NotEmpty(t, extraction.Entities)
+	assert.Equal(t, "Jane Smith", extraction.Entities[0].Name)
+	assert.Equal(t, "person", extraction.Entities[0].Type)
+	for _, entity := range extraction.Entities {
+		assert.Equal(t, regexConfidence, entity.Confidence)
+	}
+
+	require.NotEmpty(t, extraction.Relations)
+	assert.Equal(t, ExtractedRelation{
+		Source:     "Jane Smith",
+		Target:     "Stanford University",
+		Type:       "works_at",
+		Confidence: regexConfidence,
+		Properties: map[string]any{"source": "pattern_matching"},
+	}, extraction.Relations[len(extraction.Relations)-1])
+}
+
+func TestParseExtraction(t *testing.T) {
+	reply := `Here you go: {
+		"entities": [
+			{"name": "Jane Smith", "type": "Person", "confidence": 0.9},
+			{"name": "jane smith", "type": "person", "confidence": 0.4},
+			{"name": "Acme", "type": "organization", "confidence": 1.7},
+			{"name": "Monday", "type": "date", "confidence": 0.8},
+			{"name": " ", "type": "person"},
+			{"name": "Go", "type": "technology"}
+		],
+		"relations": [
+			{"source": "jane smith", "target": "Acme", "type": "works_at", "confidence": -0.2},
+			{"source": "Jane Smith", "target": "Acme", "type": "works_at", "confidence": 0.5},
+			{"source": "Acme", "target": "Go", "type": "uses", "confidence": 0.7},
+			{"source": "Acme", "target": "Monday", "type": "related_to", "confidence": 0.7},
+			{"source": "Acme", "target": "Go", "type": "hates", "confidence": 0.7},
+			{"source": "Jane Smith", "target": "Globex", "type": "works_at", "confidence": 0.6}
+		]
+	}`
+
+	extraction, err := parseExtraction(reply, []string{"person", "organization", "technology"}, []string{"works_at", "uses", "related_to"})
+	require.NoError(t, err)
+
+	require.Len(t, extraction.Entities, 3)
+	assert.Equal(t, "Jane Smith", extraction.Entities[0].Name)
+	assert.Equal(t, "person", extraction.Entities[0].Type)
+	assert.Equal(t, 0.9, extraction.Entities[0].Confidence)
+	// Confidences are clamped, a missing confidence counts as certain
+	assert.Equal(t, 1.0, extraction.Entities[1].Confidence)
+	assert.Equal(t, 1.0, extraction.Entities[2].Confidence)
+
+	// Relations are resolved to the extracted names and repeats are dropped
+	require.Len(t, extraction.Relations, 3)
+	assert.Equal(t, "Jane Smith", extraction.Relations[0].Source)
+	assert.Equal(t, "Acme", extraction.Relations[0].Target)
+	assert.Equal(t, 0.0, extraction.Relations[0].Confidence)
+	assert.Equal(t, "uses", extraction.Relations[1].Type)
+	// Ends that are not entities of the reply may be found elsewhere in the document
+	assert.Equal(t, "Globex", extraction.Relations[2].Target)
+
+	_, err = parseExtraction("no json here", nil, nil)
+	assert.Error(t, err)
+	_, err = parseExtraction(`{"entities": "none"}`, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestLLMExtractor(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"role": "assistant", "content": `{"entities": [{"name": "Jane Smith", "type": "person", "confidence": 0.9}, {"name": "Acme", "type": "organization", "confidence": 0.8}], "relations": [{"source": "Jane Smith", "target": "Acme", "type": "works_at", "confidence": 0.7}]}`}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	clientConfig := openai.DefaultConfig("test")
+	clientConfig.BaseURL = server.URL
+	extractor := NewLLMExtractor(openai.NewClientWithConfig(clientConfig), "gpt-4o-mini", []string{"person", "organization"}, []string{"works_at"})
+
+	extraction, err := extractor.Extract(context.Background(), "Jane Smith joined Acme in 2020.")
+	require.NoError(t, err)
+	assert.Len(t, extraction.Entities, 2)
+	require.Len(t, extraction.Relations, 1)
+	assert.Equal(t, 0.7, extraction.Relations[0].Confidence)
+
+	assert.Equal(t, "gpt-4o-mini", received.Model)
+	assert.Contains(t, received.Messages[1].Content, "Entity types: person, organization")
+	assert.Contains(t, received.Messages[1].Content, "Relation types: works_at")
+	assert.Contains(t, received.Messages[1].Content, "Jane Smith joined Acme in 2020.")
+}
+
+func TestProvenance(t *testing.T) {
+	s := NewRAGService(nil, "test", "", "")
+	properties := map[string]any{"source": "pattern_matching"}
+
+	result := s.provenance(properties, 0.5, extractionText{chunkID: 7, chunkIndex: 2})
+	assert.Equal(t, map[string]any{
+		"source":      "pattern_matching",
+		"extractor":   "regex",
+		"confidence":  0.5,
+		"chunk_id":    7,
+		"chunk_index": 2,
+	}, result)
+	// The extracted properties are not modified
+	assert.Len(t, properties, 1)
+
+	// Text without a chunk has no chunk provenance
+	result = s.provenance(nil, 1, extractionText{content: "whole document"})
+	assert.NotContains(t, result, "chunk_id")
+}
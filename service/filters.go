@@ -0,0 +1,93 @@
+package service
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+)
+
+// validateQueryFilters checks that the filters of a query can be applied
+func validateQueryFilters(f *models.QueryFilters) error {
+	if f == nil {
+		return nil
+	}
+	if f.CreatedAfter != nil && f.CreatedBefore != nil && !f.CreatedAfter.Before(*f.CreatedBefore) {
+		return fmt.Errorf("%w: created_after must be before created_before", ErrInvalidQuery)
+	}
+	if f.UpdatedAfter != nil && f.UpdatedBefore != nil && !f.UpdatedAfter.Before(*f.UpdatedBefore) {
+		return fmt.Errorf("%w: updated_after must be before updated_before", ErrInvalidQuery)
+	}
+	if strings.ContainsAny(f.Domain, "/:") {
+		return fmt.Errorf("%w: domain must be a host name such as example.com", ErrInvalidQuery)
+	}
+	return nil
+}
+
+// queryFilterSQL returns the conditions of the filters as SQL, to be
+// appended to a WHERE clause over chunks c joined with documents d, along
+// with args extended by the values of its parameters
+func queryFilterSQL(f *models.QueryFilters, args []interface{}) (string, []interface{}, error) {
+	if f == nil {
+		return "", args, nil
+	}
+
+	var conditions []string
+	param := func(value interface{}) string {
+		args = append(args, value)
+		return fmt.Sprintf("$%d", len(args))
+	}
+
+	if len(f.DocumentIDs) > 0 {
+		ids := make([]int64, len(f.DocumentIDs))
+		for i, id := range f.DocumentIDs {
+			ids[i] = int64(id)
+		}
+		conditions = append(conditions, "d.id = ANY("+param(pq.Array(ids))+"::integer[])")
+	}
+	if f.URLPrefix != "" {
+		conditions = append(conditions, "d.url LIKE "+param(escapeLike(f.URLPrefix)+"%"))
+	}
+	if f.Domain != "" {
+		// The host of the URL, without any user info or port
+		host := `lower(substring(d.url from '^[^:/]+://(?:[^@/]*@)?([^:/?#]+)'))`
+		domain := strings.ToLower(strings.TrimPrefix(f.Domain, "."))
+		conditions = append(conditions, fmt.Sprintf("(%s = %s OR %s LIKE %s)",
+			host, param(domain), host, param("%."+escapeLike(domain))))
+	}
+	if f.Title != "" {
+		conditions = append(conditions, "d.title ILIKE "+param("%"+escapeLike(f.Title)+"%"))
+	}
+	if f.CreatedAfter != nil {
+		conditions = append(conditions, "d.created_at >= "+param(*f.CreatedAfter))
+	}
+	if f.CreatedBefore != nil {
+		conditions = append(conditions, "d.created_at < "+param(*f.CreatedBefore))
+	}
+	if f.UpdatedAfter != nil {
+		conditions = append(conditions, "d.updated_at >= "+param(*f.UpdatedAfter))
+	}
+	if f.UpdatedBefore != nil {
+		conditions = append(conditions, "d.updated_at < "+param(*f.UpdatedBefore))
+	}
+	if len(f.Metadata) > 0 {
+		metadata, err := json.Marshal(f.Metadata)
+		if err != nil {
+			return "", nil, fmt.Errorf("failed to marshal metadata filter: %w", err)
+		}
+		conditions = append(conditions, "c.metadata @> "+param(string(metadata))+"::jsonb")
+	}
+
+	if len(conditions) == 0 {
+		return "", args, nil
+	}
+	return " AND " + strings.Join(conditions, " AND "), args, nil
+}
+
+// escapeLike escapes the wildcards of a LIKE pattern
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
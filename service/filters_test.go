@@ -0,0 +1,74 @@
+package service
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryFilterSQL(t *testing.T) {
+	created := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	filters := &models.QueryFilters{
+		DocumentIDs:  []int{1, 2},
+		URLPrefix:    "https://example.com/docs_v2/",
+		Domain:       "Example.com",
+		Title:        "100%",
+		CreatedAfter: &created,
+		Metadata:     map[string]any{"lang": "en"},
+	}
+
+	clause, args, err := queryFilterSQL(filters, []interface{}{"existing"})
+	require.NoError(t, err)
+
+	assert.Contains(t, clause, "d.id = ANY($2::integer[])")
+	assert.Contains(t, clause, "d.url LIKE $3")
+	assert.Contains(t, clause, "= $4 OR")
+	assert.Contains(t, clause, "LIKE $5)")
+	assert.Contains(t, clause, "d.title ILIKE $6")
+	assert.Contains(t, clause, "d.created_at >= $7")
+	assert.Contains(t, clause, "c.metadata @> $8::jsonb")
+	assert.NotContains(t, clause, "updated_at")
+
+	require.Len(t, args, 8)
+	assert.Equal(t, "existing", args[0])
+	assert.Equal(t, `https://example.com/docs\_v2/%`, args[2])
+	assert.Equal(t, "example.com", args[3])
+	assert.Equal(t, "%.example.com", args[4])
+	assert.Equal(t, `%100\%%`, args[5])
+	assert.Equal(t, created, args[6])
+	assert.Equal(t, `{"lang":"en"}`, args[7])
+}
+
+func TestQueryFilterSQL_Empty(t *testing.T) {
+	clause, args, err := queryFilterSQL(nil, []interface{}{1})
+	require.NoError(t, err)
+	assert.Empty(t, clause)
+	assert.Len(t, args, 1)
+
+	clause, _, err = queryFilterSQL(&models.QueryFilters{}, nil)
+	require.NoError(t, err)
+	assert.Empty(t, clause)
+}
+
+func TestValidateQueryFilters(t *testing.T) {
+	early := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	late := early.AddDate(0, 1, 0)
+
+	assert.NoError(t, validateQueryFilters(&models.QueryFilters{CreatedAfter: &early, CreatedBefore: &late}))
+
+	for name, filters := range map[string]*models.QueryFilters{
+		"empty created range": {CreatedAfter: &late, CreatedBefore: &early},
+		"empty updated range": {UpdatedAfter: &early, UpdatedBefore: &early},
+		"domain with scheme":  {Domain: "https://example.com"},
+	} {
+		t.Run(name, func(t *testing.T) {
+			err := validateQueryFilters(filters)
+			assert.True(t, errors.Is(err, ErrInvalidQuery), "expected ErrInvalidQuery, got %v", err)
+		})
+	}
+}
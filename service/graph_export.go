@@ -0,0 +1,606 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"log"
+	"strconv"
+	"strings"
+
+	"rag-data-service/models"
+)
+
+// Graph export formats
+const (
+	ExportFormatGraphML = "graphml"
+	ExportFormatGEXF    = "gexf"
+	ExportFormatDOT     = "dot"
+	ExportFormatJSONLD  = "jsonld"
+	ExportFormatCypher  = "cypher"
+)
+
+// ExportFormat describes a format the knowledge graph can be exported in
+type ExportFormat struct {
+	Name        string
+	ContentType string
+	// Extension is the file extension of exported files, without the dot
+	Extension  string
+	newEncoder func(w io.Writer) graphEncoder
+}
+
+var exportFormats = map[string]*ExportFormat{
+	ExportFormatGraphML: {Name: ExportFormatGraphML, ContentType: "application/graphml+xml", Extension: "graphml", newEncoder: newGraphMLEncoder},
+	ExportFormatGEXF:    {Name: ExportFormatGEXF, ContentType: "application/gexf+xml", Extension: "gexf", newEncoder: newGEXFEncoder},
+	ExportFormatDOT:     {Name: ExportFormatDOT, ContentType: "text/vnd.graphviz", Extension: "dot", newEncoder: newDOTEncoder},
+	ExportFormatJSONLD:  {Name: ExportFormatJSONLD, ContentType: "application/ld+json", Extension: "jsonld", newEncoder: newJSONLDEncoder},
+	ExportFormatCypher:  {Name: ExportFormatCypher, ContentType: "application/x-cypher-query", Extension: "cypher", newEncoder: newCypherEncoder},
+}
+
+// LookupExportFormat returns the export format with the given name, which
+// defaults to GraphML. Unknown formats are reported as ErrInvalidGraphQuery.
+func LookupExportFormat(name string) (*ExportFormat, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if name == "" {
+		name = ExportFormatGraphML
+	}
+	format, ok := exportFormats[name]
+	if !ok {
+		return nil, fmt.Errorf("%w: format must be graphml, gexf, dot, jsonld or cypher", ErrInvalidGraphQuery)
+	}
+	return format, nil
+}
+
+// graphEncoder writes a knowledge graph in an export format, all nodes first
+// and then all edges, so that the graph can be streamed as it is read
+type graphEncoder interface {
+	Begin() error
+	Node(node models.KnowledgeNodeResponse) error
+	Edge(edge models.KnowledgeEdgeResponse) error
+	End() error
+}
+
+// ExportKnowledgeGraph streams the knowledge graph to w in the requested
+// format. With a document only the nodes the document mentions are exported,
+// with a query only the nodes whose name contains it, and in both cases only
+// the edges between exported nodes. Nothing is written when the export fails
+// before the first node is read.
+func (s *RAGService) ExportKnowledgeGraph(ctx context.Context, req *models.GraphExportRequest, w io.Writer) error {
+	format, err := LookupExportFormat(req.Format)
+	if err != nil {
+		return err
+	}
+	where, args := exportScopeSQL(req)
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+knowledgeNodeColumns+`
+		FROM knowledge_nodes kn
+		LEFT JOIN documents d ON d.id = kn.document_id`+where+`
+		ORDER BY kn.id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query knowledge nodes: %w", err)
+	}
+	defer rows.Close()
+
+	out := bufio.NewWriter(w)
+	encoder := format.newEncoder(out)
+	if err := encoder.Begin(); err != nil {
+		return fmt.Errorf("failed to write graph export: %w", err)
+	}
+	nodeCount := 0
+	for rows.Next() {
+		node, err := scanKnowledgeNode(rows)
+		if err != nil {
+			return fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		if err := encoder.Node(node); err != nil {
+			return fmt.Errorf("failed to write graph export: %w", err)
+		}
+		nodeCount++
+	}
+	if err = rows.Err(); err != nil {
+		return fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+	rows.Close()
+
+	edgeWhere := ""
+	if where != "" {
+		edgeWhere = `
+		WHERE e.source_id IN (SELECT kn.id FROM knowledge_nodes kn` + where + `)
+			AND e.target_id IN (SELECT kn.id FROM knowledge_nodes kn` + where + `)`
+	}
+	edgeRows, err := s.db.QueryContext(ctx, `
+		SELECT e.id, e.source_id, e.target_id, e.relationship_type, e.properties, e.document_id
+		FROM knowledge_edges e`+edgeWhere+`
+		ORDER BY e.id
+	`, args...)
+	if err != nil {
+		return fmt.Errorf("failed to query knowledge edges: %w", err)
+	}
+	defer edgeRows.Close()
+
+	edgeCount := 0
+	for edgeRows.Next() {
+		var edge models.KnowledgeEdgeResponse
+		var propertiesJSON []byte
+		if err := edgeRows.Scan(&edge.ID, &edge.SourceID, &edge.TargetID, &edge.RelationshipType, &propertiesJSON, &edge.DocumentID); err != nil {
+			return fmt.Errorf("failed to scan knowledge edge: %w", err)
+		}
+		if propertiesJSON != nil {
+			if err := json.Unmarshal(propertiesJSON, &edge.Properties); err != nil {
+				return fmt.Errorf("failed to unmarshal edge properties: %w", err)
+			}
+		}
+		if err := encoder.Edge(edge); err != nil {
+			return fmt.Errorf("failed to write graph export: %w", err)
+		}
+		edgeCount++
+	}
+	if err = edgeRows.Err(); err != nil {
+		return fmt.Errorf("error iterating knowledge edge rows: %w", err)
+	}
+
+	if err := encoder.End(); err != nil {
+		return fmt.Errorf("failed to write graph export: %w", err)
+	}
+	if err := out.Flush(); err != nil {
+		return fmt.Errorf("failed to write graph export: %w", err)
+	}
+	log.Printf("Exported %d knowledge nodes and %d edges as %s", nodeCount, edgeCount, format.Name)
+	return nil
+}
+
+// exportScopeSQL returns the WHERE clause selecting the knowledge nodes kn of
+// an export and its arguments, or an empty clause for the whole graph
+func exportScopeSQL(req *models.GraphExportRequest) (string, []interface{}) {
+	var conditions []string
+	var args []interface{}
+	if req.DocumentID != nil {
+		args = append(args, *req.DocumentID)
+		conditions = append(conditions, fmt.Sprintf("EXISTS (SELECT 1 FROM node_mentions m WHERE m.node_id = kn.id AND m.document_id = $%d)", len(args)))
+	}
+	if query := strings.TrimSpace(req.Query); query != "" {
+		args = append(args, "%"+escapeLike(query)+"%")
+		conditions = append(conditions, fmt.Sprintf("kn.name ILIKE $%d", len(args)))
+	}
+	if len(conditions) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+// exportAttribute is an attribute of an exported node or edge as text
+type exportAttribute struct {
+	key   string
+	value string
+}
+
+// Attributes written by the formats that declare them up front. Structured
+// values are written as JSON.
+var (
+	nodeExportKeys = []string{"type", "url", "title", "document_ids", "aliases", "properties"}
+	edgeExportKeys = []string{"document_id", "properties"}
+)
+
+// nodeAttributes returns the set attributes of a node, in nodeExportKeys order
+func nodeAttributes(node models.KnowledgeNodeResponse) []exportAttribute {
+	attributes := []exportAttribute{{"type", node.Type}}
+	if node.URL != nil {
+		attributes = append(attributes, exportAttribute{"url", *node.URL})
+	}
+	if node.Title != nil {
+		attributes = append(attributes, exportAttribute{"title", *node.Title})
+	}
+	if len(node.DocumentIDs) > 0 {
+		attributes = append(attributes, exportAttribute{"document_ids", exportJSON(node.DocumentIDs)})
+	}
+	if len(node.Aliases) > 0 {
+		attributes = append(attributes, exportAttribute{"aliases", exportJSON(node.Aliases)})
+	}
+	if len(node.Properties) > 0 {
+		attributes = append(attributes, exportAttribute{"properties", exportJSON(node.Properties)})
+	}
+	return attributes
+}
+
+// edgeAttributes returns the set attributes of an edge, in edgeExportKeys order
+func edgeAttributes(edge models.KnowledgeEdgeResponse) []exportAttribute {
+	var attributes []exportAttribute
+	if edge.DocumentID != nil {
+		attributes = append(attributes, exportAttribute{"document_id", strconv.Itoa(*edge.DocumentID)})
+	}
+	if len(edge.Properties) > 0 {
+		attributes = append(attributes, exportAttribute{"properties", exportJSON(edge.Properties)})
+	}
+	return attributes
+}
+
+// exportJSON encodes a value of a node or edge as JSON, with map keys sorted
+func exportJSON(value interface{}) string {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return ""
+	}
+	return string(data)
+}
+
+// xmlEscape escapes text for XML content and attribute values
+func xmlEscape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
+
+// graphMLEncoder writes GraphML, as read by Gephi, yEd and NetworkX
+type graphMLEncoder struct {
+	w io.Writer
+}
+
+func newGraphMLEncoder(w io.Writer) graphEncoder {
+	return &graphMLEncoder{w: w}
+}
+
+func (e *graphMLEncoder) Begin() error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<graphml xmlns="http://graphml.graphdrawing.org/xmlns">` + "\n")
+	b.WriteString(`  <key id="n_name" for="node" attr.name="name" attr.type="string"/>` + "\n")
+	for _, key := range nodeExportKeys {
+		fmt.Fprintf(&b, `  <key id="n_%s" for="node" attr.name="%s" attr.type="string"/>`+"\n", key, key)
+	}
+	b.WriteString(`  <key id="e_relationship_type" for="edge" attr.name="relationship_type" attr.type="string"/>` + "\n")
+	for _, key := range edgeExportKeys {
+		fmt.Fprintf(&b, `  <key id="e_%s" for="edge" attr.name="%s" attr.type="string"/>`+"\n", key, key)
+	}
+	b.WriteString(`  <graph id="knowledge_graph" edgedefault="directed">` + "\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *graphMLEncoder) Node(node models.KnowledgeNodeResponse) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `    <node id="n%d">`+"\n", node.ID)
+	fmt.Fprintf(&b, `      <data key="n_name">%s</data>`+"\n", xmlEscape(node.Name))
+	for _, attribute := range nodeAttributes(node) {
+		fmt.Fprintf(&b, `      <data key="n_%s">%s</data>`+"\n", attribute.key, xmlEscape(attribute.value))
+	}
+	b.WriteString("    </node>\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *graphMLEncoder) Edge(edge models.KnowledgeEdgeResponse) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `    <edge id="e%d" source="n%d" target="n%d">`+"\n", edge.ID, edge.SourceID, edge.TargetID)
+	fmt.Fprintf(&b, `      <data key="e_relationship_type">%s</data>`+"\n", xmlEscape(edge.RelationshipType))
+	for _, attribute := range edgeAttributes(edge) {
+		fmt.Fprintf(&b, `      <data key="e_%s">%s</data>`+"\n", attribute.key, xmlEscape(attribute.value))
+	}
+	b.WriteString("    </edge>\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *graphMLEncoder) End() error {
+	_, err := io.WriteString(e.w, "  </graph>\n</graphml>\n")
+	return err
+}
+
+// gexfEncoder writes GEXF 1.3, the native format of Gephi. Nodes and edges
+// are written in separate elements, so the encoder tracks which one is open.
+type gexfEncoder struct {
+	w     io.Writer
+	edges bool
+}
+
+func newGEXFEncoder(w io.Writer) graphEncoder {
+	return &gexfEncoder{w: w}
+}
+
+func (e *gexfEncoder) Begin() error {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<gexf xmlns="http://gexf.net/1.3" version="1.3">` + "\n")
+	b.WriteString("  <meta>\n    <creator>rag-data-service</creator>\n  </meta>\n")
+	b.WriteString(`  <graph defaultedgetype="directed" mode="static">` + "\n")
+	b.WriteString(`    <attributes class="node">` + "\n")
+	for _, key := range nodeExportKeys {
+		fmt.Fprintf(&b, `      <attribute id="%s" title="%s" type="string"/>`+"\n", key, key)
+	}
+	b.WriteString("    </attributes>\n")
+	b.WriteString(`    <attributes class="edge">` + "\n")
+	for _, key := range edgeExportKeys {
+		fmt.Fprintf(&b, `      <attribute id="%s" title="%s" type="string"/>`+"\n", key, key)
+	}
+	b.WriteString("    </attributes>\n")
+	b.WriteString("    <nodes>\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *gexfEncoder) Node(node models.KnowledgeNodeResponse) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, `      <node id="%d" label="%s">`+"\n", node.ID, xmlEscape(node.Name))
+	writeGEXFAttributes(&b, nodeAttributes(node))
+	b.WriteString("      </node>\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *gexfEncoder) Edge(edge models.KnowledgeEdgeResponse) error {
+	var b strings.Builder
+	if !e.edges {
+		b.WriteString("    </nodes>\n    <edges>\n")
+		e.edges = true
+	}
+	fmt.Fprintf(&b, `      <edge id="%d" source="%d" target="%d" label="%s">`+"\n",
+		edge.ID, edge.SourceID, edge.TargetID, xmlEscape(edge.RelationshipType))
+	writeGEXFAttributes(&b, edgeAttributes(edge))
+	b.WriteString("      </edge>\n")
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *gexfEncoder) End() error {
+	closing := "    </nodes>\n"
+	if e.edges {
+		closing = "    </edges>\n"
+	}
+	_, err := io.WriteString(e.w, closing+"  </graph>\n</gexf>\n")
+	return err
+}
+
+// writeGEXFAttributes writes the attvalues element of a node or edge
+func writeGEXFAttributes(b *strings.Builder, attributes []exportAttribute) {
+	if len(attributes) == 0 {
+		return
+	}
+	b.WriteString("        <attvalues>\n")
+	for _, attribute := range attributes {
+		fmt.Fprintf(b, `          <attvalue for="%s" value="%s"/>`+"\n", attribute.key, xmlEscape(attribute.value))
+	}
+	b.WriteString("        </attvalues>\n")
+}
+
+// dotEncoder writes a Graphviz DOT digraph. Nodes are labelled with their
+// name and edges with their relationship type.
+type dotEncoder struct {
+	w io.Writer
+}
+
+func newDOTEncoder(w io.Writer) graphEncoder {
+	return &dotEncoder{w: w}
+}
+
+func (e *dotEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "digraph knowledge_graph {\n")
+	return err
+}
+
+func (e *dotEncoder) Node(node models.KnowledgeNodeResponse) error {
+	attributes := append([]exportAttribute{{"label", node.Name}}, nodeAttributes(node)...)
+	_, err := fmt.Fprintf(e.w, "  n%d [%s];\n", node.ID, dotAttributes(attributes))
+	return err
+}
+
+func (e *dotEncoder) Edge(edge models.KnowledgeEdgeResponse) error {
+	attributes := append([]exportAttribute{{"label", edge.RelationshipType}, {"id", "e" + strconv.Itoa(edge.ID)}}, edgeAttributes(edge)...)
+	_, err := fmt.Fprintf(e.w, "  n%d -> n%d [%s];\n", edge.SourceID, edge.TargetID, dotAttributes(attributes))
+	return err
+}
+
+func (e *dotEncoder) End() error {
+	_, err := io.WriteString(e.w, "}\n")
+	return err
+}
+
+// dotAttributes formats an attribute list, quoting every value
+func dotAttributes(attributes []exportAttribute) string {
+	parts := make([]string, len(attributes))
+	for i, attribute := range attributes {
+		parts[i] = attribute.key + "=" + dotQuote(attribute.value)
+	}
+	return strings.Join(parts, ", ")
+}
+
+// dotQuote returns s as a DOT quoted string
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	s = strings.ReplaceAll(s, "\r", "")
+	s = strings.ReplaceAll(s, "\n", `\n`)
+	return `"` + s + `"`
+}
+
+// jsonLDContext maps the keys of the exported JSON-LD to IRIs. Nodes and
+// edges are identified as node:<id> and edge:<id>, and the relationships are
+// reified as edge objects so that nodes can be written before edges.
+var jsonLDContext = map[string]interface{}{
+	"@vocab":     "urn:rag-data-service:graph:",
+	"node":       "urn:rag-data-service:node:",
+	"edge":       "urn:rag-data-service:edge:",
+	"name":       "http://schema.org/name",
+	"url":        map[string]string{"@id": "http://schema.org/url", "@type": "@id"},
+	"source":     map[string]string{"@type": "@id"},
+	"target":     map[string]string{"@type": "@id"},
+	"properties": map[string]string{"@type": "@json"},
+}
+
+// jsonLDNode is a node of the JSON-LD export
+type jsonLDNode struct {
+	ID          string         `json:"@id"`
+	Type        string         `json:"@type"`
+	Name        string         `json:"name"`
+	EntityType  string         `json:"entity_type"`
+	URL         *string        `json:"url,omitempty"`
+	Title       *string        `json:"title,omitempty"`
+	DocumentIDs []int          `json:"document_ids,omitempty"`
+	Aliases     []string       `json:"aliases,omitempty"`
+	Properties  map[string]any `json:"properties,omitempty"`
+}
+
+// jsonLDEdge is an edge of the JSON-LD export
+type jsonLDEdge struct {
+	ID               string         `json:"@id"`
+	Type             string         `json:"@type"`
+	Source           string         `json:"source"`
+	Target           string         `json:"target"`
+	RelationshipType string         `json:"relationship_type"`
+	DocumentID       *int           `json:"document_id,omitempty"`
+	Properties       map[string]any `json:"properties,omitempty"`
+}
+
+// jsonLDEncoder writes a JSON-LD document whose @graph lists the nodes and edges
+type jsonLDEncoder struct {
+	w     io.Writer
+	items int
+}
+
+func newJSONLDEncoder(w io.Writer) graphEncoder {
+	return &jsonLDEncoder{w: w}
+}
+
+func (e *jsonLDEncoder) Begin() error {
+	graphContext, err := json.Marshal(jsonLDContext)
+	if err != nil {
+		return err
+	}
+	_, err = fmt.Fprintf(e.w, "{\"@context\": %s,\n\"@graph\": [", graphContext)
+	return err
+}
+
+func (e *jsonLDEncoder) Node(node models.KnowledgeNodeResponse) error {
+	return e.item(jsonLDNode{
+		ID:          fmt.Sprintf("node:%d", node.ID),
+		Type:        "Entity",
+		Name:        node.Name,
+		EntityType:  node.Type,
+		URL:         node.URL,
+		Title:       node.Title,
+		DocumentIDs: node.DocumentIDs,
+		Aliases:     node.Aliases,
+		Properties:  node.Properties,
+	})
+}
+
+func (e *jsonLDEncoder) Edge(edge models.KnowledgeEdgeResponse) error {
+	return e.item(jsonLDEdge{
+		ID:               fmt.Sprintf("edge:%d", edge.ID),
+		Type:             "Relationship",
+		Source:           fmt.Sprintf("node:%d", edge.SourceID),
+		Target:           fmt.Sprintf("node:%d", edge.TargetID),
+		RelationshipType: edge.RelationshipType,
+		DocumentID:       edge.DocumentID,
+		Properties:       edge.Properties,
+	})
+}
+
+// item writes an element of the @graph array
+func (e *jsonLDEncoder) item(value interface{}) error {
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	separator := ",\n"
+	if e.items == 0 {
+		separator = "\n"
+	}
+	e.items++
+	_, err = fmt.Fprintf(e.w, "%s%s", separator, data)
+	return err
+}
+
+func (e *jsonLDEncoder) End() error {
+	_, err := io.WriteString(e.w, "\n]}\n")
+	return err
+}
+
+// cypherEncoder writes a Neo4j Cypher script. Nodes are merged as :Entity
+// nodes on their ID, labelled with their type, and edges are merged as
+// relationships of their type, so running the script again updates the
+// graph in place. Neo4j properties cannot hold maps, so node and edge
+// properties are stored as JSON strings.
+type cypherEncoder struct {
+	w io.Writer
+}
+
+func newCypherEncoder(w io.Writer) graphEncoder {
+	return &cypherEncoder{w: w}
+}
+
+func (e *cypherEncoder) Begin() error {
+	_, err := io.WriteString(e.w, "CREATE CONSTRAINT knowledge_entity_id IF NOT EXISTS FOR (n:Entity) REQUIRE n.id IS UNIQUE;\n")
+	return err
+}
+
+func (e *cypherEncoder) Node(node models.KnowledgeNodeResponse) error {
+	set := []string{"n.name = " + cypherString(node.Name), "n.type = " + cypherString(node.Type)}
+	if node.Type != "" {
+		set = append([]string{"n:" + cypherName(node.Type)}, set...)
+	}
+	if node.URL != nil {
+		set = append(set, "n.url = "+cypherString(*node.URL))
+	}
+	if node.Title != nil {
+		set = append(set, "n.title = "+cypherString(*node.Title))
+	}
+	if len(node.DocumentIDs) > 0 {
+		ids := make([]string, len(node.DocumentIDs))
+		for i, id := range node.DocumentIDs {
+			ids[i] = strconv.Itoa(id)
+		}
+		set = append(set, "n.document_ids = ["+strings.Join(ids, ", ")+"]")
+	}
+	if len(node.Aliases) > 0 {
+		aliases := make([]string, len(node.Aliases))
+		for i, alias := range node.Aliases {
+			aliases[i] = cypherString(alias)
+		}
+		set = append(set, "n.aliases = ["+strings.Join(aliases, ", ")+"]")
+	}
+	if len(node.Properties) > 0 {
+		set = append(set, "n.properties = "+cypherString(exportJSON(node.Properties)))
+	}
+	_, err := fmt.Fprintf(e.w, "MERGE (n:Entity {id: %d}) SET %s;\n", node.ID, strings.Join(set, ", "))
+	return err
+}
+
+func (e *cypherEncoder) Edge(edge models.KnowledgeEdgeResponse) error {
+	var set []string
+	if edge.DocumentID != nil {
+		set = append(set, fmt.Sprintf("r.document_id = %d", *edge.DocumentID))
+	}
+	if len(edge.Properties) > 0 {
+		set = append(set, "r.properties = "+cypherString(exportJSON(edge.Properties)))
+	}
+	statement := fmt.Sprintf("MATCH (s:Entity {id: %d}), (t:Entity {id: %d}) MERGE (s)-[r:%s {id: %d}]->(t)",
+		edge.SourceID, edge.TargetID, cypherName(edge.RelationshipType), edge.ID)
+	if len(set) > 0 {
+		statement += " SET " + strings.Join(set, ", ")
+	}
+	_, err := io.WriteString(e.w, statement+";\n")
+	return err
+}
+
+func (e *cypherEncoder) End() error {
+	return nil
+}
+
+// cypherString returns s as a Cypher string literal
+func cypherString(s string) string {
+	replacer := strings.NewReplacer(`\`, `\\`, `'`, `\'`, "\n", `\n`, "\r", `\r`, "\t", `\t`)
+	return "'" + replacer.Replace(s) + "'"
+}
+
+// cypherName returns s as a Cypher label or relationship type, quoted with
+// backticks so that any characters are allowed
+func cypherName(s string) string {
+	if s == "" {
+		s = "RELATED_TO"
+	}
+	return "`" + strings.ReplaceAll(s, "`", "``") + "`"
+}
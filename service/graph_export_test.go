@@ -0,0 +1,136 @@
+package service
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"strings"
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// exportTestGraph encodes two nodes and the edge between them in a format
+func exportTestGraph(t *testing.T, name string) string {
+	format, err := LookupExportFormat(name)
+	require.NoError(t, err)
+
+	url := "https://example.com/a?x=1&y=2"
+	documentID := 7
+	var b bytes.Buffer
+	encoder := format.newEncoder(&b)
+	require.NoError(t, encoder.Begin())
+	require.NoError(t, encoder.Node(models.KnowledgeNodeResponse{
+		ID: 1, Name: `Jane "JS" Smith`, Type: "person", URL: &url, DocumentIDs: []int{7, 9},
+		Properties: map[string]any{"confidence": 0.5, "extractor": "regex"},
+	}))
+	require.NoError(t, encoder.Node(models.KnowledgeNodeResponse{ID: 2, Name: "O'Reilly & Sons", Type: "organization", Aliases: []string{"O'Reilly"}}))
+	require.NoError(t, encoder.Edge(models.KnowledgeEdgeResponse{ID: 3, SourceID: 1, TargetID: 2, RelationshipType: "works_at", DocumentID: &documentID}))
+	require.NoError(t, encoder.End())
+	return b.String()
+}
+
+// wellFormedXML fails the test unless the document parses as XML
+func wellFormedXML(t *testing.T, document string) {
+	decoder := xml.NewDecoder(strings.NewReader(document))
+	for {
+		_, err := decoder.Token()
+		if err == io.EOF {
+			return
+		}
+		require.NoError(t, err, document)
+	}
+}
+
+func TestLookupExportFormat(t *testing.T) {
+	format, err := LookupExportFormat("")
+	require.NoError(t, err)
+	assert.Equal(t, ExportFormatGraphML, format.Name)
+
+	format, err = LookupExportFormat("GEXF")
+	require.NoError(t, err)
+	assert.Equal(t, "application/gexf+xml", format.ContentType)
+
+	_, err = LookupExportFormat("csv")
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+}
+
+func TestGraphMLExport(t *testing.T) {
+	document := exportTestGraph(t, ExportFormatGraphML)
+	wellFormedXML(t, document)
+	assert.Contains(t, document, `<node id="n1">`)
+	assert.Contains(t, document, `<data key="n_name">Jane &#34;JS&#34; Smith</data>`)
+	assert.Contains(t, document, `<data key="n_document_ids">[7,9]</data>`)
+	assert.Contains(t, document, `<edge id="e3" source="n1" target="n2">`)
+	assert.Contains(t, document, `<data key="e_relationship_type">works_at</data>`)
+}
+
+func TestGEXFExport(t *testing.T) {
+	document := exportTestGraph(t, ExportFormatGEXF)
+	wellFormedXML(t, document)
+	assert.Contains(t, document, `<node id="2" label="O&#39;Reilly &amp; Sons">`)
+	assert.Contains(t, document, `<attvalue for="url" value="https://example.com/a?x=1&amp;y=2"/>`)
+	assert.Contains(t, document, `<edge id="3" source="1" target="2" label="works_at">`)
+
+	// A graph without edges has no edges element
+	format, err := LookupExportFormat(ExportFormatGEXF)
+	require.NoError(t, err)
+	var b bytes.Buffer
+	encoder := format.newEncoder(&b)
+	require.NoError(t, encoder.Begin())
+	require.NoError(t, encoder.End())
+	wellFormedXML(t, b.String())
+	assert.NotContains(t, b.String(), "<edges>")
+}
+
+func TestDOTExport(t *testing.T) {
+	document := exportTestGraph(t, ExportFormatDOT)
+	assert.True(t, strings.HasPrefix(document, "digraph knowledge_graph {\n"))
+	assert.Contains(t, document, `n1 [label="Jane \"JS\" Smith", type="person"`)
+	assert.Contains(t, document, `n1 -> n2 [label="works_at", id="e3", document_id="7"];`)
+	assert.True(t, strings.HasSuffix(document, "}\n"))
+}
+
+func TestJSONLDExport(t *testing.T) {
+	var document struct {
+		Context map[string]any   `json:"@context"`
+		Graph   []map[string]any `json:"@graph"`
+	}
+	require.NoError(t, json.Unmarshal([]byte(exportTestGraph(t, ExportFormatJSONLD)), &document))
+	assert.NotEmpty(t, document.Context)
+	require.Len(t, document.Graph, 3)
+	assert.Equal(t, "node:1", document.Graph[0]["@id"])
+	assert.Equal(t, "person", document.Graph[0]["entity_type"])
+	assert.Equal(t, "Relationship", document.Graph[2]["@type"])
+	assert.Equal(t, "node:2", document.Graph[2]["target"])
+}
+
+func TestCypherExport(t *testing.T) {
+	document := exportTestGraph(t, ExportFormatCypher)
+	lines := strings.Split(strings.TrimSpace(document), "\n")
+	require.Len(t, lines, 4)
+	assert.Contains(t, lines[0], "CREATE CONSTRAINT")
+	assert.Equal(t, `MERGE (n:Entity {id: 2}) SET n:`+"`organization`"+`, n.name = 'O\'Reilly & Sons', n.type = 'organization', n.aliases = ['O\'Reilly'];`, lines[2])
+	assert.Contains(t, lines[1], `n.properties = '{"confidence":0.5,"extractor":"regex"}'`)
+	assert.Equal(t, "MATCH (s:Entity {id: 1}), (t:Entity {id: 2}) MERGE (s)-[r:`works_at` {id: 3}]->(t) SET r.document_id = 7;", lines[3])
+}
+
+func TestExportScopeSQL(t *testing.T) {
+	where, args := exportScopeSQL(&models.GraphExportRequest{})
+	assert.Empty(t, where)
+	assert.Empty(t, args)
+
+	documentID := 4
+	where, args = exportScopeSQL(&models.GraphExportRequest{DocumentID: &documentID, Query: " acme "})
+	assert.Contains(t, where, "m.document_id = $1")
+	assert.Contains(t, where, "kn.name ILIKE $2")
+	assert.Equal(t, []interface{}{4, "%acme%"}, args)
+
+	// Wildcards in the query match literally
+	_, args = exportScopeSQL(&models.GraphExportRequest{Query: "50%_off"})
+	assert.Equal(t, []interface{}{`%50\%\_off%`}, args)
+}
@@ -0,0 +1,362 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+const (
+	// maxGraphSeeds bounds the nodes linked to a query by name and by embedding each
+	maxGraphSeeds = 10
+	// maxGraphNodes bounds the nodes of the traversed subgraph
+	maxGraphNodes = 50
+	// maxGraphDocuments bounds the documents whose chunks are ranked by the graph
+	maxGraphDocuments = 20
+	// graphChunksPerDocument is the number of chunks taken from each graph document
+	graphChunksPerDocument = 3
+	// maxPhraseWords is the length of the longest query phrase matched against node names
+	maxPhraseWords = 3
+)
+
+// graphNode is a node of the traversed subgraph with its distance in hops from
+// the nodes linked to the query
+type graphNode struct {
+	node models.KnowledgeNodeResponse
+	hop  int
+}
+
+// graphAugment ranks chunks of the documents reached through the knowledge
+// graph and fuses that ranking into the hits:
+//
+//	score += graph_weight / (k + graph_rank)
+//
+// scaled like the fused score, so that the graph weight is relative to the
+// vector and keyword weights. Hits found by the graph are boosted, and chunks only found by the graph are
+// added. Every hit is given the names of the reached nodes its document
+// mentions as related nodes. The traversed subgraph is returned with the hits.
+func (s *RAGService) graphAugment(ctx context.Context, query string, queryEmbedding pgvector.Vector, hits []searchHit, filters *models.QueryFilters, opts queryOptions) ([]searchHit, *models.KnowledgeGraph, error) {
+	seeds, err := s.linkQueryNodes(ctx, query, queryEmbedding, opts.graphNodeDistance)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	nodes, edges, err := s.traverseGraph(ctx, seeds, opts.graphHops)
+	if err != nil {
+		return nil, nil, err
+	}
+	graph := &models.KnowledgeGraph{Nodes: []models.KnowledgeNodeResponse{}, Edges: edges}
+	for _, n := range nodes {
+		graph.Nodes = append(graph.Nodes, n.node)
+	}
+
+	documentIDs, documentScores := graphDocuments(nodes)
+	if len(documentIDs) > 0 && opts.graphWeight > 0 {
+		ranked, err := s.graphChunks(ctx, queryEmbedding, documentIDs, documentScores, filters, opts)
+		if err != nil {
+			return nil, nil, err
+		}
+		hits = fuseGraphRanking(hits, ranked, opts.graphWeight*opts.fusionScale(), opts.rrfK, opts.minScore)
+	}
+
+	related := relatedNodeNames(nodes)
+	for i := range hits {
+		hits[i].result.RelatedNodes = related[hits[i].result.DocumentID]
+	}
+
+	return hits, graph, nil
+}
+
+// linkQueryNodes returns the IDs of the nodes whose name is a phrase of the
+// query or whose embedding is within maxDistance of the query embedding
+func (s *RAGService) linkQueryNodes(ctx context.Context, query string, queryEmbedding pgvector.Vector, maxDistance float64) ([]int, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		(SELECT id FROM knowledge_nodes WHERE lower(name) = ANY($1::text[]) ORDER BY id LIMIT $4)
+		UNION
+		(SELECT id FROM knowledge_nodes
+		 WHERE embedding <=> $2 < $3::float8
+		 ORDER BY embedding <=> $2, id
+		 LIMIT $4)
+	`, pq.Array(queryPhrases(query)), queryEmbedding, maxDistance, maxGraphSeeds)
+	if err != nil {
+		return nil, fmt.Errorf("failed to link query to knowledge nodes: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		ids = append(ids, id)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+
+	return ids, nil
+}
+
+// queryPhrases returns the lowercase runs of one to maxPhraseWords words of
+// the query that may name a node. Single words must be keywords, so that
+// stop words do not link to nodes.
+func queryPhrases(query string) []string {
+	var words []string
+	for _, word := range strings.Fields(strings.ToLower(query)) {
+		if word = strings.Trim(word, ".,!?;:()[]{}'\""); word != "" {
+			words = append(words, word)
+		}
+	}
+
+	phrases := extractKeywords(query)
+	seen := make(map[string]bool)
+	for _, phrase := range phrases {
+		seen[phrase] = true
+	}
+	for n := 2; n <= maxPhraseWords; n++ {
+		for i := 0; i+n <= len(words); i++ {
+			phrase := strings.Join(words[i:i+n], " ")
+			if !seen[phrase] {
+				seen[phrase] = true
+				phrases = append(phrases, phrase)
+			}
+		}
+	}
+	return phrases
+}
+
+// traverseGraph walks up to hops edges in either direction from the seed
+// nodes. The reached nodes are returned closest first with the edges between
+// them.
+func (s *RAGService) traverseGraph(ctx context.Context, seeds []int, hops int) ([]graphNode, []models.KnowledgeEdgeResponse, error) {
+	if len(seeds) == 0 {
+		return nil, []models.KnowledgeEdgeResponse{}, nil
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE walk(id, hop) AS (
+			SELECT unnest($1::integer[]), 0
+			UNION
+			SELECT CASE WHEN e.source_id = w.id THEN e.target_id ELSE e.source_id END, w.hop + 1
+			FROM walk w
+			JOIN knowledge_edges e ON e.source_id = w.id OR e.target_id = w.id
+			WHERE w.hop < $2
+		)
+		SELECT kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title, `+nodeDocumentIDsSQL+`, MIN(w.hop)
+		FROM walk w
+		JOIN knowledge_nodes kn ON kn.id = w.id
+		LEFT JOIN documents d ON d.id = kn.document_id
+		GROUP BY kn.id, d.url, d.title
+		ORDER BY MIN(w.hop), kn.id
+		LIMIT $3
+	`, pq.Array(seeds), hops, maxGraphNodes)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to traverse knowledge graph: %w", err)
+	}
+	defer rows.Close()
+
+	var nodes []graphNode
+	var ids []int64
+	for rows.Next() {
+		var n graphNode
+		var propertiesJSON []byte
+		var docURL, docTitle sql.NullString
+		var mentionedIn pq.Int64Array
+		if err := rows.Scan(&n.node.ID, &n.node.Name, &n.node.Type, &propertiesJSON, &n.node.DocumentID, &docURL, &docTitle, &mentionedIn, &n.hop); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		n.node.DocumentIDs = documentIDs(mentionedIn)
+		if docURL.Valid {
+			n.node.URL = &docURL.String
+		}
+		if docTitle.Valid {
+			n.node.Title = &docTitle.String
+		}
+		if propertiesJSON != nil {
+			if err := json.Unmarshal(propertiesJSON, &n.node.Properties); err != nil {
+				return nil, nil, fmt.Errorf("failed to unmarshal node properties: %w", err)
+			}
+		}
+		nodes = append(nodes, n)
+		ids = append(ids, int64(n.node.ID))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, nil, fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+
+	edges, err := s.edgesBetween(ctx, ids, nil)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return nodes, edges, nil
+}
+
+// graphDocuments scores the documents mentioning the reached nodes, each node
+// adding 1 / (1 + hops) to every document it is mentioned in, and returns the
+// best maxGraphDocuments of them, best first
+func graphDocuments(nodes []graphNode) ([]int, map[int]float64) {
+	scores := make(map[int]float64)
+	var ids []int
+	for _, n := range nodes {
+		for _, id := range n.node.DocumentIDs {
+			if _, ok := scores[id]; !ok {
+				ids = append(ids, id)
+			}
+			scores[id] += 1 / float64(1+n.hop)
+		}
+	}
+
+	sort.SliceStable(ids, func(i, j int) bool {
+		if scores[ids[i]] != scores[ids[j]] {
+			return scores[ids[i]] > scores[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	if len(ids) > maxGraphDocuments {
+		ids = ids[:maxGraphDocuments]
+	}
+	return ids, scores
+}
+
+// graphChunks ranks the chunks of the graph documents that match the filters:
+// documents in order of their graph score, and within each document its
+// graphChunksPerDocument chunks closest to the query
+func (s *RAGService) graphChunks(ctx context.Context, queryEmbedding pgvector.Vector, documentIDs []int, scores map[int]float64, filters *models.QueryFilters, opts queryOptions) ([]searchHit, error) {
+	ids := make([]int64, len(documentIDs))
+	documentScores := make([]float64, len(documentIDs))
+	for i, id := range documentIDs {
+		ids[i] = int64(id)
+		documentScores[i] = scores[id]
+	}
+
+	args := []interface{}{queryEmbedding, pq.Array(ids), pq.Array(documentScores), graphChunksPerDocument, opts.mmr}
+	filter, args, err := queryFilterSQL(filters, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT
+			c.id,
+			c.content,
+			d.id,
+			d.url,
+			d.title,
+			COALESCE(c.metadata->>'section_path', ''),
+			COALESCE(c.chunk_index, 0),
+			COALESCE(c.start_position, 0),
+			COALESCE(c.end_position, 0),
+			c.parent_id,
+			CASE WHEN $5::boolean THEN c.embedding::text END,
+			c.embedding <=> $1
+		FROM unnest($2::integer[], $3::float8[]) AS g(document_id, score)
+		JOIN documents d ON d.id = g.document_id
+		CROSS JOIN LATERAL (
+			SELECT c.*
+			FROM chunks c
+			WHERE c.document_id = g.document_id`+filter+`
+			ORDER BY c.embedding <=> $1, c.id
+			LIMIT $4
+		) c
+		ORDER BY g.score DESC, d.id, c.embedding <=> $1, c.id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query graph chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	for rows.Next() {
+		var hit searchHit
+		var embedding sql.NullString
+		var distance sql.NullFloat64
+		r := &hit.result
+		if err := rows.Scan(&r.ChunkID, &r.Content, &r.DocumentID, &r.URL, &r.Title, &r.SectionPath,
+			&r.ChunkIndex, &r.StartPosition, &r.EndPosition, &hit.parentID, &embedding, &distance); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		if embedding.Valid {
+			var vector pgvector.Vector
+			if err := vector.Parse(embedding.String); err != nil {
+				return nil, fmt.Errorf("failed to parse chunk embedding: %w", err)
+			}
+			hit.embedding = vector.Slice()
+		}
+		if opts.explain {
+			r.Explain = &models.ResultExplanation{MatchedKeywords: []string{}}
+			if distance.Valid {
+				r.Explain.VectorDistance = &distance.Float64
+			}
+		}
+		hits = append(hits, hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chunk rows: %w", err)
+	}
+
+	return hits, nil
+}
+
+// fuseGraphRanking adds weight / (k + rank) to the score of every hit in the
+// graph ranking and appends the ranked chunks missing from the hits, unless
+// their score stays below minScore. The hits are returned best first.
+func fuseGraphRanking(hits, ranked []searchHit, weight float64, k int, minScore float64) []searchHit {
+	index := make(map[int]int, len(hits))
+	for i, hit := range hits {
+		index[hit.result.ChunkID] = i
+	}
+
+	for i, hit := range ranked {
+		rank := i + 1
+		boost := weight / float64(k+rank)
+		if j, ok := index[hit.result.ChunkID]; ok {
+			hits[j].result.Score += boost
+			if e := hits[j].result.Explain; e != nil {
+				e.GraphRank = &rank
+			}
+			continue
+		}
+		if boost < minScore {
+			continue
+		}
+		hit.result.Score = boost
+		if e := hit.result.Explain; e != nil {
+			e.FusionScore = boost
+			e.GraphRank = &rank
+		}
+		index[hit.result.ChunkID] = len(hits)
+		hits = append(hits, hit)
+	}
+
+	sort.SliceStable(hits, func(i, j int) bool {
+		if hits[i].result.Score != hits[j].result.Score {
+			return hits[i].result.Score > hits[j].result.Score
+		}
+		return hits[i].result.ChunkID < hits[j].result.ChunkID
+	})
+	return hits
+}
+
+// relatedNodeNames returns the names of the reached nodes keyed by the
+// documents mentioning them
+func relatedNodeNames(nodes []graphNode) map[int][]string {
+	related := make(map[int][]string)
+	for _, n := range nodes {
+		for _, id := range n.node.DocumentIDs {
+			related[id] = append(related[id], n.node.Name)
+		}
+	}
+	return related
+}
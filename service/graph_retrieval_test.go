@@ -0,0 +1,68 @@
+package service
+
+import (
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestQueryPhrases(t *testing.T) {
+	phrases := queryPhrases("Who founded Bank of America?")
+
+	// Keywords on their own, and every run of two or three words
+	assert.Contains(t, phrases, "founded")
+	assert.Contains(t, phrases, "bank")
+	assert.Contains(t, phrases, "bank of america")
+	assert.Contains(t, phrases, "who founded")
+	// Short and stop words do not stand on their own
+	assert.NotContains(t, phrases, "of")
+}
+
+func TestGraphDocuments(t *testing.T) {
+	nodes := []graphNode{
+		{node: models.KnowledgeNodeResponse{ID: 1, DocumentIDs: []int{7}}, hop: 0},
+		{node: models.KnowledgeNodeResponse{ID: 2, DocumentIDs: []int{8}}, hop: 1},
+		{node: models.KnowledgeNodeResponse{ID: 3, DocumentIDs: []int{8, 9}}, hop: 1},
+		{node: models.KnowledgeNodeResponse{ID: 4}, hop: 1},
+		{node: models.KnowledgeNodeResponse{ID: 5, DocumentIDs: []int{9}}, hop: 2},
+	}
+
+	ids, scores := graphDocuments(nodes)
+	// Two nodes one hop away tie with a linked node; the lower ID wins the tie.
+	// A node mentioned in two documents scores for both.
+	assert.Equal(t, []int{7, 8, 9}, ids)
+	assert.Equal(t, 1.0, scores[7])
+	assert.Equal(t, 1.0, scores[8])
+	assert.InDelta(t, 0.5+1.0/3, scores[9], 1e-9)
+
+	related := relatedNodeNames([]graphNode{
+		{node: models.KnowledgeNodeResponse{Name: "Go", DocumentIDs: []int{7}}},
+		{node: models.KnowledgeNodeResponse{Name: "Google", DocumentIDs: []int{7, 8}}},
+		{node: models.KnowledgeNodeResponse{Name: "Orphan"}},
+	})
+	assert.Equal(t, map[int][]string{7: {"Go", "Google"}, 8: {"Google"}}, related)
+}
+
+func TestFuseGraphRanking(t *testing.T) {
+	hit := func(id int, score float64) searchHit {
+		return searchHit{result: models.SearchResult{ChunkID: id, Score: score, Explain: &models.ResultExplanation{}}}
+	}
+
+	hits := []searchHit{hit(1, 0.012), hit(2, 0.011)}
+	ranked := []searchHit{hit(2, 0), hit(3, 0), hit(4, 0)}
+
+	fused := fuseGraphRanking(hits, ranked, 0.5, 60, 0.008)
+
+	// Chunk 2 is boosted past chunk 1, chunk 3 is added and chunk 4 stays below the minimum score
+	require.Len(t, fused, 3)
+	assert.Equal(t, 2, fused[0].result.ChunkID)
+	assert.InDelta(t, 0.011+0.5/61, fused[0].result.Score, 1e-9)
+	assert.Equal(t, 1, *fused[0].result.Explain.GraphRank)
+	assert.Equal(t, 1, fused[1].result.ChunkID)
+	assert.Nil(t, fused[1].result.Explain.GraphRank)
+	assert.Equal(t, 3, fused[2].result.ChunkID)
+	assert.InDelta(t, 0.5/62, fused[2].result.Score, 1e-9)
+}
@@ -0,0 +1,481 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+)
+
+// ErrInvalidGraphQuery is returned for graph traversal requests with invalid options
+var ErrInvalidGraphQuery = errors.New("invalid graph query")
+
+// Directions in which edges are followed from a node
+const (
+	GraphDirectionOut  = "out"
+	GraphDirectionIn   = "in"
+	GraphDirectionBoth = "both"
+)
+
+const (
+	// defaultNeighborLimit and maxNeighborLimit bound the neighbors returned for a node
+	defaultNeighborLimit = 50
+	maxNeighborLimit     = 500
+	// defaultSubgraphHops and maxSubgraphHops bound the depth of a subgraph
+	defaultSubgraphHops = 2
+	maxSubgraphHops     = 4
+	// defaultSubgraphNodes and maxSubgraphNodes bound the nodes of a subgraph
+	defaultSubgraphNodes = 100
+	maxSubgraphNodes     = 1000
+	// defaultPathHops and maxPathHops bound the length of a shortest path
+	defaultPathHops = 4
+	maxPathHops     = 6
+)
+
+// knowledgeNodeColumns selects the knowledge node kn with its document d, the
+// documents mentioning it and its aliases, in the order scanKnowledgeNode reads them
+const knowledgeNodeColumns = `kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title, ` +
+	nodeDocumentIDsSQL + `, ` + nodeAliasesSQL
+
+// Given the direction as $3, walkEdgesSQL matches the edges leaving or entering
+// the walked node w and walkNextSQL selects the node at their other end
+const (
+	walkEdgesSQL = `(e.source_id = w.id AND $3::text <> 'in') OR (e.target_id = w.id AND $3::text <> 'out')`
+	walkNextSQL  = `CASE WHEN e.source_id = w.id AND $3::text <> 'in' THEN e.target_id ELSE e.source_id END`
+)
+
+// scanKnowledgeNode scans a row selected by knowledgeNodeColumns, followed by
+// any extra columns
+func scanKnowledgeNode(row interface{ Scan(...interface{}) error }, extra ...interface{}) (models.KnowledgeNodeResponse, error) {
+	var node models.KnowledgeNodeResponse
+	var propertiesJSON []byte
+	var docURL, docTitle sql.NullString
+	var mentionedIn pq.Int64Array
+	var aliases pq.StringArray
+	dest := append([]interface{}{&node.ID, &node.Name, &node.Type, &propertiesJSON, &node.DocumentID, &docURL, &docTitle, &mentionedIn, &aliases}, extra...)
+	if err := row.Scan(dest...); err != nil {
+		return node, err
+	}
+
+	if docURL.Valid {
+		node.URL = &docURL.String
+	}
+	if docTitle.Valid {
+		node.Title = &docTitle.String
+	}
+	if propertiesJSON != nil {
+		if err := json.Unmarshal(propertiesJSON, &node.Properties); err != nil {
+			return node, fmt.Errorf("failed to unmarshal node properties: %w", err)
+		}
+	}
+	node.DocumentIDs = documentIDs(mentionedIn)
+	if len(aliases) > 0 {
+		node.Aliases = []string(aliases)
+	}
+	return node, nil
+}
+
+// graphDirection validates a traversal direction, which defaults to both
+func graphDirection(direction string) (string, error) {
+	switch direction = strings.ToLower(strings.TrimSpace(direction)); direction {
+	case "":
+		return GraphDirectionBoth, nil
+	case GraphDirectionOut, GraphDirectionIn, GraphDirectionBoth:
+		return direction, nil
+	default:
+		return "", fmt.Errorf("%w: direction must be out, in or both", ErrInvalidGraphQuery)
+	}
+}
+
+// graphBound validates an optional bound, which defaults to def when zero
+func graphBound(name string, value, def, max int) (int, error) {
+	if value == 0 {
+		return def, nil
+	}
+	if value < 1 || value > max {
+		return 0, fmt.Errorf("%w: %s must be between 1 and %d", ErrInvalidGraphQuery, name, max)
+	}
+	return value, nil
+}
+
+// graphTypes trims a type filter and drops its empty entries. The result is
+// never nil, so that an empty filter is passed to SQL as an empty array.
+func graphTypes(types []string) []string {
+	result := []string{}
+	for _, t := range types {
+		if t = strings.TrimSpace(t); t != "" {
+			result = append(result, t)
+		}
+	}
+	return result
+}
+
+// GetNodeNeighbors returns the nodes linked to a node by a single edge, in the
+// requested direction and optionally restricted to relationship and node types
+func (s *RAGService) GetNodeNeighbors(ctx context.Context, req *models.NeighborsRequest) (*models.NeighborsResponse, error) {
+	direction, err := graphDirection(req.Direction)
+	if err != nil {
+		return nil, err
+	}
+	limit, err := graphBound("limit", req.Limit, defaultNeighborLimit, maxNeighborLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	node, err := s.GetKnowledgeNode(ctx, req.NodeID)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+knowledgeNodeColumns+`,
+			e.id, e.source_id, e.target_id, e.relationship_type, e.properties, e.document_id
+		FROM knowledge_edges e
+		JOIN knowledge_nodes kn ON kn.id = CASE WHEN e.source_id = $1 AND $2::text <> 'in' THEN e.target_id ELSE e.source_id END
+		LEFT JOIN documents d ON d.id = kn.document_id
+		WHERE ((e.source_id = $1 AND $2::text <> 'in') OR (e.target_id = $1 AND $2::text <> 'out'))
+			AND (cardinality($3::text[]) = 0 OR e.relationship_type = ANY($3::text[]))
+			AND (cardinality($4::text[]) = 0 OR kn.type = ANY($4::text[]))
+		ORDER BY e.relationship_type, kn.name, e.id
+		LIMIT $5
+	`, req.NodeID, direction, pq.Array(graphTypes(req.RelationshipTypes)), pq.Array(graphTypes(req.NodeTypes)), limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query node neighbors: %w", err)
+	}
+	defer rows.Close()
+
+	response := &models.NeighborsResponse{Node: *node, Neighbors: []models.NodeNeighbor{}}
+	for rows.Next() {
+		var neighbor models.NodeNeighbor
+		var edgePropertiesJSON []byte
+		edge := &neighbor.Edge
+		neighbor.Node, err = scanKnowledgeNode(rows, &edge.ID, &edge.SourceID, &edge.TargetID, &edge.RelationshipType, &edgePropertiesJSON, &edge.DocumentID)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan node neighbor: %w", err)
+		}
+		if edgePropertiesJSON != nil {
+			if err := json.Unmarshal(edgePropertiesJSON, &edge.Properties); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal edge properties: %w", err)
+			}
+		}
+		neighbor.Direction = GraphDirectionIn
+		if edge.SourceID == req.NodeID && direction != GraphDirectionIn {
+			neighbor.Direction = GraphDirectionOut
+		}
+		response.Neighbors = append(response.Neighbors, neighbor)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating node neighbor rows: %w", err)
+	}
+
+	return response, nil
+}
+
+// GetSubgraph returns the nodes within the requested number of hops of a seed
+// node, closest first, and the edges between them. The walk is a recursive
+// query, so only the reached nodes and their edges are loaded.
+func (s *RAGService) GetSubgraph(ctx context.Context, req *models.SubgraphRequest) (*models.SubgraphResponse, error) {
+	direction, err := graphDirection(req.Direction)
+	if err != nil {
+		return nil, err
+	}
+	hops, err := graphBound("hops", req.Hops, defaultSubgraphHops, maxSubgraphHops)
+	if err != nil {
+		return nil, err
+	}
+	maxNodes, err := graphBound("max_nodes", req.MaxNodes, defaultSubgraphNodes, maxSubgraphNodes)
+	if err != nil {
+		return nil, err
+	}
+	relationshipTypes := graphTypes(req.RelationshipTypes)
+
+	// One node more than requested tells whether the subgraph was truncated
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE walk(id, hop) AS (
+			SELECT id, 0 FROM knowledge_nodes WHERE id = $1
+			UNION
+			SELECT `+walkNextSQL+`, w.hop + 1
+			FROM walk w
+			JOIN knowledge_edges e ON `+walkEdgesSQL+`
+			WHERE w.hop < $2
+				AND (cardinality($4::text[]) = 0 OR e.relationship_type = ANY($4::text[]))
+		)
+		SELECT `+knowledgeNodeColumns+`, MIN(w.hop)
+		FROM walk w
+		JOIN knowledge_nodes kn ON kn.id = w.id
+		LEFT JOIN documents d ON d.id = kn.document_id
+		GROUP BY kn.id, d.url, d.title
+		ORDER BY MIN(w.hop), kn.id
+		LIMIT $5
+	`, req.NodeID, hops, direction, pq.Array(relationshipTypes), maxNodes+1)
+	if err != nil {
+		return nil, fmt.Errorf("failed to traverse knowledge graph: %w", err)
+	}
+	defer rows.Close()
+
+	response := &models.SubgraphResponse{SeedID: req.NodeID, Hops: hops, Nodes: []models.SubgraphNode{}}
+	var ids []int64
+	for rows.Next() {
+		var n models.SubgraphNode
+		n.KnowledgeNodeResponse, err = scanKnowledgeNode(rows, &n.Hop)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		response.Nodes = append(response.Nodes, n)
+		ids = append(ids, int64(n.ID))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+
+	// The seed is always reached, so no rows means it does not exist
+	if len(response.Nodes) == 0 {
+		return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, req.NodeID)
+	}
+	if len(response.Nodes) > maxNodes {
+		response.Nodes = response.Nodes[:maxNodes]
+		ids = ids[:maxNodes]
+		response.Truncated = true
+	}
+
+	response.Edges, err = s.edgesBetween(ctx, ids, relationshipTypes)
+	if err != nil {
+		return nil, err
+	}
+
+	return response, nil
+}
+
+// FindPath returns a shortest path of at most the requested number of hops
+// between two nodes. A recursive query computes the distance from the source
+// of the nodes closer than the target, and the path is traced back from the
+// target through the edges between them.
+func (s *RAGService) FindPath(ctx context.Context, req *models.PathRequest) (*models.PathResponse, error) {
+	direction, err := graphDirection(req.Direction)
+	if err != nil {
+		return nil, err
+	}
+	maxHops, err := graphBound("max_hops", req.MaxHops, defaultPathHops, maxPathHops)
+	if err != nil {
+		return nil, err
+	}
+	relationshipTypes := graphTypes(req.RelationshipTypes)
+
+	ends, err := s.knowledgeNodesByID(ctx, []int{req.SourceID, req.TargetID})
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range []int{req.SourceID, req.TargetID} {
+		if _, ok := ends[id]; !ok {
+			return nil, fmt.Errorf("%w: %d", ErrNodeNotFound, id)
+		}
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH RECURSIVE walk(id, hop) AS (
+			SELECT $1::integer, 0
+			UNION
+			SELECT `+walkNextSQL+`, w.hop + 1
+			FROM walk w
+			JOIN knowledge_edges e ON `+walkEdgesSQL+`
+			WHERE w.hop < $4 AND w.id <> $2
+				AND (cardinality($5::text[]) = 0 OR e.relationship_type = ANY($5::text[]))
+		),
+		distance AS (SELECT id, MIN(hop) AS hop FROM walk GROUP BY id)
+		SELECT id, hop FROM distance
+		WHERE id = $2 OR hop < (SELECT hop FROM distance WHERE id = $2)
+	`, req.SourceID, req.TargetID, direction, maxHops, pq.Array(relationshipTypes))
+	if err != nil {
+		return nil, fmt.Errorf("failed to search knowledge graph path: %w", err)
+	}
+	defer rows.Close()
+
+	distances := make(map[int]int)
+	var ids []int64
+	for rows.Next() {
+		var id, hop int
+		if err := rows.Scan(&id, &hop); err != nil {
+			return nil, fmt.Errorf("failed to scan path distance: %w", err)
+		}
+		distances[id] = hop
+		ids = append(ids, int64(id))
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating path distance rows: %w", err)
+	}
+
+	response := &models.PathResponse{Nodes: []models.KnowledgeNodeResponse{}, Edges: []models.KnowledgeEdgeResponse{}}
+	if _, ok := distances[req.TargetID]; !ok {
+		return response, nil
+	}
+
+	edges, err := s.edgesBetween(ctx, ids, relationshipTypes)
+	if err != nil {
+		return nil, err
+	}
+	nodeIDs, pathEdges, ok := shortestPath(distances, edges, req.SourceID, req.TargetID, direction)
+	if !ok {
+		return response, nil
+	}
+
+	nodes, err := s.knowledgeNodesByID(ctx, nodeIDs)
+	if err != nil {
+		return nil, err
+	}
+	for _, id := range nodeIDs {
+		node, ok := nodes[id]
+		if !ok {
+			// The node was deleted while the path was traced
+			return response, nil
+		}
+		response.Nodes = append(response.Nodes, node)
+	}
+	response.Found = true
+	response.Hops = len(pathEdges)
+	response.Edges = pathEdges
+	return response, nil
+}
+
+// shortestPath traces a path back from the target to the source given the
+// distance from the source of the nodes closer than the target. Each step
+// follows the lowest ID edge, in the walk direction, to a node one hop closer.
+// The path nodes and edges are returned from the source to the target.
+func shortestPath(distances map[int]int, edges []models.KnowledgeEdgeResponse, source, target int, direction string) ([]int, []models.KnowledgeEdgeResponse, bool) {
+	hop, ok := distances[target]
+	if !ok {
+		return nil, nil, false
+	}
+
+	nodes := []int{target}
+	path := []models.KnowledgeEdgeResponse{}
+	for current := target; hop > 0; hop-- {
+		step, previous, found := models.KnowledgeEdgeResponse{}, 0, false
+	edges:
+		for _, edge := range edges {
+			// The walk reached current through the edge from its other end
+			var candidates []int
+			if edge.TargetID == current && direction != GraphDirectionIn {
+				candidates = append(candidates, edge.SourceID)
+			}
+			if edge.SourceID == current && direction != GraphDirectionOut {
+				candidates = append(candidates, edge.TargetID)
+			}
+			for _, candidate := range candidates {
+				if d, ok := distances[candidate]; ok && d == hop-1 {
+					step, previous, found = edge, candidate, true
+					break edges
+				}
+			}
+		}
+		if !found {
+			return nil, nil, false
+		}
+		nodes = append(nodes, previous)
+		path = append(path, step)
+		current = previous
+	}
+	if nodes[len(nodes)-1] != source {
+		return nil, nil, false
+	}
+
+	for i, j := 0, len(nodes)-1; i < j; i, j = i+1, j-1 {
+		nodes[i], nodes[j] = nodes[j], nodes[i]
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return nodes, path, true
+}
+
+// FindKnowledgeNode returns the node named name, or having it as an alias,
+// ignoring case. Of several such nodes the most mentioned one is returned.
+func (s *RAGService) FindKnowledgeNode(ctx context.Context, name string) (*models.KnowledgeNodeResponse, error) {
+	row := s.db.QueryRowContext(ctx, `
+		SELECT `+knowledgeNodeColumns+`
+		FROM knowledge_nodes kn
+		LEFT JOIN documents d ON d.id = kn.document_id
+		WHERE lower(kn.name) = lower($1)
+			OR EXISTS (SELECT 1 FROM node_aliases a WHERE a.node_id = kn.id AND lower(a.alias) = lower($1))
+		ORDER BY (SELECT COUNT(*) FROM node_mentions m WHERE m.node_id = kn.id) DESC, kn.id
+		LIMIT 1
+	`, strings.TrimSpace(name))
+	node, err := scanKnowledgeNode(row)
+	if err == sql.ErrNoRows {
+		return nil, fmt.Errorf("%w: %s", ErrNodeNotFound, name)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to find knowledge node: %w", err)
+	}
+	return &node, nil
+}
+
+// knowledgeNodesByID returns the nodes with the given IDs that exist, keyed by ID
+func (s *RAGService) knowledgeNodesByID(ctx context.Context, ids []int) (map[int]models.KnowledgeNodeResponse, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT `+knowledgeNodeColumns+`
+		FROM knowledge_nodes kn
+		LEFT JOIN documents d ON d.id = kn.document_id
+		WHERE kn.id = ANY($1)
+	`, pq.Array(ids))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge nodes: %w", err)
+	}
+	defer rows.Close()
+
+	nodes := make(map[int]models.KnowledgeNodeResponse)
+	for rows.Next() {
+		node, err := scanKnowledgeNode(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		nodes[node.ID] = node
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+
+	return nodes, nil
+}
+
+// edgesBetween returns the edges whose ends are both among the given nodes,
+// of the given relationship types if any, in ID order
+func (s *RAGService) edgesBetween(ctx context.Context, ids []int64, relationshipTypes []string) ([]models.KnowledgeEdgeResponse, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, source_id, target_id, relationship_type, properties, document_id
+		FROM knowledge_edges
+		WHERE source_id = ANY($1) AND target_id = ANY($1)
+			AND (cardinality($2::text[]) = 0 OR relationship_type = ANY($2::text[]))
+		ORDER BY id
+	`, pq.Array(ids), pq.Array(graphTypes(relationshipTypes)))
+	if err != nil {
+		return nil, fmt.Errorf("failed to query knowledge edges: %w", err)
+	}
+	defer rows.Close()
+
+	edges := []models.KnowledgeEdgeResponse{}
+	for rows.Next() {
+		var edge models.KnowledgeEdgeResponse
+		var propertiesJSON []byte
+		if err := rows.Scan(&edge.ID, &edge.SourceID, &edge.TargetID, &edge.RelationshipType, &propertiesJSON, &edge.DocumentID); err != nil {
+			return nil, fmt.Errorf("failed to scan knowledge edge: %w", err)
+		}
+		if propertiesJSON != nil {
+			if err := json.Unmarshal(propertiesJSON, &edge.Properties); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal edge properties: %w", err)
+			}
+		}
+		edges = append(edges, edge)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating knowledge edge rows: %w", err)
+	}
+
+	return edges, nil
+}
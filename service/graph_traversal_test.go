@@ -0,0 +1,80 @@
+package service
+
+import (
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGraphDirection(t *testing.T) {
+	direction, err := graphDirection("")
+	require.NoError(t, err)
+	assert.Equal(t, GraphDirectionBoth, direction)
+
+	direction, err = graphDirection(" OUT ")
+	require.NoError(t, err)
+	assert.Equal(t, GraphDirectionOut, direction)
+
+	_, err = graphDirection("sideways")
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+}
+
+func TestGraphBound(t *testing.T) {
+	value, err := graphBound("hops", 0, defaultSubgraphHops, maxSubgraphHops)
+	require.NoError(t, err)
+	assert.Equal(t, defaultSubgraphHops, value)
+
+	value, err = graphBound("hops", 3, defaultSubgraphHops, maxSubgraphHops)
+	require.NoError(t, err)
+	assert.Equal(t, 3, value)
+
+	_, err = graphBound("hops", maxSubgraphHops+1, defaultSubgraphHops, maxSubgraphHops)
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+	_, err = graphBound("hops", -1, defaultSubgraphHops, maxSubgraphHops)
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+}
+
+func TestGraphTypes(t *testing.T) {
+	assert.Equal(t, []string{}, graphTypes(nil))
+	assert.Equal(t, []string{"works_at", "uses"}, graphTypes([]string{" works_at", "", "uses "}))
+}
+
+func TestShortestPath(t *testing.T) {
+	// 1 -works_at-> 2 -uses-> 3 <-created- 4, and a longer way round 1 -knows-> 5 -knows-> 6 -knows-> 4
+	edges := []models.KnowledgeEdgeResponse{
+		{ID: 1, SourceID: 1, TargetID: 2, RelationshipType: "works_at"},
+		{ID: 2, SourceID: 2, TargetID: 3, RelationshipType: "uses"},
+		{ID: 3, SourceID: 4, TargetID: 3, RelationshipType: "created"},
+		{ID: 4, SourceID: 1, TargetID: 5, RelationshipType: "knows"},
+		{ID: 5, SourceID: 5, TargetID: 6, RelationshipType: "knows"},
+	}
+	distances := map[int]int{1: 0, 2: 1, 5: 1, 3: 2, 6: 2, 4: 3}
+
+	nodes, path, ok := shortestPath(distances, edges, 1, 4, GraphDirectionBoth)
+	require.True(t, ok)
+	assert.Equal(t, []int{1, 2, 3, 4}, nodes)
+	require.Len(t, path, 3)
+	assert.Equal(t, 1, path[0].ID)
+	assert.Equal(t, 3, path[2].ID)
+
+	// Following edges forwards, node 4 can only be reached by an edge leaving it
+	_, _, ok = shortestPath(distances, edges, 1, 4, GraphDirectionOut)
+	assert.False(t, ok)
+
+	nodes, path, ok = shortestPath(map[int]int{3: 0, 2: 1, 1: 2}, edges, 3, 1, GraphDirectionIn)
+	require.True(t, ok)
+	assert.Equal(t, []int{3, 2, 1}, nodes)
+	assert.Len(t, path, 2)
+
+	// A path from a node to itself has no edges
+	nodes, path, ok = shortestPath(map[int]int{1: 0}, edges, 1, 1, GraphDirectionBoth)
+	require.True(t, ok)
+	assert.Equal(t, []int{1}, nodes)
+	assert.Empty(t, path)
+
+	_, _, ok = shortestPath(distances, edges, 1, 7, GraphDirectionBoth)
+	assert.False(t, ok)
+}
@@ -0,0 +1,190 @@
+package service
+
+import (
+	"strconv"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+)
+
+// blockElements are rendered as blocks of their own; other elements are
+// treated as inline text of the surrounding paragraph
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "body": true, "details": true, "dd": true,
+	"div": true, "dl": true, "dt": true, "fieldset": true, "figcaption": true, "figure": true,
+	"footer": true, "form": true, "header": true, "main": true, "nav": true, "section": true,
+	"summary": true,
+}
+
+// skippedElements carry no readable content
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true, "svg": true,
+	"iframe": true, "head": true, "#comment": true, "hr": true,
+}
+
+// htmlToMarkdown renders the readable content of sel as markdown, keeping
+// headings, paragraphs, lists, code blocks, tables and block quotes so that
+// the markdown chunker can follow the structure of the page
+func htmlToMarkdown(sel *goquery.Selection) string {
+	w := &markdownWriter{}
+	w.walk(sel)
+	w.flush()
+	return strings.Join(w.blocks, "\n\n")
+}
+
+// markdownWriter collects markdown blocks, buffering inline text until the
+// next block boundary
+type markdownWriter struct {
+	blocks []string
+	inline strings.Builder
+}
+
+// flush emits the buffered inline text as a paragraph
+func (w *markdownWriter) flush() {
+	if text := collapseWhitespace(w.inline.String()); text != "" {
+		w.blocks = append(w.blocks, text)
+	}
+	w.inline.Reset()
+}
+
+// block emits a block after any buffered inline text
+func (w *markdownWriter) block(text string) {
+	w.flush()
+	if text != "" {
+		w.blocks = append(w.blocks, text)
+	}
+}
+
+// walk renders the children of sel
+func (w *markdownWriter) walk(sel *goquery.Selection) {
+	sel.Contents().Each(func(_ int, child *goquery.Selection) {
+		name := goquery.NodeName(child)
+		switch {
+		case name == "#text":
+			w.inline.WriteString(child.Text())
+		case skippedElements[name]:
+		case len(name) == 2 && name[0] == 'h' && name[1] >= '1' && name[1] <= '6':
+			if text := collapseWhitespace(child.Text()); text != "" {
+				w.block(strings.Repeat("#", int(name[1]-'0')) + " " + text)
+			}
+		case name == "p":
+			w.flush()
+			w.walk(child)
+			w.flush()
+		case name == "br":
+			w.flush()
+		case name == "pre":
+			w.block(renderCodeBlock(child))
+		case name == "ul" || name == "ol":
+			w.block(strings.Join(renderList(child, 0), "\n"))
+		case name == "table":
+			w.block(renderTable(child))
+		case name == "blockquote":
+			w.block(renderBlockquote(child))
+		case blockElements[name]:
+			w.flush()
+			w.walk(child)
+			w.flush()
+		default:
+			w.walk(child)
+		}
+	})
+}
+
+// collapseWhitespace joins the words of text with single spaces
+func collapseWhitespace(text string) string {
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// renderCodeBlock renders a pre element as a fenced code block
+func renderCodeBlock(sel *goquery.Selection) string {
+	code := strings.Trim(sel.Text(), "\n")
+	if strings.TrimSpace(code) == "" {
+		return ""
+	}
+
+	fence := "```"
+	if strings.Contains(code, fence) {
+		fence = "~~~"
+	}
+
+	// Highlighters commonly mark the language as class="language-go"
+	language := ""
+	if class, ok := sel.Find("code").Attr("class"); ok {
+		for _, name := range strings.Fields(class) {
+			if strings.HasPrefix(name, "language-") {
+				language = strings.TrimPrefix(name, "language-")
+				break
+			}
+		}
+	}
+
+	return fence + language + "\n" + code + "\n" + fence
+}
+
+// renderList renders a ul or ol element as list lines, indenting nested lists
+func renderList(sel *goquery.Selection, depth int) []string {
+	var lines []string
+	indent := strings.Repeat("  ", depth)
+	ordered := goquery.NodeName(sel) == "ol"
+
+	sel.ChildrenFiltered("li").Each(func(i int, item *goquery.Selection) {
+		marker := "-"
+		if ordered {
+			marker = strconv.Itoa(i+1) + "."
+		}
+
+		// The item text excludes nested lists, which are rendered below it
+		clone := item.Clone()
+		clone.Find("ul, ol").Remove()
+		if text := collapseWhitespace(clone.Text()); text != "" {
+			lines = append(lines, indent+marker+" "+text)
+		}
+
+		item.Find("ul, ol").FilterFunction(func(_ int, nested *goquery.Selection) bool {
+			// Only lists directly nested in this item, deeper ones are rendered recursively
+			return nested.ParentsFiltered("ul, ol").First().IsSelection(sel)
+		}).Each(func(_ int, nested *goquery.Selection) {
+			lines = append(lines, renderList(nested, depth+1)...)
+		})
+	})
+
+	return lines
+}
+
+// renderTable renders a table element as a markdown table
+func renderTable(sel *goquery.Selection) string {
+	var rows []string
+	sel.Find("tr").Each(func(_ int, row *goquery.Selection) {
+		var cells []string
+		row.ChildrenFiltered("th, td").Each(func(_ int, cell *goquery.Selection) {
+			cells = append(cells, strings.ReplaceAll(collapseWhitespace(cell.Text()), "|", `\|`))
+		})
+		if len(cells) == 0 {
+			return
+		}
+		rows = append(rows, "| "+strings.Join(cells, " | ")+" |")
+		if len(rows) == 1 {
+			rows = append(rows, "|"+strings.Repeat(" --- |", len(cells)))
+		}
+	})
+	return strings.Join(rows, "\n")
+}
+
+// renderBlockquote renders a blockquote element with its contents quoted line by line
+func renderBlockquote(sel *goquery.Selection) string {
+	inner := htmlToMarkdown(sel)
+	if inner == "" {
+		return ""
+	}
+
+	lines := strings.Split(inner, "\n")
+	for i, line := range lines {
+		if line == "" {
+			lines[i] = ">"
+		} else {
+			lines[i] = "> " + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTMLToMarkdown(t *testing.T) {
+	page := `<html><head><title>Docs</title></head><body>
+		<nav>Home</nav>
+		<h1>Install</h1>
+		<p>Download the <a href="/releases">latest release</a>.</p>
+		<h2>Linux</h2>
+		<pre><code class="language-sh">./install.sh
+echo done</code></pre>
+		<ul>
+			<li>One</li>
+			<li>Two
+				<ol><li>Nested</li></ol>
+			</li>
+		</ul>
+		<table><tr><th>Flag</th><th>Meaning</th></tr><tr><td>-v</td><td>Verbose</td></tr></table>
+		<blockquote><p>Note this.</p></blockquote>
+		<script>var x = 1;</script>
+	</body></html>`
+
+	doc, err := goquery.NewDocumentFromReader(strings.NewReader(page))
+	require.NoError(t, err)
+
+	expected := strings.Join([]string{
+		"Home",
+		"# Install",
+		"Download the latest release.",
+		"## Linux",
+		"```sh\n./install.sh\necho done\n```",
+		"- One\n- Two\n  1. Nested",
+		"| Flag | Meaning |\n| --- | --- |\n| -v | Verbose |",
+		"> Note this.",
+	}, "\n\n")
+	assert.Equal(t, expected, htmlToMarkdown(doc.Find("body")))
+}
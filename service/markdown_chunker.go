@@ -0,0 +1,287 @@
+package service
+
+import (
+	"regexp"
+	"strings"
+)
+
+// SectionPathSeparator joins the headings of a section path
+const SectionPathSeparator = " > "
+
+// Markdown block kinds
+const (
+	mdHeading = iota
+	mdParagraph
+	mdCode
+	mdList
+	mdTable
+	mdQuote
+)
+
+var (
+	atxHeadingPattern    = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]+(.*?))?[ \t]*$`)
+	setextPattern        = regexp.MustCompile(`^ {0,3}(=+|-+)[ \t]*$`)
+	fencePattern         = regexp.MustCompile("^ {0,3}(```+|~~~+)")
+	listItemPattern      = regexp.MustCompile(`^[ \t]*(?:[-*+]|\d{1,9}[.)])(?:[ \t]+|$)`)
+	closingHashesPattern = regexp.MustCompile(`[ \t]+#+$`)
+)
+
+// mdBlock is a structural block of a markdown document
+type mdBlock struct {
+	span
+	kind int
+	// path holds the headings the block is nested under, including the block itself for headings
+	path []string
+}
+
+// line is a line of content without its line terminator
+type line struct {
+	start int
+	end   int
+	text  string
+}
+
+// splitLines returns the lines of content with their byte offsets
+func splitLines(content string) []line {
+	var lines []line
+	for start := 0; start < len(content); {
+		end := strings.IndexByte(content[start:], '\n')
+		next := start + end + 1
+		if end < 0 {
+			end = len(content) - start
+			next = len(content)
+		}
+		text := strings.TrimSuffix(content[start:start+end], "\r")
+		lines = append(lines, line{start: start, end: start + len(text), text: text})
+		start = next
+	}
+	return lines
+}
+
+func isBlankLine(text string) bool {
+	return strings.TrimSpace(text) == ""
+}
+
+// parseMarkdownBlocks splits content into headings, paragraphs, fenced code
+// blocks, lists, tables and block quotes, recording the heading path of each
+func parseMarkdownBlocks(content string) []mdBlock {
+	lines := splitLines(content)
+	var blocks []mdBlock
+	var headings []string
+	var levels []int
+
+	addHeading := func(level int, title string, sp span) {
+		// Pop headings at the same or a deeper level
+		for len(levels) > 0 && levels[len(levels)-1] >= level {
+			levels = levels[:len(levels)-1]
+			headings = headings[:len(headings)-1]
+		}
+		levels = append(levels, level)
+		headings = append(headings, title)
+		blocks = append(blocks, mdBlock{span: sp, kind: mdHeading, path: append([]string(nil), headings...)})
+	}
+	addBlock := func(kind int, first, last line) {
+		blocks = append(blocks, mdBlock{span: span{start: first.start, end: last.end}, kind: kind, path: append([]string(nil), headings...)})
+	}
+
+	for i := 0; i < len(lines); {
+		text := lines[i].text
+		if isBlankLine(text) {
+			i++
+			continue
+		}
+
+		// ATX headings such as "## Install"
+		if m := atxHeadingPattern.FindStringSubmatch(text); m != nil {
+			title := strings.TrimSpace(closingHashesPattern.ReplaceAllString(m[2], ""))
+			if title != "" {
+				addHeading(len(m[1]), title, span{start: lines[i].start, end: lines[i].end})
+			}
+			i++
+			continue
+		}
+
+		// Fenced code blocks run to the matching closing fence
+		if m := fencePattern.FindStringSubmatch(text); m != nil {
+			fence := m[1]
+			j := i + 1
+			for j < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[j].text), fence) {
+				j++
+			}
+			if j == len(lines) {
+				j--
+			}
+			addBlock(mdCode, lines[i], lines[j])
+			i = j + 1
+			continue
+		}
+
+		// Lists run until a blank line followed by unindented text that is not a list item
+		if listItemPattern.MatchString(text) {
+			j := i
+			for j+1 < len(lines) {
+				next := lines[j+1].text
+				if isBlankLine(next) {
+					k := j + 1
+					for k < len(lines) && isBlankLine(lines[k].text) {
+						k++
+					}
+					if k == len(lines) || !(listItemPattern.MatchString(lines[k].text) || startsIndented(lines[k].text)) {
+						break
+					}
+					j = k
+					continue
+				}
+				if atxHeadingPattern.MatchString(next) || fencePattern.MatchString(next) {
+					break
+				}
+				j++
+			}
+			addBlock(mdList, lines[i], lines[j])
+			i = j + 1
+			continue
+		}
+
+		// Tables and block quotes are runs of lines with the same prefix
+		if prefix := linePrefix(text); prefix != "" {
+			j := i
+			for j+1 < len(lines) && linePrefix(lines[j+1].text) == prefix {
+				j++
+			}
+			kind := mdTable
+			if prefix == ">" {
+				kind = mdQuote
+			}
+			addBlock(kind, lines[i], lines[j])
+			i = j + 1
+			continue
+		}
+
+		// Paragraphs run until a blank line or the start of another block
+		j := i
+		for j+1 < len(lines) {
+			next := lines[j+1].text
+			if isBlankLine(next) || atxHeadingPattern.MatchString(next) || fencePattern.MatchString(next) ||
+				listItemPattern.MatchString(next) {
+				break
+			}
+			// A setext underline turns the paragraph into a heading
+			if j == i && setextPattern.MatchString(next) {
+				break
+			}
+			j++
+		}
+		if j+1 < len(lines) && j == i {
+			if m := setextPattern.FindStringSubmatch(lines[j+1].text); m != nil {
+				level := 1
+				if m[1][0] == '-' {
+					level = 2
+				}
+				addHeading(level, strings.TrimSpace(text), span{start: lines[i].start, end: lines[j+1].end})
+				i = j + 2
+				continue
+			}
+		}
+		addBlock(mdParagraph, lines[i], lines[j])
+		i = j + 1
+	}
+
+	return blocks
+}
+
+func startsIndented(text string) bool {
+	return strings.HasPrefix(text, "  ") || strings.HasPrefix(text, "\t")
+}
+
+// linePrefix returns "|" for table rows, ">" for block quotes and "" otherwise
+func linePrefix(text string) string {
+	trimmed := strings.TrimLeft(text, " \t")
+	switch {
+	case strings.HasPrefix(trimmed, "|"):
+		return "|"
+	case strings.HasPrefix(trimmed, ">"):
+		return ">"
+	default:
+		return ""
+	}
+}
+
+// MarkdownChunker splits content along its heading structure. Chunks never
+// span two sections, and headings, lists, code blocks, tables and block
+// quotes are kept whole unless they are larger than a chunk on their own.
+// Each chunk records its heading breadcrumb in SectionPath. Content without
+// markdown structure is packed paragraph by paragraph and sentence by sentence.
+type MarkdownChunker struct {
+	Size    int
+	Overlap int
+}
+
+// Chunk splits content into section-aligned chunks
+func (c *MarkdownChunker) Chunk(content string) []ChunkInfo {
+	var chunks []ChunkInfo
+	var pieces []span
+	var path []string
+	hasBody := false
+
+	flush := func() {
+		if len(pieces) == 0 {
+			return
+		}
+		sectionPath := strings.Join(path, SectionPathSeparator)
+		for _, chunk := range spansToChunks(content, mergeSpans(content, pieces, c.Size, c.Overlap)) {
+			chunk.ChunkIndex = len(chunks)
+			chunk.SectionPath = sectionPath
+			chunks = append(chunks, chunk)
+		}
+		pieces = nil
+		hasBody = false
+	}
+
+	for _, block := range parseMarkdownBlocks(content) {
+		if block.kind == mdHeading {
+			// A heading directly followed by a sub-heading stays with it rather
+			// than forming a chunk of its own
+			if hasBody || len(block.path) <= len(path) {
+				flush()
+			}
+			path = block.path
+			pieces = append(pieces, block.span)
+			continue
+		}
+		hasBody = true
+		pieces = append(pieces, c.blockPieces(content, block)...)
+	}
+	flush()
+
+	return chunks
+}
+
+// blockPieces returns the block as a single piece, or split into pieces of at
+// most c.Size tokens when it is too large
+func (c *MarkdownChunker) blockPieces(content string, block mdBlock) []span {
+	if estimateTokens(content[block.start:block.end]) <= c.Size {
+		return []span{block.span}
+	}
+
+	var parts []span
+	if block.kind == mdParagraph || block.kind == mdQuote {
+		for _, sentence := range splitSentences(content[block.start:block.end]) {
+			parts = append(parts, span{start: block.start + sentence.start, end: block.start + sentence.end})
+		}
+	} else {
+		// Code, lists and tables are split on line boundaries
+		for _, l := range splitLines(content[block.start:block.end]) {
+			parts = append(parts, span{start: block.start + l.start, end: block.start + l.end})
+		}
+	}
+
+	var pieces []span
+	for _, part := range parts {
+		if estimateTokens(content[part.start:part.end]) > c.Size {
+			pieces = append(pieces, tokenWindowSpans(content, part, c.Size, c.Overlap)...)
+			continue
+		}
+		pieces = append(pieces, part)
+	}
+	return pieces
+}
@@ -0,0 +1,106 @@
+package service
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const markdownDoc = `# Install
+
+Download the release for your platform.
+
+## Linux
+
+Run the installer:
+
+` + "```sh" + `
+curl -sSL https://example.com/install.sh | sh
+
+echo done
+` + "```" + `
+
+### Troubleshooting
+
+- Check the logs.
+- Restart the service:
+
+  systemctl restart rag
+- Ask for help.
+
+# Usage
+Usage
+-----
+
+| Flag | Meaning |
+| --- | --- |
+| -v | Verbose |
+`
+
+func TestParseMarkdownBlocks(t *testing.T) {
+	blocks := parseMarkdownBlocks(markdownDoc)
+
+	var kinds []int
+	for _, block := range blocks {
+		kinds = append(kinds, block.kind)
+	}
+	assert.Equal(t, []int{mdHeading, mdParagraph, mdHeading, mdParagraph, mdCode, mdHeading, mdList, mdHeading, mdHeading, mdTable}, kinds)
+
+	// The blank line inside the code block and list does not split them
+	assert.Contains(t, markdownDoc[blocks[4].start:blocks[4].end], "echo done")
+	assert.Contains(t, markdownDoc[blocks[6].start:blocks[6].end], "Ask for help.")
+
+	assert.Equal(t, []string{"Install", "Linux", "Troubleshooting"}, blocks[6].path)
+	// The setext heading is nested under the ATX heading of the same content
+	assert.Equal(t, []string{"Usage", "Usage"}, blocks[8].path)
+}
+
+func TestMarkdownChunker_SectionPaths(t *testing.T) {
+	chunker := &MarkdownChunker{Size: 200, Overlap: 0}
+	chunks := chunker.Chunk(markdownDoc)
+
+	var paths []string
+	for i, chunk := range chunks {
+		assert.Equal(t, i, chunk.ChunkIndex)
+		assert.Equal(t, markdownDoc[chunk.StartPosition:chunk.EndPosition], chunk.Content)
+		paths = append(paths, chunk.SectionPath)
+	}
+
+	assert.Equal(t, []string{
+		"Install",
+		"Install > Linux",
+		"Install > Linux > Troubleshooting",
+		"Usage > Usage",
+	}, paths)
+
+	// Code blocks and lists are kept intact with their heading
+	assert.True(t, strings.HasPrefix(chunks[1].Content, "## Linux"))
+	assert.True(t, strings.HasSuffix(chunks[1].Content, "```"))
+	assert.True(t, strings.HasPrefix(chunks[2].Content, "### Troubleshooting"))
+	assert.True(t, strings.HasSuffix(chunks[2].Content, "- Ask for help."))
+}
+
+func TestMarkdownChunker_SplitsLargeSections(t *testing.T) {
+	content := "# Guide\n\n" + strings.Repeat("This sentence is part of a long section. ", 50)
+	chunker, err := NewChunker(ChunkStrategyMarkdown, 50, 5)
+	require.NoError(t, err)
+
+	chunks := chunker.Chunk(content)
+	require.Greater(t, len(chunks), 1)
+	for _, chunk := range chunks {
+		assert.Equal(t, "Guide", chunk.SectionPath)
+		assert.LessOrEqual(t, estimateTokens(chunk.Content), 50)
+		assert.Equal(t, content[chunk.StartPosition:chunk.EndPosition], chunk.Content)
+	}
+}
+
+func TestMarkdownChunker_PlainText(t *testing.T) {
+	content := "First paragraph. It has two sentences.\n\nSecond paragraph."
+	chunks := (&MarkdownChunker{Size: 100, Overlap: 10}).Chunk(content)
+
+	require.Len(t, chunks, 1)
+	assert.Equal(t, content, chunks[0].Content)
+	assert.Empty(t, chunks[0].SectionPath)
+}
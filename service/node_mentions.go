@@ -0,0 +1,183 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// nodeDocumentIDsSQL selects the documents mentioning the knowledge node kn
+const nodeDocumentIDsSQL = `ARRAY(SELECT DISTINCT m.document_id FROM node_mentions m WHERE m.node_id = kn.id ORDER BY m.document_id)`
+
+// documentIDs converts the document IDs selected by nodeDocumentIDsSQL
+func documentIDs(ids pq.Int64Array) []int {
+	if len(ids) == 0 {
+		return nil
+	}
+	result := make([]int, len(ids))
+	for i, id := range ids {
+		result[i] = int(id)
+	}
+	return result
+}
+
+// mentionPosition returns the byte offsets of the first occurrence of name in
+// content, ignoring case. ok is false when the name does not occur as is,
+// which happens when an extractor normalizes the name.
+func mentionPosition(content, name string) (start, end int, ok bool) {
+	if name == "" {
+		return 0, 0, false
+	}
+	start = strings.Index(content, name)
+	if start < 0 {
+		// Lowercasing keeps byte offsets for ASCII, so only fall back to it then
+		lowerContent, lowerName := strings.ToLower(content), strings.ToLower(name)
+		if len(lowerContent) != len(content) || len(lowerName) != len(name) {
+			return 0, 0, false
+		}
+		if start = strings.Index(lowerContent, lowerName); start < 0 {
+			return 0, 0, false
+		}
+	}
+	return start, start + len(name), true
+}
+
+// recordMention links a knowledge node to the document and chunk it was
+// extracted from, at the position of the name within the document if found
+func (s *RAGService) recordMention(ctx context.Context, nodeID, documentID int, text extractionText, name string) {
+	var chunkID, startPosition, endPosition interface{}
+	if text.chunkID != 0 {
+		chunkID = text.chunkID
+	}
+	if start, end, ok := mentionPosition(text.content, name); ok {
+		startPosition, endPosition = text.startPosition+start, text.startPosition+end
+	}
+
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO node_mentions (node_id, document_id, chunk_id, start_position, end_position)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT DO NOTHING
+	`, nodeID, documentID, chunkID, startPosition, endPosition)
+	if err != nil {
+		log.Printf("Failed to record mention of node %d in document %d: %v", nodeID, documentID, err)
+	}
+}
+
+// recordEdgeMention records that a document supports a knowledge edge
+func (s *RAGService) recordEdgeMention(ctx context.Context, edgeID, documentID int) {
+	_, err := s.db.ExecContext(ctx, `
+		INSERT INTO edge_mentions (edge_id, document_id)
+		VALUES ($1, $2)
+		ON CONFLICT DO NOTHING
+	`, edgeID, documentID)
+	if err != nil {
+		log.Printf("Failed to record mention of edge %d in document %d: %v", edgeID, documentID, err)
+	}
+}
+
+// deleteDocumentGraph removes the knowledge graph of the documents with the
+// given URL: the edges and nodes no other document mentions. Edges and nodes
+// that other documents still mention are kept and attributed to one of them.
+// It runs in the transaction deleting the documents.
+func deleteDocumentGraph(ctx context.Context, tx *sql.Tx, url string) error {
+	edgesResult, err := tx.ExecContext(ctx, `
+		WITH docs AS (SELECT id FROM documents WHERE url = $1)
+		DELETE FROM knowledge_edges e
+		WHERE (e.document_id IN (SELECT id FROM docs)
+				OR EXISTS (SELECT 1 FROM edge_mentions m WHERE m.edge_id = e.id AND m.document_id IN (SELECT id FROM docs)))
+			AND NOT EXISTS (
+				SELECT 1 FROM edge_mentions m
+				WHERE m.edge_id = e.id AND m.document_id NOT IN (SELECT id FROM docs)
+			)
+	`, url)
+	if err != nil {
+		log.Printf("Error deleting knowledge edges: %v", err)
+		return fmt.Errorf("failed to delete knowledge edges: %w", err)
+	}
+	edgesAffected, _ := edgesResult.RowsAffected()
+	log.Printf("Deleted %d knowledge edges for URL: %s", edgesAffected, url)
+
+	// The remaining edges of the documents are mentioned elsewhere
+	_, err = tx.ExecContext(ctx, `
+		UPDATE knowledge_edges e SET document_id = (
+			SELECT MIN(m.document_id) FROM edge_mentions m
+			WHERE m.edge_id = e.id AND m.document_id NOT IN (SELECT id FROM documents WHERE url = $1)
+		)
+		WHERE e.document_id IN (SELECT id FROM documents WHERE url = $1)
+	`, url)
+	if err != nil {
+		return fmt.Errorf("failed to reassign knowledge edges: %w", err)
+	}
+
+	// Nodes of the documents that no other document mentions
+	rows, err := tx.QueryContext(ctx, `
+		WITH docs AS (SELECT id FROM documents WHERE url = $1),
+		candidates AS (
+			SELECT node_id AS id FROM node_mentions WHERE document_id IN (SELECT id FROM docs)
+			UNION
+			SELECT id FROM knowledge_nodes WHERE document_id IN (SELECT id FROM docs)
+		)
+		SELECT c.id FROM candidates c
+		WHERE NOT EXISTS (
+			SELECT 1 FROM node_mentions m
+			WHERE m.node_id = c.id AND m.document_id NOT IN (SELECT id FROM docs)
+		)
+	`, url)
+	if err != nil {
+		return fmt.Errorf("failed to find orphaned knowledge nodes: %w", err)
+	}
+	var orphans []int64
+	for rows.Next() {
+		var id int64
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return fmt.Errorf("failed to scan knowledge node: %w", err)
+		}
+		orphans = append(orphans, id)
+	}
+	err = rows.Err()
+	rows.Close()
+	if err != nil {
+		return fmt.Errorf("error iterating knowledge node rows: %w", err)
+	}
+
+	if len(orphans) > 0 {
+		// Edges of other documents may still point at the orphaned nodes
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM knowledge_edges WHERE source_id = ANY($1) OR target_id = ANY($1)
+		`, pq.Array(orphans)); err != nil {
+			return fmt.Errorf("failed to delete knowledge edges: %w", err)
+		}
+		if _, err := tx.ExecContext(ctx, `
+			DELETE FROM entity_merge_proposals
+			WHERE status = $2 AND (source_id = ANY($1) OR target_id = ANY($1))
+		`, pq.Array(orphans), MergeStatusPending); err != nil {
+			return fmt.Errorf("failed to delete merge proposals: %w", err)
+		}
+		nodesResult, err := tx.ExecContext(ctx, `DELETE FROM knowledge_nodes WHERE id = ANY($1)`, pq.Array(orphans))
+		if err != nil {
+			log.Printf("Error deleting knowledge nodes: %v", err)
+			return fmt.Errorf("failed to delete knowledge nodes: %w", err)
+		}
+		nodesAffected, _ := nodesResult.RowsAffected()
+		log.Printf("Deleted %d knowledge nodes for URL: %s", nodesAffected, url)
+	}
+
+	// The remaining nodes of the documents are mentioned elsewhere
+	_, err = tx.ExecContext(ctx, `
+		UPDATE knowledge_nodes kn SET document_id = (
+			SELECT MIN(m.document_id) FROM node_mentions m
+			WHERE m.node_id = kn.id AND m.document_id NOT IN (SELECT id FROM documents WHERE url = $1)
+		)
+		WHERE kn.document_id IN (SELECT id FROM documents WHERE url = $1)
+	`, url)
+	if err != nil {
+		return fmt.Errorf("failed to reassign knowledge nodes: %w", err)
+	}
+
+	return nil
+}
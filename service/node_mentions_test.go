@@ -0,0 +1,37 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMentionPosition(t *testing.T) {
+	content := "Later, ADA Lovelace met Charles Babbage."
+
+	start, end, ok := mentionPosition(content, "Charles Babbage")
+	assert.True(t, ok)
+	assert.Equal(t, "Charles Babbage", content[start:end])
+
+	// Case is ignored when the name does not occur as is
+	start, end, ok = mentionPosition(content, "Ada Lovelace")
+	assert.True(t, ok)
+	assert.Equal(t, "ADA Lovelace", content[start:end])
+
+	_, _, ok = mentionPosition(content, "Alan Turing")
+	assert.False(t, ok)
+	_, _, ok = mentionPosition(content, "")
+	assert.False(t, ok)
+
+	// Byte offsets count multibyte characters before the mention
+	start, end, ok = mentionPosition("Café Zürich is near Zürich HB", "Zürich HB")
+	assert.True(t, ok)
+	assert.Equal(t, 22, start)
+	assert.Equal(t, 32, end)
+}
+
+func TestDocumentIDs(t *testing.T) {
+	assert.Nil(t, documentIDs(nil))
+	assert.Equal(t, []int{3, 5}, documentIDs(pq.Int64Array{3, 5}))
+}
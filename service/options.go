@@ -0,0 +1,102 @@
+package service
+
+import (
+	"log"
+
+	"rag-data-service/config"
+)
+
+// Option configures optional RAGService behaviour
+type Option func(*RAGService)
+
+// WithEmbedder sets the embedder used for documents, chunks, knowledge nodes and queries
+func WithEmbedder(embedder Embedder) Option {
+	return func(s *RAGService) {
+		s.embedder = embedder
+	}
+}
+
+// WithReranker sets the reranker applied to retrieved chunks and the number
+// of candidates passed to it
+func WithReranker(reranker Reranker, candidates int) Option {
+	return func(s *RAGService) {
+		s.reranker = reranker
+		if candidates > 0 {
+			s.rerankCandidates = candidates
+		}
+	}
+}
+
+// WithExtractor sets the extractor of knowledge graph entities and relations
+func WithExtractor(extractor Extractor) Option {
+	return func(s *RAGService) {
+		s.extractor = extractor
+	}
+}
+
+// WithConfig applies the optional sections of the application configuration
+func WithConfig(cfg *config.Config) Option {
+	return func(s *RAGService) {
+		embedder, err := NewEmbedder(cfg.Embedding, s.openaiClient)
+		if err != nil {
+			log.Printf("Warning: %v, falling back to hash embedder", err)
+			embedder = NewHashEmbedder(cfg.Embedding.Dimensions)
+		}
+		s.embedder = embedder
+		s.embeddingProvider = cfg.Embedding.Provider
+		if cfg.Embedding.BatchSize > 0 {
+			s.embeddingBatchSize = cfg.Embedding.BatchSize
+		}
+		if cfg.Embedding.MaxBatchTokens > 0 {
+			s.embeddingMaxBatchTokens = cfg.Embedding.MaxBatchTokens
+		}
+		s.embeddingCacheEnabled = cfg.Embedding.CacheEnabled
+
+		if _, err := NewChunker(cfg.Chunking.Strategy, cfg.Chunking.Size, cfg.Chunking.Overlap); err != nil {
+			log.Printf("Warning: invalid chunking configuration, keeping defaults: %v", err)
+		} else {
+			s.chunking = cfg.Chunking
+		}
+
+		if cfg.Query.Limit > 0 && cfg.Query.MaxLimit >= cfg.Query.Limit && cfg.Query.RRFK > 0 {
+			s.queryDefaults = cfg.Query
+		} else {
+			log.Printf("Warning: invalid query configuration, keeping defaults")
+		}
+
+		reranker, err := NewReranker(cfg.Rerank, s.openaiClient)
+		if err != nil {
+			log.Printf("Warning: %v, reranking disabled", err)
+		}
+		s.reranker = reranker
+		if cfg.Rerank.Candidates > 0 {
+			s.rerankCandidates = cfg.Rerank.Candidates
+		}
+
+		if cfg.Answer.Model != "" && cfg.Answer.MaxTokens > 0 && cfg.Answer.MaxContextTokens > 0 {
+			s.answer = cfg.Answer
+		} else {
+			log.Printf("Warning: invalid answer configuration, keeping defaults")
+		}
+
+		if cfg.Chat.HistoryTurns >= 0 {
+			s.chat = cfg.Chat
+		} else {
+			log.Printf("Warning: invalid chat configuration, keeping defaults")
+		}
+
+		extractor, err := NewExtractor(cfg.Extraction, s.openaiClient)
+		if err != nil {
+			log.Printf("Warning: %v, falling back to regex extractor", err)
+			extractor = NewRegexExtractor()
+		}
+		s.extractor = extractor
+		s.extractionMinConfidence = cfg.Extraction.MinConfidence
+
+		if cfg.Resolution.MaxDistance >= 0 {
+			s.resolution = cfg.Resolution
+		} else {
+			log.Printf("Warning: invalid entity resolution configuration, keeping defaults")
+		}
+	}
+}
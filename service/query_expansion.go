@@ -0,0 +1,233 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/pgvector/pgvector-go"
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Query expansion modes
+const (
+	QueryExpansionNone       = "none"
+	QueryExpansionMultiQuery = "multi_query"
+	QueryExpansionHyDE       = "hyde"
+)
+
+// maxParaphrases bounds the number of paraphrases a request may ask for
+const maxParaphrases = 10
+
+// hydeMaxTokens bounds the length of a hypothetical answer
+const hydeMaxTokens = 256
+
+// expandQuery expands the query with the chat model according to the
+// options. It returns nil when the query is not expanded, including when
+// expansion fails, in which case the query is searched as it is.
+func (s *RAGService) expandQuery(ctx context.Context, query string, opts queryOptions) *models.QueryExpansion {
+	var expansion *models.QueryExpansion
+	var err error
+	switch opts.expansion {
+	case QueryExpansionMultiQuery:
+		var paraphrases []string
+		paraphrases, err = s.generateParaphrases(ctx, query, opts.paraphrases)
+		expansion = &models.QueryExpansion{Mode: opts.expansion, Queries: paraphrases}
+	case QueryExpansionHyDE:
+		var answer string
+		answer, err = s.generateHypotheticalAnswer(ctx, query)
+		expansion = &models.QueryExpansion{Mode: opts.expansion, HypotheticalAnswer: answer}
+	default:
+		return nil
+	}
+
+	if err != nil {
+		log.Printf("Warning: %s query expansion failed, searching the query as is: %v", opts.expansion, err)
+		return nil
+	}
+	return expansion
+}
+
+// expansionModel returns the chat completion model of query expansion
+func (s *RAGService) expansionModel() string {
+	if s.queryDefaults.ExpansionModel != "" {
+		return s.queryDefaults.ExpansionModel
+	}
+	return s.answer.Model
+}
+
+// generateParaphrases asks the chat model for up to n rewordings of the query.
+// The temperature is zero so that paging through the results of a query sees
+// the same paraphrases.
+func (s *RAGService) generateParaphrases(ctx context.Context, query string, n int) ([]string, error) {
+	prompt := fmt.Sprintf(`Write %d different search queries that ask for the same information as the query below, using different words and phrasings, such as synonyms, expanded abbreviations or a question instead of keywords.
+Respond with only a JSON object of the form {"queries": ["...", "..."]}.
+
+Query: %s`, n, query)
+
+	resp, err := s.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: s.expansionModel(),
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "You rewrite search queries. You only reply with JSON."},
+			{Role: openai.ChatMessageRoleUser, Content: prompt},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("no choices returned")
+	}
+
+	return parseParaphrases(resp.Choices[0].Message.Content, query, n)
+}
+
+// parseParaphrases extracts the paraphrases from a chat reply, dropping
+// blanks, repeats and copies of the original query, and keeps at most n
+func parseParaphrases(reply, query string, n int) ([]string, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+
+	var parsed struct {
+		Queries []string `json:"queries"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, err
+	}
+
+	seen := map[string]bool{strings.ToLower(strings.TrimSpace(query)): true}
+	var paraphrases []string
+	for _, paraphrase := range parsed.Queries {
+		paraphrase = strings.TrimSpace(paraphrase)
+		key := strings.ToLower(paraphrase)
+		if paraphrase == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		paraphrases = append(paraphrases, paraphrase)
+		if len(paraphrases) == n {
+			break
+		}
+	}
+	if len(paraphrases) == 0 {
+		return nil, fmt.Errorf("no paraphrases in reply")
+	}
+
+	return paraphrases, nil
+}
+
+// generateHypotheticalAnswer asks the chat model to write a passage that
+// answers the query, as it might appear in a document
+func (s *RAGService) generateHypotheticalAnswer(ctx context.Context, query string) (string, error) {
+	resp, err := s.openaiClient.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: s.expansionModel(),
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "Write a short passage, as it might appear in documentation, that answers the question. Do not mention the question itself. Plausible details are fine."},
+			{Role: openai.ChatMessageRoleUser, Content: query},
+		},
+		MaxTokens:   hydeMaxTokens,
+		Temperature: 0,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to call chat completion: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return "", fmt.Errorf("no choices returned")
+	}
+
+	answer := strings.TrimSpace(resp.Choices[0].Message.Content)
+	if answer == "" {
+		return "", fmt.Errorf("empty hypothetical answer")
+	}
+	return answer, nil
+}
+
+// searchExpanded searches for the query as expanded. HyDE embeds the
+// hypothetical answer in place of the query while the full-text ranking keeps
+// the query's own terms. Multi-query searches the query and each paraphrase
+// and fuses the rankings. The embedding that stood for the query is returned
+// with the hits.
+func (s *RAGService) searchExpanded(ctx context.Context, query string, expansion *models.QueryExpansion, filters *models.QueryFilters, opts queryOptions, limit int, timer *stageTimer) ([]searchHit, pgvector.Vector, error) {
+	queries := []string{query}
+	embedded := []string{query}
+	if expansion != nil {
+		switch expansion.Mode {
+		case QueryExpansionMultiQuery:
+			queries = append(queries, expansion.Queries...)
+			embedded = queries
+		case QueryExpansionHyDE:
+			embedded = []string{expansion.HypotheticalAnswer}
+		}
+	}
+
+	// Embed all the search texts in one call
+	embeddings, err := s.currentEmbedder().Embed(ctx, embedded)
+	if err != nil {
+		return nil, pgvector.Vector{}, fmt.Errorf("failed to generate query embedding: %w", err)
+	}
+	if len(embeddings) != len(embedded) {
+		return nil, pgvector.Vector{}, fmt.Errorf("failed to generate query embedding: expected %d embeddings, got %d", len(embedded), len(embeddings))
+	}
+	queryEmbedding := pgvector.NewVector(embeddings[0])
+	timer.lap("embedding")
+
+	if len(queries) == 1 {
+		hits, err := s.searchChunks(ctx, query, queryEmbedding, filters, opts, limit)
+		timer.lap("retrieval")
+		return hits, queryEmbedding, err
+	}
+
+	rankings := make([][]searchHit, len(queries))
+	for i, q := range queries {
+		rankings[i], err = s.searchChunks(ctx, q, pgvector.NewVector(embeddings[i]), filters, opts, limit)
+		if err != nil {
+			return nil, pgvector.Vector{}, err
+		}
+	}
+	hits := fuseRankings(rankings, opts.rrfK, limit)
+	timer.lap("retrieval")
+	return hits, queryEmbedding, nil
+}
+
+// fuseRankings combines the rankings of several queries by reciprocal rank
+// fusion: a chunk scores 1 / (k + rank) for every ranking it appears in,
+// scaled to 0..1 by the score of a chunk ranked first by all of them. The best
+// limit chunks are returned, best first.
+func fuseRankings(rankings [][]searchHit, k, limit int) []searchHit {
+	var fused []searchHit
+	scores := make(map[int]float64)
+	for _, ranking := range rankings {
+		for rank, hit := range ranking {
+			id := hit.result.ChunkID
+			if _, ok := scores[id]; !ok {
+				fused = append(fused, hit)
+			}
+			scores[id] += 1 / float64(k+rank+1)
+		}
+	}
+
+	scale := float64(k+1) / float64(len(rankings))
+	for i := range fused {
+		fused[i].result.Score = scores[fused[i].result.ChunkID] * scale
+	}
+	sort.SliceStable(fused, func(i, j int) bool {
+		if fused[i].result.Score != fused[j].result.Score {
+			return fused[i].result.Score > fused[j].result.Score
+		}
+		return fused[i].result.ChunkID < fused[j].result.ChunkID
+	})
+
+	if len(fused) > limit {
+		fused = fused[:limit]
+	}
+	return fused
+}
@@ -0,0 +1,97 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rag-data-service/models"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseParaphrases(t *testing.T) {
+	paraphrases, err := parseParaphrases(`Sure: {"queries": ["install on linux", " Linux setup ", "", "linux setup", "set up on ubuntu"]}`, "Install on Linux", 5)
+	require.NoError(t, err)
+	// Blanks, repeats and the original query are dropped
+	assert.Equal(t, []string{"Linux setup", "set up on ubuntu"}, paraphrases)
+
+	paraphrases, err = parseParaphrases(`{"queries": ["a", "b", "c"]}`, "q", 2)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a", "b"}, paraphrases)
+
+	_, err = parseParaphrases("no json here", "q", 3)
+	assert.Error(t, err)
+	_, err = parseParaphrases(`{"queries": ["q"]}`, "q", 3)
+	assert.Error(t, err)
+}
+
+func TestFuseRankings(t *testing.T) {
+	hit := func(id int) searchHit {
+		return searchHit{result: models.SearchResult{ChunkID: id}}
+	}
+
+	fused := fuseRankings([][]searchHit{
+		{hit(1), hit(2), hit(3)},
+		{hit(3), hit(4)},
+		{hit(3), hit(2)},
+	}, 60, 3)
+
+	require.Len(t, fused, 3)
+	// Chunk 3 is found by every query, chunk 2 by two of them
+	assert.Equal(t, 3, fused[0].result.ChunkID)
+	assert.Equal(t, 2, fused[1].result.ChunkID)
+	assert.Equal(t, 1, fused[2].result.ChunkID)
+	assert.InDelta(t, (1.0/63+1.0/61+1.0/61)*61/3, fused[0].result.Score, 1e-9)
+}
+
+func TestExpandQuery(t *testing.T) {
+	var received openai.ChatCompletionRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		content := "Run the installer and follow the prompts."
+		if received.Messages[0].Content == "You rewrite search queries. You only reply with JSON." {
+			content = `{"queries": ["linux setup", "set up on ubuntu"]}`
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{"role": "assistant", "content": content}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+	ctx := context.Background()
+
+	assert.Nil(t, s.expandQuery(ctx, "install on linux", queryOptions{expansion: QueryExpansionNone}))
+
+	expansion := s.expandQuery(ctx, "install on linux", queryOptions{expansion: QueryExpansionMultiQuery, paraphrases: 2})
+	require.NotNil(t, expansion)
+	assert.Equal(t, QueryExpansionMultiQuery, expansion.Mode)
+	assert.Equal(t, []string{"linux setup", "set up on ubuntu"}, expansion.Queries)
+	assert.Contains(t, received.Messages[1].Content, "Write 2 different search queries")
+
+	expansion = s.expandQuery(ctx, "install on linux", queryOptions{expansion: QueryExpansionHyDE})
+	require.NotNil(t, expansion)
+	assert.Equal(t, QueryExpansionHyDE, expansion.Mode)
+	assert.Equal(t, "Run the installer and follow the prompts.", expansion.HypotheticalAnswer)
+	assert.Equal(t, "install on linux", received.Messages[1].Content)
+	assert.Equal(t, s.answer.Model, received.Model)
+}
+
+func TestExpandQuery_Failure(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	s := NewRAGService(nil, "test", server.URL, "")
+
+	// The query is searched as it is when expansion fails
+	assert.Nil(t, s.expandQuery(context.Background(), "install on linux", queryOptions{expansion: QueryExpansionHyDE}))
+}
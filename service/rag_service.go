@@ -9,6 +9,7 @@ import (
 	"regexp"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -16,6 +17,7 @@ import (
 	"rag-data-service/models"
 
 	"github.com/PuerkitoBio/goquery"
+	"github.com/lib/pq"
 	"github.com/pgvector/pgvector-go"
 	openai "github.com/sashabaranov/go-openai"
 )
@@ -25,6 +27,7 @@ type DB interface {
 	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
 	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
 	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+	BeginTx(ctx context.Context, opts *sql.TxOptions) (*sql.Tx, error)
 }
 
 // ChunkInfo represents chunk information with position data for internal processing
@@ -33,6 +36,10 @@ type ChunkInfo struct {
 	ChunkIndex    int    `json:"chunk_index"`
 	StartPosition int    `json:"start_position"`
 	EndPosition   int    `json:"end_position"`
+	// SectionPath is the heading breadcrumb of the chunk, e.g. "Install > Linux"
+	SectionPath string `json:"section_path,omitempty"`
+	// ParentID is the parent_chunks row the chunk belongs to, 0 if none
+	ParentID int `json:"parent_id,omitempty"`
 }
 
 // RAGService handles the RAG operations
@@ -42,56 +49,139 @@ type RAGService struct {
 	openAIBaseURL string
 	mcpEndpoint   string
 	openaiClient  *openai.Client
+
+	// mu guards embedder and migration, which change when an embedding
+	// migration starts, cuts over or is cancelled
+	mu        sync.RWMutex
+	embedder  Embedder
+	migration *embeddingMigration
+
+	// cutoverMu is held for reading by writers of embeddings and for writing
+	// by the cut-over of an embedding migration, see holdCutover
+	cutoverMu sync.RWMutex
+
+	embeddingProvider       string
+	embeddingBatchSize      int
+	embeddingMaxBatchTokens int
+
+	embeddingCacheEnabled bool
+	embeddingCacheHits    atomic.Int64
+	embeddingCacheMisses  atomic.Int64
+
+	chunking      config.ChunkingConfig
+	queryDefaults config.QueryConfig
+
+	reranker         Reranker
+	rerankCandidates int
+
+	answer config.AnswerConfig
+	chat   config.ChatConfig
+
+	extractor               Extractor
+	extractionMinConfidence float64
+
+	resolution config.ResolutionConfig
 }
 
-// NewRAGService creates a new RAG service instance
-func NewRAGService(db DB, openAIKey, openAIBaseURL, mcpEndpoint string) *RAGService {
-	config := openai.DefaultConfig(openAIKey)
+// NewRAGService creates a new RAG service instance.
+// Without options the service uses the offline hash embedder.
+func NewRAGService(db DB, openAIKey, openAIBaseURL, mcpEndpoint string, opts ...Option) *RAGService {
+	clientConfig := openai.DefaultConfig(openAIKey)
 	if openAIBaseURL != "" {
-		config.BaseURL = openAIBaseURL
+		clientConfig.BaseURL = openAIBaseURL
 	}
 
-	return &RAGService{
+	s := &RAGService{
 		db:            db,
 		openAIKey:     openAIKey,
 		openAIBaseURL: openAIBaseURL,
 		mcpEndpoint:   mcpEndpoint,
-		openaiClient:  openai.NewClientWithConfig(config),
-	}
+		openaiClient:  openai.NewClientWithConfig(clientConfig),
+		embedder:      NewHashEmbedder(1536),
+
+		embeddingProvider:       "hash",
+		embeddingBatchSize:      64,
+		embeddingMaxBatchTokens: 32000,
+		embeddingCacheEnabled:   true,
+
+		chunking: config.ChunkingConfig{
+			Strategy: ChunkStrategyMarkdown,
+			Size:     250,
+			Overlap:  25,
+
+			ParentSize: 1000,
+		},
+		queryDefaults: config.QueryConfig{
+			Limit:         5,
+			MaxLimit:      100,
+			MaxDistance:   0.5,
+			VectorWeight:  0.3,
+			KeywordWeight: 0.7,
+			RRFK:          60,
+			MMRLambda:     0.5,
+			Expansion:     QueryExpansionNone,
+			Paraphrases:   3,
+
+			GraphHops:         1,
+			GraphWeight:       0.5,
+			GraphNodeDistance: 0.3,
+		},
+		rerankCandidates: 20,
+		answer: config.AnswerConfig{
+			Model:            openai.GPT4oMini,
+			MaxTokens:        1024,
+			MaxContextTokens: 6000,
+		},
+		chat: config.ChatConfig{
+			HistoryTurns: 5,
+		},
+		extractor: NewRegexExtractor(),
+		resolution: config.ResolutionConfig{
+			MaxDistance:  0.1,
+			SameType:     true,
+			NameSuffixes: []string{"inc", "incorporated", "corp", "corporation", "co", "company", "ltd", "limited", "llc", "plc", "gmbh", "ag", "sa"},
+		},
+	}
+
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	return s
 }
 
 // ProcessDocument processes a document and stores it in the database
 func (s *RAGService) ProcessDocument(ctx context.Context, req *models.ProcessDocumentRequest) error {
+	// Resolve the chunking strategy before storing anything
+	chunker, err := s.chunkerFor(req.ChunkStrategy, req.ChunkSize, req.ChunkOverlap)
+	if err != nil {
+		return err
+	}
+
 	// Clean the content
 	cleanedContent := s.cleanContent(req.Content)
 	if cleanedContent == "" {
 		return fmt.Errorf("content is empty after cleaning")
 	}
 
-	// Generate embedding for the document
-	embedding, err := s.generateEmbedding(ctx, cleanedContent)
+	metadata, err := marshalMetadata(req.Metadata)
 	if err != nil {
-		return fmt.Errorf("failed to generate embedding: %w", err)
+		return err
 	}
 
-	// Store document in database
-	var documentID int
-	err = s.db.QueryRowContext(ctx, `
-		INSERT INTO documents (url, title, content, embedding)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (url) DO UPDATE SET
-		  title = EXCLUDED.title,
-		  content = EXCLUDED.content,
-		  embedding = EXCLUDED.embedding,
-		  updated_at = CURRENT_TIMESTAMP
-		RETURNING id
-	`, req.URL, req.Title, cleanedContent, embedding).Scan(&documentID)
+	// Store document in database; without new metadata the stored metadata is kept
+	documentID, storedMetadata, err := s.storeDocument(ctx, req.URL, req.Title, cleanedContent, metadata)
 	if err != nil {
-		return fmt.Errorf("failed to store document: %w", err)
+		return err
+	}
+
+	documentMetadata, err := unmarshalMetadata(storedMetadata)
+	if err != nil {
+		return err
 	}
 
 	// Process chunks
-	err = s.chunkDocument(ctx, documentID, cleanedContent)
+	err = s.chunkDocument(ctx, documentID, cleanedContent, chunker, documentMetadata)
 	if err != nil {
 		log.Printf("Warning: failed to chunk document: %v", err)
 	}
@@ -105,82 +195,6 @@ func (s *RAGService) ProcessDocument(ctx context.Context, req *models.ProcessDoc
 	return nil
 }
 
-// Query searches for relevant content based on the query
-func (s *RAGService) Query(ctx context.Context, query string) (*models.QueryResponse, error) {
-	// Generate embedding for the query
-	queryEmbedding, err := s.generateEmbedding(ctx, query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to generate query embedding: %w", err)
-	}
-
-	// Extract keywords from query for text matching
-	queryKeywords := extractKeywords(query)
-
-	// Search for relevant chunks with hybrid approach
-	rows, err := s.db.QueryContext(ctx, `
-		SELECT 
-			c.content, 
-			c.embedding <=> $1 as similarity, 
-			d.id as document_id, 
-			d.url, 
-			d.title,
-			-- Add keyword matching score
-			CASE 
-				WHEN $2 = '' THEN 0
-				ELSE (
-					SELECT COUNT(*) 
-					FROM unnest(string_to_array($2, ' ')) AS keyword 
-					WHERE LOWER(c.content) LIKE '%' || LOWER(keyword) || '%'
-				)::float / array_length(string_to_array($2, ' '), 1)
-			END as keyword_score
-		FROM chunks c
-		JOIN documents d ON c.document_id = d.id
-		WHERE c.embedding <=> $1 < 0.5
-		ORDER BY 
-			-- Prioritize keyword matches, then vector similarity
-			CASE 
-				WHEN $2 = '' THEN 0
-				ELSE (
-					SELECT COUNT(*) 
-					FROM unnest(string_to_array($2, ' ')) AS keyword 
-					WHERE LOWER(c.content) LIKE '%' || LOWER(keyword) || '%'
-				)::float / array_length(string_to_array($2, ' '), 1)
-			END DESC,
-			c.embedding <=> $1 ASC
-		LIMIT 5
-	`, queryEmbedding, strings.Join(queryKeywords, " "))
-	if err != nil {
-		return nil, fmt.Errorf("failed to query chunks: %w", err)
-	}
-	defer rows.Close()
-
-	var results []models.SearchResult
-	for rows.Next() {
-		var content string
-		var similarity float64
-		var documentID int
-		var url string
-		var title string
-		var keywordScore float64
-		if err := rows.Scan(&content, &similarity, &documentID, &url, &title, &keywordScore); err != nil {
-			return nil, fmt.Errorf("failed to scan chunk: %w", err)
-		}
-		// Combine vector similarity and keyword matching for final score
-		vectorScore := 1.0 - similarity
-		finalScore := (vectorScore * 0.3) + (keywordScore * 0.7) // Give more weight to keyword matching
-
-		results = append(results, models.SearchResult{
-			Content:    content,
-			Score:      finalScore,
-			DocumentID: documentID,
-			URL:        url,
-			Title:      title,
-		})
-	}
-
-	return &models.QueryResponse{Results: results}, nil
-}
-
 // extractKeywords extracts meaningful keywords from the query
 func extractKeywords(query string) []string {
 	// Convert to lowercase and split into words
@@ -198,16 +212,22 @@ func extractKeywords(query string) []string {
 	return keywords
 }
 
-// QueueURL adds a URL to the processing queue
-func (s *RAGService) QueueURL(ctx context.Context, url string) error {
+// QueueURL adds a URL to the processing queue. The metadata, which may be
+// nil, is stored on the document once the URL is processed.
+func (s *RAGService) QueueURL(ctx context.Context, url string, metadata map[string]any) error {
 	if url == "" {
 		return fmt.Errorf("URL cannot be empty")
 	}
 
-	_, err := s.db.ExecContext(ctx, `
-		INSERT INTO url_queue (url, status)
-		VALUES ($1, 'pending')
-	`, url)
+	data, err := marshalMetadata(metadata)
+	if err != nil {
+		return err
+	}
+
+	_, err = s.db.ExecContext(ctx, `
+		INSERT INTO url_queue (url, status, metadata)
+		VALUES ($1, 'pending', $2)
+	`, url, data)
 	if err != nil {
 		return fmt.Errorf("failed to queue URL: %w", err)
 	}
@@ -319,8 +339,15 @@ func (s *RAGService) ProcessURL(ctx context.Context, url string) error {
 	// Clean content
 	content = s.cleanContent(content)
 
-	// Generate embedding for the full document
-	embedding, err := s.generateEmbedding(ctx, content)
+	// Metadata given when the URL was queued
+	var metadata []byte
+	err = s.db.QueryRowContext(ctx, "SELECT metadata FROM url_queue WHERE url = $1", url).Scan(&metadata)
+	if err != nil && err != sql.ErrNoRows {
+		return fmt.Errorf("failed to get queued metadata: %w", err)
+	}
+
+	// Embed and store document in database
+	documentID, storedMetadata, err := s.storeDocument(ctx, url, title, content, metadata)
 	if err != nil {
 		// Update status to failed
 		_, updateErr := s.db.ExecContext(ctx,
@@ -329,35 +356,16 @@ func (s *RAGService) ProcessURL(ctx context.Context, url string) error {
 		if updateErr != nil {
 			log.Printf("Failed to update status to failed: %v", updateErr)
 		}
-		return fmt.Errorf("failed to generate embedding: %w", err)
+		return err
 	}
 
-	// Store document in database
-	var documentID int
-	err = s.db.QueryRowContext(ctx, `
-		INSERT INTO documents (url, title, content, embedding)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (url) DO UPDATE SET
-			title = EXCLUDED.title,
-			content = EXCLUDED.content,
-			embedding = EXCLUDED.embedding,
-			updated_at = CURRENT_TIMESTAMP
-		RETURNING id
-	`, url, title, content, embedding).Scan(&documentID)
-
+	documentMetadata, err := unmarshalMetadata(storedMetadata)
 	if err != nil {
-		// Update status to failed
-		_, updateErr := s.db.ExecContext(ctx,
-			"UPDATE url_queue SET status = 'failed', error = $1, updated_at = CURRENT_TIMESTAMP WHERE url = $2",
-			err.Error(), url)
-		if updateErr != nil {
-			log.Printf("Failed to update status to failed: %v", updateErr)
-		}
-		return fmt.Errorf("failed to store document: %w", err)
+		log.Printf("Failed to read document metadata: %v", err)
 	}
 
 	// Chunk the content and store chunks
-	err = s.chunkDocument(ctx, documentID, content)
+	err = s.chunkDocument(ctx, documentID, content, s.defaultChunker(), documentMetadata)
 	if err != nil {
 		log.Printf("Failed to chunk document: %v", err)
 		// Continue processing even if chunking fails
@@ -403,143 +411,316 @@ func (s *RAGService) cleanContent(content string) string {
 	return strings.TrimSpace(cleaned.String())
 }
 
+// generateEmbedding generates an embedding for a single text with the configured embedder
 func (s *RAGService) generateEmbedding(ctx context.Context, text string) (pgvector.Vector, error) {
-	// For testing, generate a more meaningful vector based on text content
-	// In production, this would use OpenAI's API to generate embeddings
-	dimensions := 1536
-	vector := make([]float32, dimensions)
+	embeddings, err := s.currentEmbedder().Embed(ctx, []string{text})
+	if err != nil {
+		return pgvector.Vector{}, err
+	}
+	if len(embeddings) != 1 {
+		return pgvector.Vector{}, fmt.Errorf("expected 1 embedding, got %d", len(embeddings))
+	}
 
-	// Normalize and clean text for better feature extraction
-	text = strings.ToLower(strings.TrimSpace(text))
-	words := strings.Fields(text)
+	return pgvector.NewVector(embeddings[0]), nil
+}
 
-	// Create a more sophisticated hash that considers word frequency and position
-	wordHash := make(map[string]int)
-	for i, word := range words {
-		// Give more weight to words at the beginning
-		weight := len(words) - i
-		wordHash[word] += weight
+// storeDocument embeds a document and upserts it by URL, returning its ID and
+// stored metadata. Without new metadata the stored metadata is kept.
+func (s *RAGService) storeDocument(ctx context.Context, url, title, content string, metadata interface{}) (int, []byte, error) {
+	release := s.holdCutover()
+	defer release()
+
+	embedding, err := s.generateCachedEmbedding(ctx, content)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to generate embedding: %w", err)
 	}
 
-	// Create a combined hash from word frequencies
-	combinedHash := 0
-	for word, freq := range wordHash {
-		for _, char := range word {
-			combinedHash = (combinedHash*31 + int(char)) % 1000000
+	embedder := s.currentEmbedder()
+	var documentID int
+	var storedMetadata []byte
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO documents (url, title, content, embedding, embedding_model, embedding_dimensions, metadata)
+		VALUES ($1, $2, $3, $4, $5, $6, COALESCE($7::jsonb, '{}'))
+		ON CONFLICT (url) DO UPDATE SET
+			title = EXCLUDED.title,
+			content = EXCLUDED.content,
+			embedding = EXCLUDED.embedding,
+			embedding_model = EXCLUDED.embedding_model,
+			embedding_dimensions = EXCLUDED.embedding_dimensions,
+			metadata = COALESCE($7::jsonb, documents.metadata),
+			updated_at = CURRENT_TIMESTAMP
+		RETURNING id, metadata
+	`, url, title, content, embedding, embedder.Model(), embedder.Dimensions(), metadata).Scan(&documentID, &storedMetadata)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to store document: %w", err)
+	}
+	s.stageEmbedding(ctx, "documents", documentID, content)
+
+	return documentID, storedMetadata, nil
+}
+
+// chunkDocument splits content with the given chunker and stores the chunks
+// with their embeddings. When parent sections are enabled, the content is
+// first split into parent sections and the chunks are cut within them, so
+// every chunk belongs to exactly one parent. Chunks of a previous version of
+// the document are replaced. Chunks inherit the metadata of the document.
+func (s *RAGService) chunkDocument(ctx context.Context, documentID int, content string, chunker Chunker, documentMetadata map[string]any) error {
+	if err := s.deleteDocumentChunks(ctx, documentID); err != nil {
+		return err
+	}
+
+	var chunks []ChunkInfo
+	if s.chunking.ParentSize > 0 {
+		parents, children := chunkHierarchy(content, chunker, s.chunking.ParentSize)
+		parentIDs, err := s.insertParentChunks(ctx, documentID, parents, documentMetadata)
+		if err != nil {
+			return err
 		}
-		combinedHash = (combinedHash * freq) % 1000000
+
+		for i, parentChunks := range children {
+			for _, chunk := range parentChunks {
+				chunk.ParentID = parentIDs[i]
+				chunks = append(chunks, chunk)
+			}
+		}
+	} else {
+		chunks = chunker.Chunk(content)
 	}
+	if len(chunks) == 0 {
+		return nil
+	}
+
+	// Generate chunk embeddings in batches, reusing cached embeddings
+	texts := make([]string, len(chunks))
+	for i, chunk := range chunks {
+		texts[i] = chunk.Content
+	}
+	release := s.holdCutover()
+	defer release()
+	embedder := s.currentEmbedder()
+	embeddings := s.embedTexts(ctx, embedder, texts)
 
-	// Use the combined hash to generate more distinctive vectors
-	seed := int64(combinedHash)
-	for i := range vector {
-		// More sophisticated pseudo-random generation
-		seed = (seed*1103515245 + 12345) & 0x7fffffff
-		// Add position-based variation to make vectors more unique
-		positionFactor := float32(i) / float32(dimensions)
-		vector[i] = float32(seed%1000)/1000.0 + positionFactor*0.1
+	// While an embedding migration is running, also embed with the new model
+	var nextEmbeddings [][]float32
+	if m := s.activeMigration(); m != nil {
+		nextEmbeddings = s.embedTexts(ctx, m.embedder, texts)
 	}
 
-	return pgvector.NewVector(vector), nil
+	// Store chunks in database with embeddings
+	return s.insertChunks(ctx, documentID, chunks, documentMetadata, embedder, embeddings, nextEmbeddings)
 }
 
-func (s *RAGService) chunkDocument(ctx context.Context, documentID int, content string) error {
-	// Simple chunking by sentences
-	sentences := strings.Split(content, ".")
-	chunks := make([]ChunkInfo, 0)
-	currentChunk := ""
-	currentStart := 0
-	chunkIndex := 0
-
-	for _, sentence := range sentences {
-		sentence = strings.TrimSpace(sentence)
-		if sentence == "" {
+// embedBatched generates embeddings for texts with the given embedder in
+// batches bounded by the configured batch size and token limit. If a batch
+// request fails, its texts are retried one at a time; texts that still fail
+// are left as nil.
+func (s *RAGService) embedBatched(ctx context.Context, embedder Embedder, texts []string) [][]float32 {
+	embeddings := make([][]float32, len(texts))
+
+	for _, batch := range batchTexts(texts, s.embeddingBatchSize, s.embeddingMaxBatchTokens) {
+		inputs := make([]string, len(batch))
+		for i, idx := range batch {
+			inputs[i] = texts[idx]
+		}
+
+		results, err := embedder.Embed(ctx, inputs)
+		if err == nil && len(results) == len(batch) {
+			for i, idx := range batch {
+				embeddings[idx] = results[i]
+			}
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("expected %d embeddings, got %d", len(batch), len(results))
+		}
+		if len(batch) == 1 {
+			log.Printf("Warning: failed to generate embedding for chunk %d: %v", batch[0], err)
 			continue
 		}
 
-		// Find the position of this sentence in the original content
-		sentenceStart := strings.Index(content[currentStart:], sentence)
-		if sentenceStart == -1 {
-			sentenceStart = 0
+		// Fall back to embedding each text on its own so one bad input does
+		// not cost the whole batch
+		log.Printf("Warning: batch embedding of %d chunks failed, retrying individually: %v", len(batch), err)
+		for _, idx := range batch {
+			result, err := embedder.Embed(ctx, []string{texts[idx]})
+			if err != nil || len(result) != 1 {
+				log.Printf("Warning: failed to generate embedding for chunk %d: %v", idx, err)
+				continue
+			}
+			embeddings[idx] = result[0]
 		}
-		sentenceStart += currentStart
+	}
 
-		if len(currentChunk)+len(sentence) < 1000 {
-			if currentChunk != "" {
-				currentChunk += ". "
+	return embeddings
+}
+
+// maxChunkInsertRows bounds the rows per INSERT to stay well under
+// PostgreSQL's limit of 65535 bind parameters
+const maxChunkInsertRows = 1000
+
+// insertChunks stores chunks with a multi-row insert. Chunks without an
+// embedding are stored with a NULL embedding. nextEmbeddings holds the
+// embeddings of a running embedding migration and may be nil.
+func (s *RAGService) insertChunks(ctx context.Context, documentID int, chunks []ChunkInfo, documentMetadata map[string]any, embedder Embedder, embeddings, nextEmbeddings [][]float32) error {
+	for start := 0; start < len(chunks); start += maxChunkInsertRows {
+		end := start + maxChunkInsertRows
+		if end > len(chunks) {
+			end = len(chunks)
+		}
+
+		var placeholders []string
+		var args []interface{}
+		for i := start; i < end; i++ {
+			chunk := chunks[i]
+			var embedding, model, dimensions, next interface{}
+			if embeddings[i] != nil {
+				embedding = pgvector.NewVector(embeddings[i])
+				model = embedder.Model()
+				dimensions = embedder.Dimensions()
+			}
+			if nextEmbeddings != nil && nextEmbeddings[i] != nil {
+				next = pgvector.NewVector(nextEmbeddings[i])
 			}
-			currentChunk += sentence
-		} else {
-			if currentChunk != "" {
-				// Find the end position of the current chunk
-				chunkEnd := strings.LastIndex(content[:sentenceStart], currentChunk)
-				if chunkEnd == -1 {
-					chunkEnd = sentenceStart
-				} else {
-					chunkEnd += len(currentChunk)
-				}
 
-				chunks = append(chunks, ChunkInfo{
-					Content:       currentChunk,
-					ChunkIndex:    chunkIndex,
-					StartPosition: currentStart,
-					EndPosition:   chunkEnd,
-				})
-				chunkIndex++
+			metadata, err := chunkMetadata(chunk, documentMetadata)
+			if err != nil {
+				return err
+			}
+
+			var parentID interface{}
+			if chunk.ParentID != 0 {
+				parentID = chunk.ParentID
 			}
-			currentChunk = sentence
-			currentStart = sentenceStart
+
+			n := len(args)
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d, $%d)",
+				n+1, n+2, n+3, n+4, n+5, n+6, n+7, n+8, n+9, n+10, n+11))
+			args = append(args, documentID, chunk.Content, embedding, model, dimensions, next,
+				chunk.ChunkIndex, chunk.StartPosition, chunk.EndPosition, metadata, parentID)
+		}
+
+		_, err := s.db.ExecContext(ctx, `
+			INSERT INTO chunks (document_id, content, embedding, embedding_model, embedding_dimensions, embedding_next,
+				chunk_index, start_position, end_position, metadata, parent_id)
+			VALUES `+strings.Join(placeholders, ", "), args...)
+		if err != nil {
+			return fmt.Errorf("failed to store chunks: %w", err)
 		}
 	}
 
-	if currentChunk != "" {
-		// Find the end position of the last chunk
-		chunkEnd := strings.LastIndex(content[currentStart:], currentChunk)
-		if chunkEnd == -1 {
-			chunkEnd = len(content)
-		} else {
-			chunkEnd += currentStart + len(currentChunk)
+	return nil
+}
+
+// insertParentChunks stores the parent sections of a document and returns their IDs in order
+func (s *RAGService) insertParentChunks(ctx context.Context, documentID int, parents []ChunkInfo, documentMetadata map[string]any) ([]int, error) {
+	ids := make([]int, len(parents))
+	for start := 0; start < len(parents); start += maxChunkInsertRows {
+		end := start + maxChunkInsertRows
+		if end > len(parents) {
+			end = len(parents)
 		}
 
-		chunks = append(chunks, ChunkInfo{
-			Content:       currentChunk,
-			ChunkIndex:    chunkIndex,
-			StartPosition: currentStart,
-			EndPosition:   chunkEnd,
-		})
-	}
+		var placeholders []string
+		var args []interface{}
+		for i := start; i < end; i++ {
+			parent := parents[i]
+			metadata, err := chunkMetadata(parent, documentMetadata)
+			if err != nil {
+				return nil, err
+			}
 
-	// Store chunks in database with embeddings
-	for _, chunk := range chunks {
-		// Generate embedding for the chunk
-		embedding, err := s.generateEmbedding(ctx, chunk.Content)
+			n := len(args)
+			placeholders = append(placeholders, fmt.Sprintf("($%d, $%d, $%d, $%d, $%d, $%d)", n+1, n+2, n+3, n+4, n+5, n+6))
+			args = append(args, documentID, parent.Content, parent.ChunkIndex, parent.StartPosition, parent.EndPosition, metadata)
+		}
+
+		rows, err := s.db.QueryContext(ctx, `
+			INSERT INTO parent_chunks (document_id, content, chunk_index, start_position, end_position, metadata)
+			VALUES `+strings.Join(placeholders, ", ")+`
+			RETURNING id, chunk_index
+		`, args...)
 		if err != nil {
-			log.Printf("Warning: failed to generate embedding for chunk %d: %v", chunk.ChunkIndex, err)
-			// Continue without embedding
-			_, err = s.db.ExecContext(ctx, `
-				INSERT INTO chunks (document_id, content, chunk_index, start_position, end_position)
-				VALUES ($1, $2, $3, $4, $5)
-			`, documentID, chunk.Content, chunk.ChunkIndex, chunk.StartPosition, chunk.EndPosition)
-		} else {
-			// Store chunk with embedding
-			_, err = s.db.ExecContext(ctx, `
-				INSERT INTO chunks (document_id, content, embedding, chunk_index, start_position, end_position)
-				VALUES ($1, $2, $3, $4, $5, $6)
-			`, documentID, chunk.Content, embedding, chunk.ChunkIndex, chunk.StartPosition, chunk.EndPosition)
+			return nil, fmt.Errorf("failed to store parent chunks: %w", err)
 		}
 
+		// RETURNING does not guarantee the order of the VALUES list
+		for rows.Next() {
+			var id, chunkIndex int
+			if err := rows.Scan(&id, &chunkIndex); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan parent chunk id: %w", err)
+			}
+			if chunkIndex >= 0 && chunkIndex < len(ids) {
+				ids[chunkIndex] = id
+			}
+		}
+		err = rows.Err()
+		rows.Close()
 		if err != nil {
-			log.Printf("Warning: failed to store chunk: %v", err)
+			return nil, fmt.Errorf("error iterating parent chunk ids: %w", err)
 		}
 	}
 
+	return ids, nil
+}
+
+// deleteDocumentChunks removes the chunks and parent sections of a document
+func (s *RAGService) deleteDocumentChunks(ctx context.Context, documentID int) error {
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM chunks WHERE document_id = $1`, documentID); err != nil {
+		return fmt.Errorf("failed to delete existing chunks: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM parent_chunks WHERE document_id = $1`, documentID); err != nil {
+		return fmt.Errorf("failed to delete existing parent chunks: %w", err)
+	}
 	return nil
 }
 
+// chunkMetadata returns the JSON metadata stored with a chunk: the metadata
+// of its document together with the section path of the chunk
+func chunkMetadata(chunk ChunkInfo, documentMetadata map[string]any) ([]byte, error) {
+	metadata := make(map[string]any, len(documentMetadata)+1)
+	for key, value := range documentMetadata {
+		metadata[key] = value
+	}
+	if chunk.SectionPath != "" {
+		metadata["section_path"] = chunk.SectionPath
+	}
+
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal chunk metadata: %w", err)
+	}
+	return data, nil
+}
+
+// marshalMetadata returns metadata as JSON, or nil if metadata is nil
+func marshalMetadata(metadata map[string]any) (interface{}, error) {
+	if metadata == nil {
+		return nil, nil
+	}
+	data, err := json.Marshal(metadata)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal metadata: %w", err)
+	}
+	return data, nil
+}
+
+// unmarshalMetadata parses stored JSON metadata, which may be empty
+func unmarshalMetadata(data []byte) (map[string]any, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	var metadata map[string]any
+	if err := json.Unmarshal(data, &metadata); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal metadata: %w", err)
+	}
+	return metadata, nil
+}
+
 // GetURLQueue retrieves all URLs from the queue
 func (s *RAGService) GetURLQueue(ctx context.Context) ([]models.URLQueueItem, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT q.id, q.url, q.status, q.created_at, q.updated_at, q.retry_count, d.id as document_id
+		SELECT q.id, q.url, q.status, q.created_at, q.updated_at, q.retry_count, d.id as document_id, q.metadata
 		FROM url_queue q
 		LEFT JOIN documents d ON q.url = d.url
 		WHERE q.status != 'deleted'
@@ -554,9 +735,13 @@ func (s *RAGService) GetURLQueue(ctx context.Context) ([]models.URLQueueItem, er
 	for rows.Next() {
 		var item models.URLQueueItem
 		var documentID sql.NullInt32
-		if err := rows.Scan(&item.ID, &item.URL, &item.Status, &item.CreatedAt, &item.UpdatedAt, &item.RetryCount, &documentID); err != nil {
+		var metadata []byte
+		if err := rows.Scan(&item.ID, &item.URL, &item.Status, &item.CreatedAt, &item.UpdatedAt, &item.RetryCount, &documentID, &metadata); err != nil {
 			return nil, fmt.Errorf("failed to scan url_queue row: %w", err)
 		}
+		if item.Metadata, err = unmarshalMetadata(metadata); err != nil {
+			return nil, err
+		}
 		if documentID.Valid {
 			item.DocumentID = int(documentID.Int32)
 		}
@@ -607,33 +792,31 @@ func (s *RAGService) DeleteURL(ctx context.Context, url string) error {
 		return fmt.Errorf("no rows were updated for URL: %s", url)
 	}
 
-	// Delete related knowledge graph edges first
-	edgesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_edges 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting knowledge edges: %v", err)
-		return fmt.Errorf("failed to delete knowledge edges: %w", err)
+	if err := s.deleteDocuments(ctx, url); err != nil {
+		return err
 	}
-	edgesAffected, _ := edgesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge edges for URL: %s", edgesAffected, url)
 
-	// Delete related knowledge graph nodes
-	nodesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_nodes 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
+	log.Printf("Successfully completed DeleteURL for: %s", url)
+	return nil
+}
+
+// deleteDocuments deletes the documents with the given URL with their chunks
+// and knowledge graph, keeping the nodes other documents mention, in one
+// transaction
+func (s *RAGService) deleteDocuments(ctx context.Context, url string) error {
+	tx, err := s.db.BeginTx(ctx, nil)
 	if err != nil {
-		log.Printf("Error deleting knowledge nodes: %v", err)
-		return fmt.Errorf("failed to delete knowledge nodes: %w", err)
+		return fmt.Errorf("failed to begin delete: %w", err)
+	}
+	defer tx.Rollback()
+
+	if err := deleteDocumentGraph(ctx, tx, url); err != nil {
+		return err
 	}
-	nodesAffected, _ := nodesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge nodes for URL: %s", nodesAffected, url)
 
 	// Delete related chunks
-	chunksResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM chunks 
+	chunksResult, err := tx.ExecContext(ctx, `
+		DELETE FROM chunks
 		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
 	`, url)
 	if err != nil {
@@ -641,18 +824,19 @@ func (s *RAGService) DeleteURL(ctx context.Context, url string) error {
 		return fmt.Errorf("failed to delete chunks: %w", err)
 	}
 	chunksAffected, _ := chunksResult.RowsAffected()
-	log.Printf("Deleted %d chunks for URL: %s", chunksAffected, url)
 
 	// Finally delete documents
-	docsResult, err := s.db.ExecContext(ctx, `DELETE FROM documents WHERE url = $1`, url)
+	docsResult, err := tx.ExecContext(ctx, `DELETE FROM documents WHERE url = $1`, url)
 	if err != nil {
 		log.Printf("Error deleting documents: %v", err)
 		return fmt.Errorf("failed to delete documents: %w", err)
 	}
 	docsAffected, _ := docsResult.RowsAffected()
-	log.Printf("Deleted %d documents for URL: %s", docsAffected, url)
 
-	log.Printf("Successfully completed DeleteURL for: %s", url)
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit delete: %w", err)
+	}
+	log.Printf("Deleted %d chunks and %d documents for URL: %s", chunksAffected, docsAffected, url)
 	return nil
 }
 
@@ -701,50 +885,9 @@ func (s *RAGService) DeleteURLByID(ctx context.Context, id string) error {
 		return fmt.Errorf("no rows were updated for ID: %s", id)
 	}
 
-	// Delete related knowledge graph edges first
-	edgesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_edges 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting knowledge edges: %v", err)
-		return fmt.Errorf("failed to delete knowledge edges: %w", err)
-	}
-	edgesAffected, _ := edgesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge edges for URL: %s", edgesAffected, url)
-
-	// Delete related knowledge graph nodes
-	nodesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_nodes 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting knowledge nodes: %v", err)
-		return fmt.Errorf("failed to delete knowledge nodes: %w", err)
-	}
-	nodesAffected, _ := nodesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge nodes for URL: %s", nodesAffected, url)
-
-	// Delete related chunks
-	chunksResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM chunks 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting chunks: %v", err)
-		return fmt.Errorf("failed to delete chunks: %w", err)
-	}
-	chunksAffected, _ := chunksResult.RowsAffected()
-	log.Printf("Deleted %d chunks for URL: %s", chunksAffected, url)
-
-	// Finally delete documents
-	docsResult, err := s.db.ExecContext(ctx, `DELETE FROM documents WHERE url = $1`, url)
-	if err != nil {
-		log.Printf("Error deleting documents: %v", err)
-		return fmt.Errorf("failed to delete documents: %w", err)
+	if err := s.deleteDocuments(ctx, url); err != nil {
+		return err
 	}
-	docsAffected, _ := docsResult.RowsAffected()
-	log.Printf("Deleted %d documents for URL: %s", docsAffected, url)
 
 	log.Printf("Successfully completed DeleteURLByID for ID: %s", id)
 	return nil
@@ -764,55 +907,10 @@ func (s *RAGService) ReindexURLByID(ctx context.Context, id string) error {
 
 	log.Printf("Found URL %s for ID %s", url, id)
 
-	// Delete related knowledge graph edges first
-	edgesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_edges 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting knowledge edges: %v", err)
-		return fmt.Errorf("failed to delete knowledge edges: %w", err)
-	}
-
-	edgesAffected, _ := edgesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge edges for URL: %s", edgesAffected, url)
-
-	// Delete related knowledge graph nodes
-	nodesResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM knowledge_nodes 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting knowledge nodes: %v", err)
-		return fmt.Errorf("failed to delete knowledge nodes: %w", err)
-	}
-
-	nodesAffected, _ := nodesResult.RowsAffected()
-	log.Printf("Deleted %d knowledge nodes for URL: %s", nodesAffected, url)
-
-	// Delete related chunks
-	chunksResult, err := s.db.ExecContext(ctx, `
-		DELETE FROM chunks 
-		WHERE document_id IN (SELECT id FROM documents WHERE url = $1)
-	`, url)
-	if err != nil {
-		log.Printf("Error deleting chunks: %v", err)
-		return fmt.Errorf("failed to delete chunks: %w", err)
+	if err := s.deleteDocuments(ctx, url); err != nil {
+		return err
 	}
 
-	chunksAffected, _ := chunksResult.RowsAffected()
-	log.Printf("Deleted %d chunks for URL: %s", chunksAffected, url)
-
-	// Finally delete documents
-	docsResult, err := s.db.ExecContext(ctx, `DELETE FROM documents WHERE url = $1`, url)
-	if err != nil {
-		log.Printf("Error deleting documents: %v", err)
-		return fmt.Errorf("failed to delete documents: %w", err)
-	}
-
-	docsAffected, _ := docsResult.RowsAffected()
-	log.Printf("Deleted %d documents for URL: %s", docsAffected, url)
-
 	// Reset the queue status to pending for background worker processing
 	result, err := s.db.ExecContext(ctx, `
 		UPDATE url_queue 
@@ -840,15 +938,23 @@ func (s *RAGService) ReindexURLByID(ctx context.Context, id string) error {
 // GetDocumentByID retrieves a document by ID
 func (s *RAGService) GetDocumentByID(ctx context.Context, id int) (*models.Document, error) {
 	var doc models.Document
+	var embeddingModel sql.NullString
+	var embeddingDimensions sql.NullInt32
+	var metadata []byte
 	err := s.db.QueryRowContext(ctx, `
-		SELECT id, url, title, content, created_at, updated_at
+		SELECT id, url, title, content, embedding_model, embedding_dimensions, metadata, created_at, updated_at
 		FROM documents 
 		WHERE id = $1
-	`, id).Scan(&doc.ID, &doc.URL, &doc.Title, &doc.Content, &doc.CreatedAt, &doc.UpdatedAt)
+	`, id).Scan(&doc.ID, &doc.URL, &doc.Title, &doc.Content, &embeddingModel, &embeddingDimensions, &metadata, &doc.CreatedAt, &doc.UpdatedAt)
 
 	if err != nil {
 		return nil, fmt.Errorf("failed to get document: %w", err)
 	}
+	if doc.Metadata, err = unmarshalMetadata(metadata); err != nil {
+		return nil, err
+	}
+	doc.EmbeddingModel = embeddingModel.String
+	doc.EmbeddingDimensions = int(embeddingDimensions.Int32)
 
 	return &doc, nil
 }
@@ -856,7 +962,7 @@ func (s *RAGService) GetDocumentByID(ctx context.Context, id int) (*models.Docum
 // GetDocumentChunks retrieves chunks for a specific document
 func (s *RAGService) GetDocumentChunks(ctx context.Context, documentID int) ([]models.Chunk, error) {
 	rows, err := s.db.QueryContext(ctx, `
-		SELECT id, content, chunk_index, start_position, end_position, created_at
+		SELECT id, content, chunk_index, start_position, end_position, embedding_model, embedding_dimensions, metadata, parent_id, created_at
 		FROM chunks 
 		WHERE document_id = $1
 		ORDER BY chunk_index
@@ -869,9 +975,27 @@ func (s *RAGService) GetDocumentChunks(ctx context.Context, documentID int) ([]m
 	var chunks []models.Chunk
 	for rows.Next() {
 		var chunk models.Chunk
-		if err := rows.Scan(&chunk.ID, &chunk.Content, &chunk.ChunkIndex, &chunk.StartPosition, &chunk.EndPosition, &chunk.CreatedAt); err != nil {
+		var embeddingModel sql.NullString
+		var embeddingDimensions sql.NullInt32
+		var metadata []byte
+		var parentID sql.NullInt64
+		if err := rows.Scan(&chunk.ID, &chunk.Content, &chunk.ChunkIndex, &chunk.StartPosition, &chunk.EndPosition,
+			&embeddingModel, &embeddingDimensions, &metadata, &parentID, &chunk.CreatedAt); err != nil {
 			return nil, fmt.Errorf("failed to scan chunk row: %w", err)
 		}
+		chunk.DocumentID = documentID
+		chunk.EmbeddingModel = embeddingModel.String
+		chunk.EmbeddingDimensions = int(embeddingDimensions.Int32)
+		if parentID.Valid {
+			id := int(parentID.Int64)
+			chunk.ParentID = &id
+		}
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &chunk.Metadata); err != nil {
+				return nil, fmt.Errorf("failed to unmarshal chunk metadata: %w", err)
+			}
+			chunk.SectionPath, _ = chunk.Metadata["section_path"].(string)
+		}
 		chunks = append(chunks, chunk)
 	}
 
@@ -882,7 +1006,8 @@ func (s *RAGService) GetDocumentChunks(ctx context.Context, documentID int) ([]m
 	return chunks, nil
 }
 
-// GetDocumentVectors retrieves vectors for a specific document
+// GetDocumentVectors retrieves vectors for a specific document. Chunks whose
+// embedding failed are returned without one.
 func (s *RAGService) GetDocumentVectors(ctx context.Context, documentID int) ([]models.VectorData, error) {
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT id, content, embedding, chunk_index, start_position, end_position
@@ -898,11 +1023,17 @@ func (s *RAGService) GetDocumentVectors(ctx context.Context, documentID int) ([]
 	var vectors []models.VectorData
 	for rows.Next() {
 		var vector models.VectorData
-		var embedding pgvector.Vector
+		var embedding sql.NullString
 		if err := rows.Scan(&vector.ID, &vector.Content, &embedding, &vector.ChunkIndex, &vector.StartPosition, &vector.EndPosition); err != nil {
 			return nil, fmt.Errorf("failed to scan vector row: %w", err)
 		}
-		vector.Embedding = embedding.Slice()
+		if embedding.Valid {
+			var parsed pgvector.Vector
+			if err := parsed.Parse(embedding.String); err != nil {
+				return nil, fmt.Errorf("failed to parse chunk embedding: %w", err)
+			}
+			vector.Embedding = parsed.Slice()
+		}
 		vectors = append(vectors, vector)
 	}
 
@@ -937,101 +1068,271 @@ func (s *RAGService) GetDocumentIDByURL(ctx context.Context, url string) (int, e
 	return id, nil
 }
 
-// ExtractEntitiesAndRelations extracts entities and relationships from document content
+// extractionText is a text of a document that entities are extracted from,
+// a chunk or, for a document without chunks, the whole content
+type extractionText struct {
+	chunkID       int // 0 for the whole content
+	chunkIndex    int
+	startPosition int // byte offset of the text within the document
+	content       string
+}
+
+// ExtractEntitiesAndRelations extracts entities and relationships from document
+// content, chunk by chunk, and stores them in the knowledge graph. Nodes and
+// edges record the extractor, its confidence and the chunk they came from.
 func (s *RAGService) ExtractEntitiesAndRelations(ctx context.Context, documentID int, content string) error {
-	log.Printf("Extracting entities and relations for document ID: %d", documentID)
+	log.Printf("Extracting entities and relations for document ID: %d with %s extractor", documentID, s.extractor.Name())
 
-	// Extract entities from content
-	entities := s.extractEntities(content)
+	texts, err := s.extractionTexts(ctx, documentID, content)
+	if err != nil {
+		return err
+	}
 
-	// Store entities in database
-	entityMap := make(map[string]int) // name -> id
-	for _, entity := range entities {
-		// Check if entity already exists
-		var existingID int
-		err := s.db.QueryRowContext(ctx, `
-			SELECT id FROM knowledge_nodes WHERE name = $1 AND type = $2
-		`, entity.Name, entity.Type).Scan(&existingID)
+	// Mentions are recorded afresh, so re-extraction does not keep stale ones
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM node_mentions WHERE document_id = $1`, documentID); err != nil {
+		return fmt.Errorf("failed to delete node mentions: %w", err)
+	}
+	if _, err := s.db.ExecContext(ctx, `DELETE FROM edge_mentions WHERE document_id = $1`, documentID); err != nil {
+		return fmt.Errorf("failed to delete edge mentions: %w", err)
+	}
 
-		if err == nil {
-			// Entity already exists, use existing ID
-			entityMap[entity.Name] = existingID
-			log.Printf("Entity already exists: %s (ID: %d, Type: %s)", entity.Name, existingID, entity.Type)
-			continue
-		} else if err != sql.ErrNoRows {
-			log.Printf("Error checking existing entity %s: %v", entity.Name, err)
+	// The entities of every text are stored before any relation, so that
+	// relations can link entities found in different chunks
+	entityMap := make(map[string]int) // name -> id
+	extractions := make([]*Extraction, len(texts))
+	for i, text := range texts {
+		extraction, err := s.extractor.Extract(ctx, text.content)
+		if err != nil {
+			log.Printf("Warning: failed to extract entities from chunk %d of document %d: %v", text.chunkIndex, documentID, err)
 			continue
 		}
+		extractions[i] = extraction
+		s.storeEntities(ctx, documentID, text, extraction.Entities, entityMap)
+	}
+	for i, text := range texts {
+		if extractions[i] != nil {
+			s.storeRelations(ctx, documentID, text, extractions[i].Relations, entityMap)
+		}
+	}
 
-		embedding, err := s.generateEmbedding(ctx, entity.Name)
-		if err != nil {
-			log.Printf("Failed to generate embedding for entity %s: %v", entity.Name, err)
+	log.Printf("Completed entity and relation extraction for document ID: %d", documentID)
+	return nil
+}
+
+// extractionTexts returns the chunks of a document in order, or the whole
+// content when the document has no chunks
+func (s *RAGService) extractionTexts(ctx context.Context, documentID int, content string) ([]extractionText, error) {
+	rows, err := s.db.QueryContext(ctx, `
+		SELECT id, COALESCE(chunk_index, 0), COALESCE(start_position, 0), content
+		FROM chunks WHERE document_id = $1 ORDER BY chunk_index
+	`, documentID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var texts []extractionText
+	for rows.Next() {
+		var text extractionText
+		if err := rows.Scan(&text.chunkID, &text.chunkIndex, &text.startPosition, &text.content); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		texts = append(texts, text)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to load chunks: %w", err)
+	}
+
+	if len(texts) == 0 {
+		texts = []extractionText{{content: content}}
+	}
+	return texts, nil
+}
+
+// provenance returns the properties of an extracted node or edge with the
+// extractor, its confidence and the source chunk added
+func (s *RAGService) provenance(properties map[string]any, confidence float64, text extractionText) map[string]any {
+	result := make(map[string]any, len(properties)+4)
+	for k, v := range properties {
+		result[k] = v
+	}
+	result["extractor"] = s.extractor.Name()
+	result["confidence"] = confidence
+	if text.chunkID != 0 {
+		result["chunk_id"] = text.chunkID
+		result["chunk_index"] = text.chunkIndex
+	}
+	return result
+}
+
+// storeEntities stores the entities extracted from a text of a document,
+// skipping those below the minimum confidence, and adds their IDs to entityMap.
+// Entities that already exist keep their node and gain the new provenance.
+func (s *RAGService) storeEntities(ctx context.Context, documentID int, text extractionText, entities []ExtractedEntity, entityMap map[string]int) {
+	for _, entity := range entities {
+		if entity.Confidence < s.extractionMinConfidence {
 			continue
 		}
 
 		// Convert properties map to JSON string
-		propertiesJSON, err := json.Marshal(entity.Properties)
+		propertiesJSON, err := json.Marshal(s.provenance(entity.Properties, entity.Confidence, text))
 		if err != nil {
 			log.Printf("Failed to marshal properties for entity %s: %v", entity.Name, err)
 			continue
 		}
 
-		var id int
+		// Check if entity already exists, under its name or as an alias of a merged node
+		var existingID int
 		err = s.db.QueryRowContext(ctx, `
-			INSERT INTO knowledge_nodes (name, type, properties, embedding, document_id)
-			VALUES ($1, $2, $3, $4, $5)
-			ON CONFLICT (name, type) DO UPDATE SET
-				properties = EXCLUDED.properties,
-				embedding = EXCLUDED.embedding,
-				document_id = EXCLUDED.document_id
-			RETURNING id
-		`, entity.Name, entity.Type, propertiesJSON, embedding, documentID).Scan(&id)
+			SELECT id FROM knowledge_nodes WHERE name = $1 AND type = $2
+			UNION ALL
+			SELECT node_id FROM node_aliases WHERE alias = $1 AND type = $2
+			LIMIT 1
+		`, entity.Name, entity.Type).Scan(&existingID)
 
+		if err == nil {
+			// Entity already exists, use existing ID and merge in the new provenance
+			_, err = s.db.ExecContext(ctx, `UPDATE knowledge_nodes SET properties = `+
+				mergedPropertiesSQL("properties", "$2::jsonb")+` WHERE id = $1`, existingID, propertiesJSON)
+			if err != nil {
+				log.Printf("Failed to update properties of entity %s: %v", entity.Name, err)
+			}
+			entityMap[entity.Name] = existingID
+			s.recordMention(ctx, existingID, documentID, text, entity.Name)
+			log.Printf("Entity already exists: %s (ID: %d, Type: %s)", entity.Name, existingID, entity.Type)
+			continue
+		} else if err != sql.ErrNoRows {
+			log.Printf("Error checking existing entity %s: %v", entity.Name, err)
+			continue
+		}
+
+		id, err := s.upsertKnowledgeNode(ctx, entity, propertiesJSON, documentID)
 		if err != nil {
 			log.Printf("Failed to insert entity %s: %v", entity.Name, err)
 			continue
 		}
+		s.recordMention(ctx, id, documentID, text, entity.Name)
 
 		entityMap[entity.Name] = id
 		log.Printf("Stored entity: %s (ID: %d, Type: %s)", entity.Name, id, entity.Type)
 	}
+}
 
-	// Extract relationships
-	relationships := s.extractRelationships(content, entityMap)
+// storeRelations stores the relations extracted from a text of a document,
+// skipping those below the minimum confidence. Their ends are resolved among
+// the entities of the whole document.
+func (s *RAGService) storeRelations(ctx context.Context, documentID int, text extractionText, relations []ExtractedRelation, entityMap map[string]int) {
+	for _, rel := range relations {
+		if rel.Confidence < s.extractionMinConfidence {
+			continue
+		}
+		sourceID, ok := s.documentNodeID(ctx, documentID, rel.Source, entityMap)
+		if !ok {
+			continue
+		}
+		targetID, ok := s.documentNodeID(ctx, documentID, rel.Target, entityMap)
+		if !ok || sourceID == targetID {
+			continue
+		}
 
-	// Store relationships in database
-	for _, rel := range relationships {
 		// Convert properties map to JSON string
-		propertiesJSON, err := json.Marshal(rel.Properties)
+		propertiesJSON, err := json.Marshal(s.provenance(rel.Properties, rel.Confidence, text))
 		if err != nil {
-			log.Printf("Failed to marshal properties for relationship %d -> %d: %v", rel.SourceID, rel.TargetID, err)
+			log.Printf("Failed to marshal properties for relationship %d -> %d: %v", sourceID, targetID, err)
 			continue
 		}
 
-		_, err = s.db.ExecContext(ctx, `
+		var edgeID int
+		err = s.db.QueryRowContext(ctx, `
 			INSERT INTO knowledge_edges (source_id, target_id, relationship_type, properties, document_id)
 			VALUES ($1, $2, $3, $4, $5)
 			ON CONFLICT (source_id, target_id, relationship_type) DO UPDATE SET
-				properties = EXCLUDED.properties,
-				document_id = EXCLUDED.document_id
-		`, rel.SourceID, rel.TargetID, rel.RelationshipType, propertiesJSON, documentID)
+				properties = `+mergedPropertiesSQL("knowledge_edges.properties", "EXCLUDED.properties")+`,
+				document_id = COALESCE(knowledge_edges.document_id, EXCLUDED.document_id)
+			RETURNING id
+		`, sourceID, targetID, rel.Type, propertiesJSON, documentID).Scan(&edgeID)
 
 		if err != nil {
 			log.Printf("Failed to insert relationship %d -> %d (%s): %v",
-				rel.SourceID, rel.TargetID, rel.RelationshipType, err)
+				sourceID, targetID, rel.Type, err)
 			continue
 		}
+		s.recordEdgeMention(ctx, edgeID, documentID)
 
 		log.Printf("Stored relationship: %d -> %d (%s)",
-			rel.SourceID, rel.TargetID, rel.RelationshipType)
+			sourceID, targetID, rel.Type)
+	}
+}
+
+// documentNodeID resolves an entity name to the ID of a node the document
+// mentions: first among the entities stored from its texts, then by node
+// name or alias. Resolved names are added to entityMap.
+func (s *RAGService) documentNodeID(ctx context.Context, documentID int, name string, entityMap map[string]int) (int, bool) {
+	if id, ok := entityMap[name]; ok {
+		return id, true
 	}
 
-	log.Printf("Completed entity and relation extraction for document ID: %d", documentID)
-	return nil
+	var id int
+	err := s.db.QueryRowContext(ctx, `
+		SELECT kn.id
+		FROM knowledge_nodes kn
+		WHERE (kn.name = $1 OR kn.id IN (SELECT node_id FROM node_aliases WHERE alias = $1))
+			AND EXISTS (SELECT 1 FROM node_mentions nm WHERE nm.node_id = kn.id AND nm.document_id = $2)
+		ORDER BY kn.id
+		LIMIT 1
+	`, name, documentID).Scan(&id)
+	if err != nil {
+		if err != sql.ErrNoRows {
+			log.Printf("Error resolving entity %s: %v", name, err)
+		}
+		return 0, false
+	}
+
+	entityMap[name] = id
+	return id, true
+}
+
+// mergedPropertiesSQL returns the SQL expression merging the properties of a
+// new extraction into the stored ones: new values win, except that the
+// highest confidence seen is kept
+func mergedPropertiesSQL(stored, extracted string) string {
+	return fmt.Sprintf(`%[1]s || %[2]s || jsonb_strip_nulls(jsonb_build_object('confidence',
+		GREATEST((%[1]s->>'confidence')::float8, (%[2]s->>'confidence')::float8)))`, stored, extracted)
+}
+
+// upsertKnowledgeNode embeds an extracted entity and stores it as a knowledge node, returning its ID
+func (s *RAGService) upsertKnowledgeNode(ctx context.Context, entity ExtractedEntity, propertiesJSON []byte, documentID int) (int, error) {
+	release := s.holdCutover()
+	defer release()
+
+	embedding, err := s.generateCachedEmbedding(ctx, entity.Name)
+	if err != nil {
+		return 0, fmt.Errorf("failed to generate embedding: %w", err)
+	}
+
+	embedder := s.currentEmbedder()
+	var id int
+	err = s.db.QueryRowContext(ctx, `
+		INSERT INTO knowledge_nodes (name, type, properties, embedding, embedding_model, embedding_dimensions, document_id)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		ON CONFLICT (name, type) DO UPDATE SET
+			properties = `+mergedPropertiesSQL("knowledge_nodes.properties", "EXCLUDED.properties")+`,
+			embedding = EXCLUDED.embedding,
+			embedding_model = EXCLUDED.embedding_model,
+			embedding_dimensions = EXCLUDED.embedding_dimensions,
+			document_id = COALESCE(knowledge_nodes.document_id, EXCLUDED.document_id)
+		RETURNING id
+	`, entity.Name, entity.Type, propertiesJSON, embedding, embedder.Model(), embedder.Dimensions(), documentID).Scan(&id)
+	if err != nil {
+		return 0, err
+	}
+	s.stageEmbedding(ctx, "knowledge_nodes", id, entity.Name)
+
+	return id, nil
 }
 
 // extractEntities extracts entities from text content
-func (s *RAGService) extractEntities(content string) []models.Entity {
+func extractEntities(content string) []models.Entity {
 	var entities []models.Entity
 	seenEntities := make(map[string]bool) // 避免重复实体
 
@@ -1198,9 +1499,9 @@ func (s *RAGService) extractEntities(content string) []models.Entity {
 	return entities
 }
 
-// extractRelationships extracts relationships between entities
-func (s *RAGService) extractRelationships(content string, entityMap map[string]int) []models.Relationship {
-	var relationships []models.Relationship
+// extractRelationships extracts relationships between the named entities
+func extractRelationships(content string, names map[string]bool) []ExtractedRelation {
+	var relationships []ExtractedRelation
 
 	// Simple relationship extraction based on proximity and patterns
 	// In production, this would use more sophisticated NLP techniques
@@ -1212,22 +1513,20 @@ func (s *RAGService) extractRelationships(content string, entityMap map[string]i
 		entity1 := match[1]
 		description := strings.TrimSpace(match[2])
 
-		if id1, exists := entityMap[entity1]; exists {
+		if names[entity1] {
 			// Create a concept entity for the description
 			conceptName := extractMainConcept(description)
-			if conceptName != "" {
-				// Add the concept to entityMap if not exists
-				if id2, exists := entityMap[conceptName]; exists {
-					relationships = append(relationships, models.Relationship{
-						SourceID:         id1,
-						TargetID:         id2,
-						RelationshipType: "is_a",
-						Properties: map[string]any{
-							"description": description,
-							"source":      "pattern_matching",
-						},
-					})
-				}
+			if conceptName != "" && names[conceptName] {
+				relationships = append(relationships, ExtractedRelation{
+					Source:     entity1,
+					Target:     conceptName,
+					Type:       "is_a",
+					Confidence: regexConfidence,
+					Properties: map[string]any{
+						"description": description,
+						"source":      "pattern_matching",
+					},
+				})
 			}
 		}
 	}
@@ -1239,17 +1538,16 @@ func (s *RAGService) extractRelationships(content string, entityMap map[string]i
 		person := match[1]
 		organization := strings.TrimSpace(match[2])
 
-		if id1, exists := entityMap[person]; exists {
-			if id2, exists := entityMap[organization]; exists {
-				relationships = append(relationships, models.Relationship{
-					SourceID:         id1,
-					TargetID:         id2,
-					RelationshipType: "works_at",
-					Properties: map[string]any{
-						"source": "pattern_matching",
-					},
-				})
-			}
+		if names[person] && names[organization] {
+			relationships = append(relationships, ExtractedRelation{
+				Source:     person,
+				Target:     organization,
+				Type:       "works_at",
+				Confidence: regexConfidence,
+				Properties: map[string]any{
+					"source": "pattern_matching",
+				},
+			})
 		}
 	}
 
@@ -1260,17 +1558,16 @@ func (s *RAGService) extractRelationships(content string, entityMap map[string]i
 		entity := match[1]
 		location := strings.TrimSpace(match[2])
 
-		if id1, exists := entityMap[entity]; exists {
-			if id2, exists := entityMap[location]; exists {
-				relationships = append(relationships, models.Relationship{
-					SourceID:         id1,
-					TargetID:         id2,
-					RelationshipType: "located_in",
-					Properties: map[string]any{
-						"source": "pattern_matching",
-					},
-				})
-			}
+		if names[entity] && names[location] {
+			relationships = append(relationships, ExtractedRelation{
+				Source:     entity,
+				Target:     location,
+				Type:       "located_in",
+				Confidence: regexConfidence,
+				Properties: map[string]any{
+					"source": "pattern_matching",
+				},
+			})
 		}
 	}
 
@@ -1311,7 +1608,7 @@ func (s *RAGService) GetKnowledgeGraph(ctx context.Context, query string) ([]mod
 	var args []interface{}
 	nodeQuery := `
 		SELECT 
-			kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title 
+			kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title, ` + nodeDocumentIDsSQL + `
 		FROM knowledge_nodes kn
 		LEFT JOIN documents d ON kn.document_id = d.id
 	`
@@ -1335,10 +1632,12 @@ func (s *RAGService) GetKnowledgeGraph(ctx context.Context, query string) ([]mod
 		var node models.KnowledgeNodeResponse
 		var propertiesJSON []byte
 		var docURL, docTitle sql.NullString
-		err := rows.Scan(&node.ID, &node.Name, &node.Type, &propertiesJSON, &node.DocumentID, &docURL, &docTitle)
+		var mentionedIn pq.Int64Array
+		err := rows.Scan(&node.ID, &node.Name, &node.Type, &propertiesJSON, &node.DocumentID, &docURL, &docTitle, &mentionedIn)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to scan knowledge node: %w", err)
 		}
+		node.DocumentIDs = documentIDs(mentionedIn)
 
 		if docURL.Valid {
 			node.URL = &docURL.String
@@ -1426,10 +1725,10 @@ func (s *RAGService) GetKnowledgeGraphByDocument(ctx context.Context, documentID
 	// Get nodes for the document
 	rows, err := s.db.QueryContext(ctx, `
 		SELECT 
-			kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title
+			kn.id, kn.name, kn.type, kn.properties, kn.document_id, d.url, d.title, `+nodeDocumentIDsSQL+`
 		FROM knowledge_nodes kn
 		LEFT JOIN documents d ON kn.document_id = d.id
-		WHERE kn.document_id = $1
+		WHERE EXISTS (SELECT 1 FROM node_mentions m WHERE m.node_id = kn.id AND m.document_id = $1)
 		ORDER BY kn.id
 	`, documentID)
 	if err != nil {
@@ -1442,10 +1741,12 @@ func (s *RAGService) GetKnowledgeGraphByDocument(ctx context.Context, documentID
 		var node models.KnowledgeNodeResponse
 		var propertiesJSON []byte
 		var docURL, docTitle sql.NullString
-		err := rows.Scan(&node.ID, &node.Name, &node.Type, &propertiesJSON, &node.DocumentID, &docURL, &docTitle)
+		var mentionedIn pq.Int64Array
+		err := rows.Scan(&node.ID, &node.Name, &node.Type, &propertiesJSON, &node.DocumentID, &docURL, &docTitle, &mentionedIn)
 		if err != nil {
 			return nil, nil, fmt.Errorf("failed to scan knowledge node: %w", err)
 		}
+		node.DocumentIDs = documentIDs(mentionedIn)
 
 		if docURL.Valid {
 			node.URL = &docURL.String
@@ -1465,11 +1766,15 @@ func (s *RAGService) GetKnowledgeGraphByDocument(ctx context.Context, documentID
 		return nil, nil, fmt.Errorf("error iterating over node rows: %w", err)
 	}
 
-	// Get edges for the document
+	// Get edges for the document, including those between its nodes that
+	// another document extracted
 	edgeRows, err := s.db.QueryContext(ctx, `
 		SELECT id, source_id, target_id, relationship_type, properties, document_id
-		FROM knowledge_edges
+		FROM knowledge_edges e
 		WHERE document_id = $1
+		   OR EXISTS (SELECT 1 FROM edge_mentions m WHERE m.edge_id = e.id AND m.document_id = $1)
+		   OR (EXISTS (SELECT 1 FROM node_mentions m WHERE m.node_id = e.source_id AND m.document_id = $1)
+		       AND EXISTS (SELECT 1 FROM node_mentions m WHERE m.node_id = e.target_id AND m.document_id = $1))
 		ORDER BY id
 	`, documentID)
 	if err != nil {
@@ -1528,8 +1833,8 @@ func (s *RAGService) fetchContent(url string) (string, string, error) {
 	doc.Find("body").Each(func(i int, s *goquery.Selection) {
 		// Remove script and style elements
 		s.Find("script, style").Remove()
-		// Get text content
-		content = s.Text()
+		// Keep the page structure as markdown for the markdown chunker
+		content = htmlToMarkdown(s)
 	})
 
 	// Clean up content
@@ -1,10 +1,12 @@
 package service
 
 import (
+	"bytes"
 	"context"
 	"database/sql"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	"time"
@@ -37,10 +39,19 @@ func setupTestDB(t *testing.T) *sql.DB {
 
 	// Clean up test database
 	_, err = db.Exec(`
+		DROP TABLE IF EXISTS chat_turns;
+		DROP TABLE IF EXISTS chat_sessions;
+		DROP TABLE IF EXISTS embedding_migrations;
+		DROP TABLE IF EXISTS embedding_cache;
 		DROP TABLE IF EXISTS url_queue;
+		DROP TABLE IF EXISTS entity_merge_proposals;
+		DROP TABLE IF EXISTS node_aliases;
+		DROP TABLE IF EXISTS node_mentions;
+		DROP TABLE IF EXISTS edge_mentions;
 		DROP TABLE IF EXISTS knowledge_edges;
 		DROP TABLE IF EXISTS knowledge_nodes;
 		DROP TABLE IF EXISTS chunks;
+		DROP TABLE IF EXISTS parent_chunks;
 		DROP TABLE IF EXISTS documents;
 	`)
 	require.NoError(t, err)
@@ -86,6 +97,131 @@ func TestRAGService_ProcessDocument(t *testing.T) {
 	assert.Greater(t, chunkCount, 0)
 }
 
+func TestRAGService_DocumentMetadata(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	req := &models.ProcessDocumentRequest{
+		URL:      "https://example.com/metadata",
+		Title:    "Metadata Document",
+		Content:  "# Install\n\nRun the installer on Linux. The installer sets up the service.",
+		Metadata: map[string]any{"team": "docs", "version": "2"},
+	}
+	require.NoError(t, service.ProcessDocument(ctx, req))
+
+	var docID int
+	require.NoError(t, db.QueryRow("SELECT id FROM documents WHERE url = $1", req.URL).Scan(&docID))
+
+	doc, err := service.GetDocumentByID(ctx, docID)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]any{"team": "docs", "version": "2"}, doc.Metadata)
+
+	// Chunks inherit the document metadata
+	chunks, err := service.GetDocumentChunks(ctx, docID)
+	require.NoError(t, err)
+	require.NotEmpty(t, chunks)
+	assert.Equal(t, "docs", chunks[0].Metadata["team"])
+	assert.Equal(t, "Install", chunks[0].Metadata["section_path"])
+
+	// Re-ingesting without metadata keeps the stored metadata
+	req.Metadata = nil
+	require.NoError(t, service.ProcessDocument(ctx, req))
+	doc, err = service.GetDocumentByID(ctx, docID)
+	require.NoError(t, err)
+	assert.Equal(t, "docs", doc.Metadata["team"])
+
+	// Metadata can be used as a query filter
+	resp, err := service.QueryWithOptions(ctx, &models.QueryRequest{
+		Query:   "installer",
+		Filters: &models.QueryFilters{Metadata: map[string]any{"team": "other"}},
+	})
+	require.NoError(t, err)
+	assert.Empty(t, resp.Results)
+}
+
+func TestRAGService_GetDocumentVectors(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+	ctx := context.Background()
+
+	testVector := pgvector.NewVector(make([]float32, 1536))
+	_, err := db.Exec(`INSERT INTO documents (url, title, content, embedding) VALUES ('https://example.com/v', 'V', 'one two', $1)`, testVector)
+	require.NoError(t, err)
+	// The second chunk failed to embed
+	_, err = db.Exec(`
+		INSERT INTO chunks (document_id, content, embedding, chunk_index, start_position, end_position)
+		VALUES (1, 'one', $1, 0, 0, 3), (1, 'two', NULL, 1, 4, 7)
+	`, testVector)
+	require.NoError(t, err)
+
+	vectors, err := service.GetDocumentVectors(ctx, 1)
+	require.NoError(t, err)
+	require.Len(t, vectors, 2)
+	assert.Len(t, vectors[0].Embedding, 1536)
+	assert.Nil(t, vectors[1].Embedding)
+}
+
+func TestRAGService_CharacterSpans(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	// "é" takes two bytes, so "Café au lait." spans bytes 7 to 21 but characters 6 to 19
+	content := "Café. Café au lait."
+	_, err := db.Exec(`INSERT INTO documents (url, title, content) VALUES ('https://example.com/cafe', 'Café', $1)`, content)
+	require.NoError(t, err)
+
+	sources := selectAnswerSources([]models.SearchResult{
+		{DocumentID: 1, Content: content[7:21], StartPosition: 7, EndPosition: 21},
+	}, 100)
+	require.NoError(t, service.characterSpans(context.Background(), sources))
+	citations := citationsFor("Milk [1].", sources)
+	require.Len(t, citations, 1)
+	assert.Equal(t, 6, citations[0].StartPosition)
+	assert.Equal(t, 19, citations[0].EndPosition)
+}
+
+func TestRAGService_ChatSessions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	session, err := service.CreateChatSession(ctx, "Install questions")
+	require.NoError(t, err)
+	assert.Equal(t, "Install questions", session.Title)
+
+	_, err = db.Exec(`
+		INSERT INTO chat_turns (session_id, question, query, answer, citations)
+		VALUES ($1, 'How do I install it?', 'How do I install it?', 'Run the installer [1].', '[{"number": 1, "document_id": 3}]')
+	`, session.ID)
+	require.NoError(t, err)
+
+	got, err := service.GetChatSession(ctx, session.ID)
+	require.NoError(t, err)
+	require.Len(t, got.Turns, 1)
+	assert.Equal(t, "Run the installer [1].", got.Turns[0].Answer)
+	require.Len(t, got.Turns[0].Citations, 1)
+	assert.Equal(t, 3, got.Turns[0].Citations[0].DocumentID)
+
+	// Deleting a session removes its turns
+	require.NoError(t, service.DeleteChatSession(ctx, session.ID))
+	_, err = service.GetChatSession(ctx, session.ID)
+	assert.ErrorIs(t, err, ErrChatSessionNotFound)
+	assert.ErrorIs(t, service.DeleteChatSession(ctx, session.ID), ErrChatSessionNotFound)
+}
+
 func TestRAGService_Query(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -162,6 +298,429 @@ func TestRAGService_GetKnowledgeGraph(t *testing.T) {
 	assert.Len(t, edges, 1, "Expected to find 1 edge")
 }
 
+func TestRAGService_SharedEntityDeletion(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	urls := []string{"https://example.com/engine", "https://example.com/notes"}
+	for _, url := range urls {
+		err := service.ProcessDocument(ctx, &models.ProcessDocumentRequest{
+			URL:     url,
+			Title:   "Ada Lovelace",
+			Content: "Ada Lovelace wrote about the Analytical Engine.",
+		})
+		require.NoError(t, err)
+		_, err = db.Exec(`INSERT INTO url_queue (url, status) VALUES ($1, 'completed')`, url)
+		require.NoError(t, err)
+	}
+
+	var nodeID, mentions int
+	err := db.QueryRow(`SELECT id FROM knowledge_nodes WHERE name = 'Ada Lovelace'`).Scan(&nodeID)
+	require.NoError(t, err)
+	err = db.QueryRow(`SELECT COUNT(DISTINCT document_id) FROM node_mentions WHERE node_id = $1`, nodeID).Scan(&mentions)
+	require.NoError(t, err)
+	assert.Equal(t, 2, mentions)
+
+	// An edge both documents support, attributed to the first
+	var edgeID int
+	err = db.QueryRow(`
+		INSERT INTO knowledge_edges (source_id, target_id, relationship_type, properties, document_id)
+		SELECT $1, $1, 'knows', '{}'::jsonb, MIN(id) FROM documents
+		RETURNING id
+	`, nodeID).Scan(&edgeID)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO edge_mentions (edge_id, document_id) SELECT $1, id FROM documents`, edgeID)
+	require.NoError(t, err)
+
+	// The node and edge outlive the first document since the second still mentions them
+	require.NoError(t, service.DeleteURL(ctx, urls[0]))
+	var documentURL string
+	err = db.QueryRow(`
+		SELECT d.url FROM knowledge_nodes kn JOIN documents d ON d.id = kn.document_id WHERE kn.id = $1
+	`, nodeID).Scan(&documentURL)
+	require.NoError(t, err)
+	assert.Equal(t, urls[1], documentURL)
+	err = db.QueryRow(`
+		SELECT d.url FROM knowledge_edges e JOIN documents d ON d.id = e.document_id WHERE e.id = $1
+	`, edgeID).Scan(&documentURL)
+	require.NoError(t, err)
+	assert.Equal(t, urls[1], documentURL)
+
+	// Their last mention gone, the node and edge are deleted
+	require.NoError(t, service.DeleteURL(ctx, urls[1]))
+	var count int
+	err = db.QueryRow(`SELECT COUNT(*) FROM knowledge_nodes WHERE id = $1`, nodeID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+	err = db.QueryRow(`SELECT COUNT(*) FROM knowledge_edges WHERE id = $1`, edgeID).Scan(&count)
+	require.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestRAGService_WholeDocumentMentions(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+	ctx := context.Background()
+
+	testVector := pgvector.NewVector(make([]float32, 1536))
+	_, err := db.Exec(`INSERT INTO documents (url, title, content, embedding) VALUES ('https://example.com/ada', 'Ada', 'Ada', $1)`, testVector)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO knowledge_nodes (name, type, properties, embedding) VALUES ('Ada', 'person', '{}'::jsonb, $1)`, testVector)
+	require.NoError(t, err)
+
+	// A mention outside any chunk is recorded once however often it is extracted
+	text := extractionText{content: "Ada"}
+	service.recordMention(ctx, 1, 1, text, "Ada")
+	service.recordMention(ctx, 1, 1, text, "Ada")
+
+	var mentions int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM node_mentions WHERE node_id = 1 AND document_id = 1`).Scan(&mentions))
+	assert.Equal(t, 1, mentions)
+}
+
+// textExtractor returns the extraction of the first key the text contains
+type textExtractor map[string]*Extraction
+
+func (e textExtractor) Extract(ctx context.Context, text string) (*Extraction, error) {
+	for key, extraction := range e {
+		if strings.Contains(text, key) {
+			return extraction, nil
+		}
+	}
+	return &Extraction{}, nil
+}
+
+func (e textExtractor) Name() string {
+	return "test"
+}
+
+func TestRAGService_ExtractionAcrossChunks(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint, WithExtractor(textExtractor{
+		"Jane Smith writes": {Entities: []ExtractedEntity{{Name: "Jane Smith", Type: "person", Confidence: 0.9}}},
+		"joined Acme": {
+			Entities:  []ExtractedEntity{{Name: "Acme", Type: "organization", Confidence: 0.6}},
+			Relations: []ExtractedRelation{{Source: "Jane Smith", Target: "Acme", Type: "works_at", Confidence: 0.7}},
+		},
+		"Acme ships": {Entities: []ExtractedEntity{{Name: "Acme", Type: "organization", Confidence: 0.8,
+			Properties: map[string]any{"industry": "software"}}}},
+	}))
+	ctx := context.Background()
+
+	overlap := 0
+	require.NoError(t, service.ProcessDocument(ctx, &models.ProcessDocumentRequest{
+		URL:           "https://example.com/jane",
+		Title:         "Jane",
+		Content:       "Jane Smith writes compilers for a living. Years later she joined Acme as an engineer.",
+		ChunkStrategy: ChunkStrategySentence,
+		ChunkSize:     12,
+		ChunkOverlap:  &overlap,
+	}))
+
+	var chunks int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM chunks`).Scan(&chunks))
+	require.Equal(t, 2, chunks)
+
+	// The relation links entities extracted from different chunks
+	var edges int
+	require.NoError(t, db.QueryRow(`
+		SELECT COUNT(*) FROM knowledge_edges e
+		JOIN knowledge_nodes s ON s.id = e.source_id
+		JOIN knowledge_nodes t ON t.id = e.target_id
+		WHERE s.name = 'Jane Smith' AND t.name = 'Acme' AND e.relationship_type = 'works_at'
+	`).Scan(&edges))
+	assert.Equal(t, 1, edges)
+
+	// Extracting an existing entity merges in its new properties and keeps the highest confidence
+	require.NoError(t, service.ProcessDocument(ctx, &models.ProcessDocumentRequest{
+		URL:     "https://example.com/acme",
+		Title:   "Acme",
+		Content: "Acme ships software.",
+	}))
+	var industry string
+	var confidence float64
+	require.NoError(t, db.QueryRow(`
+		SELECT properties->>'industry', (properties->>'confidence')::float8 FROM knowledge_nodes WHERE name = 'Acme'
+	`).Scan(&industry, &confidence))
+	assert.Equal(t, "software", industry)
+	assert.Equal(t, 0.8, confidence)
+}
+
+func TestRAGService_EntityResolution(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	testVector := pgvector.NewVector(make([]float32, 1536))
+	_, err := db.Exec(`
+		INSERT INTO knowledge_nodes (name, type, properties, embedding)
+		VALUES
+			('OpenAI', 'organization', '{}'::jsonb, $1),
+			('OpenAI Inc', 'organization', '{}'::jsonb, $1),
+			('GPT-4', 'product', '{}'::jsonb, $1)
+	`, testVector)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO knowledge_edges (source_id, target_id, relationship_type, properties)
+		VALUES (3, 1, 'created_by', '{}'::jsonb), (3, 2, 'created_by', '{}'::jsonb), (2, 3, 'related_to', '{}'::jsonb)
+	`)
+	require.NoError(t, err)
+
+	result, err := service.ResolveEntities(ctx)
+	require.NoError(t, err)
+	require.Len(t, result.Proposals, 1)
+	assert.Equal(t, 2, result.Proposals[0].SourceID)
+	assert.Equal(t, 1, result.Proposals[0].TargetID)
+
+	// A pair is only proposed once
+	again, err := service.ResolveEntities(ctx)
+	require.NoError(t, err)
+	assert.Empty(t, again.Proposals)
+
+	node, err := service.AcceptMergeProposal(ctx, result.Proposals[0].ID)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"OpenAI Inc"}, node.Aliases)
+
+	// The duplicate edge is dropped and the other one re-pointed
+	var edges int
+	err = db.QueryRow(`SELECT COUNT(*) FROM knowledge_edges WHERE source_id = 2 OR target_id = 2`).Scan(&edges)
+	require.NoError(t, err)
+	assert.Equal(t, 0, edges)
+	err = db.QueryRow(`SELECT COUNT(*) FROM knowledge_edges WHERE source_id = 1 OR target_id = 1`).Scan(&edges)
+	require.NoError(t, err)
+	assert.Equal(t, 2, edges)
+
+	accepted, err := service.ListMergeProposals(ctx, MergeStatusAccepted)
+	require.NoError(t, err)
+	assert.Len(t, accepted, 1)
+	assert.ErrorIs(t, service.RejectMergeProposal(ctx, result.Proposals[0].ID), ErrInvalidResolution)
+
+	// Splitting the alias off makes it a node of its own again
+	split, err := service.SplitNode(ctx, 1, &models.SplitNodeRequest{Name: "OpenAI Inc"})
+	require.NoError(t, err)
+	assert.Equal(t, "organization", split.Type)
+	node, err = service.GetKnowledgeNode(ctx, 1)
+	require.NoError(t, err)
+	assert.Empty(t, node.Aliases)
+
+	// Splitting by document takes the edges only those documents support
+	_, err = db.Exec(`
+		INSERT INTO documents (url, title, content, embedding)
+		VALUES ('https://example.com/a', 'A', 'A', $1), ('https://example.com/b', 'B', 'B', $1)
+	`, testVector)
+	require.NoError(t, err)
+	_, err = db.Exec(`INSERT INTO edge_mentions (edge_id, document_id) VALUES (1, 1), (3, 1), (3, 2)`)
+	require.NoError(t, err)
+	split, err = service.SplitNode(ctx, 1, &models.SplitNodeRequest{Name: "OpenAI LP", DocumentIDs: []int{1}})
+	require.NoError(t, err)
+	var endpoint int
+	require.NoError(t, db.QueryRow(`SELECT target_id FROM knowledge_edges WHERE id = 1`).Scan(&endpoint))
+	assert.Equal(t, split.ID, endpoint)
+	require.NoError(t, db.QueryRow(`SELECT source_id FROM knowledge_edges WHERE id = 3`).Scan(&endpoint))
+	assert.Equal(t, 1, endpoint)
+
+	// A failed split leaves nothing behind
+	_, err = service.SplitNode(ctx, 1, &models.SplitNodeRequest{Name: "OpenAI LP", DocumentIDs: []int{2}})
+	assert.ErrorIs(t, err, ErrInvalidResolution)
+	require.NoError(t, db.QueryRow(`SELECT source_id FROM knowledge_edges WHERE id = 3`).Scan(&endpoint))
+	assert.Equal(t, 1, endpoint)
+
+	_, err = service.MergeNodes(ctx, 1, []int{1})
+	assert.ErrorIs(t, err, ErrInvalidResolution)
+	_, err = service.MergeNodes(ctx, 1, []int{999})
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+}
+
+func TestRAGService_GraphTraversal(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	testVector := pgvector.NewVector(make([]float32, 1536))
+	_, err := db.Exec(`
+		INSERT INTO knowledge_nodes (name, type, properties, embedding)
+		VALUES
+			('Jane Smith', 'person', '{}'::jsonb, $1),
+			('Acme', 'organization', '{}'::jsonb, $1),
+			('Go', 'technology', '{}'::jsonb, $1),
+			('Google', 'organization', '{}'::jsonb, $1)
+	`, testVector)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO knowledge_edges (source_id, target_id, relationship_type, properties)
+		VALUES (1, 2, 'works_at', '{}'::jsonb), (2, 3, 'uses', '{}'::jsonb), (4, 3, 'created', '{}'::jsonb)
+	`)
+	require.NoError(t, err)
+
+	neighbors, err := service.GetNodeNeighbors(ctx, &models.NeighborsRequest{NodeID: 2})
+	require.NoError(t, err)
+	require.Len(t, neighbors.Neighbors, 2)
+	assert.Equal(t, "uses", neighbors.Neighbors[0].Edge.RelationshipType)
+	assert.Equal(t, GraphDirectionOut, neighbors.Neighbors[0].Direction)
+	assert.Equal(t, "Jane Smith", neighbors.Neighbors[1].Node.Name)
+	assert.Equal(t, GraphDirectionIn, neighbors.Neighbors[1].Direction)
+
+	neighbors, err = service.GetNodeNeighbors(ctx, &models.NeighborsRequest{NodeID: 2, Direction: GraphDirectionIn})
+	require.NoError(t, err)
+	require.Len(t, neighbors.Neighbors, 1)
+	assert.Equal(t, "Jane Smith", neighbors.Neighbors[0].Node.Name)
+
+	subgraph, err := service.GetSubgraph(ctx, &models.SubgraphRequest{NodeID: 1, Hops: 2})
+	require.NoError(t, err)
+	require.Len(t, subgraph.Nodes, 3)
+	assert.Equal(t, 2, subgraph.Nodes[2].Hop)
+	assert.Len(t, subgraph.Edges, 2)
+	assert.False(t, subgraph.Truncated)
+
+	path, err := service.FindPath(ctx, &models.PathRequest{SourceID: 1, TargetID: 4})
+	require.NoError(t, err)
+	require.True(t, path.Found)
+	assert.Equal(t, 3, path.Hops)
+	assert.Equal(t, "Google", path.Nodes[3].Name)
+
+	// Google is not reachable following the edges forwards
+	path, err = service.FindPath(ctx, &models.PathRequest{SourceID: 1, TargetID: 4, Direction: GraphDirectionOut})
+	require.NoError(t, err)
+	assert.False(t, path.Found)
+
+	_, err = service.GetSubgraph(ctx, &models.SubgraphRequest{NodeID: 999})
+	assert.ErrorIs(t, err, ErrNodeNotFound)
+	_, err = service.FindPath(ctx, &models.PathRequest{SourceID: 1, TargetID: 4, MaxHops: 99})
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+}
+
+func TestRAGService_ExportKnowledgeGraph(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+
+	ctx := context.Background()
+	testVector := pgvector.NewVector(make([]float32, 1536))
+	_, err := db.Exec(`
+		INSERT INTO knowledge_nodes (name, type, properties, embedding)
+		VALUES ('Jane Smith', 'person', '{}'::jsonb, $1), ('Acme', 'organization', '{}'::jsonb, $1)
+	`, testVector)
+	require.NoError(t, err)
+	_, err = db.Exec(`
+		INSERT INTO knowledge_edges (source_id, target_id, relationship_type, properties)
+		VALUES (1, 2, 'works_at', '{}'::jsonb)
+	`)
+	require.NoError(t, err)
+
+	var b bytes.Buffer
+	require.NoError(t, service.ExportKnowledgeGraph(ctx, &models.GraphExportRequest{Format: ExportFormatCypher}, &b))
+	assert.Contains(t, b.String(), "MERGE (n:Entity {id: 2})")
+	assert.Contains(t, b.String(), "MERGE (s)-[r:`works_at` {id: 1}]->(t)")
+
+	// Edges to nodes outside the query are left out
+	b.Reset()
+	require.NoError(t, service.ExportKnowledgeGraph(ctx, &models.GraphExportRequest{Format: ExportFormatDOT, Query: "jane"}, &b))
+	assert.Contains(t, b.String(), "Jane Smith")
+	assert.NotContains(t, b.String(), "->")
+
+	err = service.ExportKnowledgeGraph(ctx, &models.GraphExportRequest{Format: "csv"}, &b)
+	assert.ErrorIs(t, err, ErrInvalidGraphQuery)
+}
+
+// waitForEmbeddingMigration waits until the latest embedding migration has finished
+func waitForEmbeddingMigration(t *testing.T, service *RAGService) *models.EmbeddingMigration {
+	var migration *models.EmbeddingMigration
+	require.Eventually(t, func() bool {
+		var err error
+		migration, err = service.GetEmbeddingMigration(context.Background())
+		require.NoError(t, err)
+		return migration != nil && migration.Status != "running" && service.activeMigration() == nil
+	}, 10*time.Second, 50*time.Millisecond)
+	return migration
+}
+
+func TestRAGService_EmbeddingMigration(t *testing.T) {
+	db := setupTestDB(t)
+	defer db.Close()
+
+	cfg := config.LoadTestConfig()
+	service := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+	ctx := context.Background()
+
+	require.NoError(t, service.ProcessDocument(ctx, &models.ProcessDocumentRequest{
+		URL:     "https://example.com/migrated",
+		Title:   "Migrated",
+		Content: "Embeddings of this document are migrated to a smaller model.",
+	}))
+	_, err := db.Exec(`
+		INSERT INTO documents (url, title, content, embedding, embedding_model, embedding_dimensions)
+		VALUES ('https://example.com/broken', 'Broken', 'broken', $1, 'hash', 1536)
+	`, pgvector.NewVector(NewHashEmbedder(1536).embed("broken")))
+	require.NoError(t, err)
+
+	embeddingDimensions := func() int {
+		var dimensions int
+		require.NoError(t, db.QueryRow(`
+			SELECT atttypmod FROM pg_attribute WHERE attrelid = 'chunks'::regclass AND attname = 'embedding'
+		`).Scan(&dimensions))
+		return dimensions
+	}
+
+	// A row that keeps failing to re-embed stops the cut-over and keeps its embedding
+	target := &failingEmbedder{HashEmbedder: *NewHashEmbedder(8), fail: map[string]bool{"broken": true}}
+	_, err = service.startEmbeddingMigration(ctx, "hash", target)
+	require.NoError(t, err)
+	migration := waitForEmbeddingMigration(t, service)
+	assert.Equal(t, "failed", migration.Status)
+	assert.Equal(t, 1, migration.FailedCount)
+	assert.Equal(t, 1536, embeddingDimensions())
+	assert.Equal(t, 1536, service.currentEmbedder().Dimensions())
+
+	var unembedded int
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM documents WHERE embedding IS NULL`).Scan(&unembedded))
+	assert.Equal(t, 0, unembedded)
+
+	// Once every row re-embeds, the columns are swapped
+	delete(target.fail, "broken")
+	_, err = service.startEmbeddingMigration(ctx, "hash", target)
+	require.NoError(t, err)
+	migration = waitForEmbeddingMigration(t, service)
+	assert.Equal(t, "completed", migration.Status)
+	assert.Equal(t, 0, migration.FailedCount)
+	assert.Equal(t, 8, embeddingDimensions())
+	assert.Equal(t, 8, service.currentEmbedder().Dimensions())
+
+	require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM chunks WHERE embedding IS NULL`).Scan(&unembedded))
+	assert.Equal(t, 0, unembedded)
+	assert.Eventually(t, func() bool {
+		var stale int
+		require.NoError(t, db.QueryRow(`SELECT COUNT(*) FROM documents WHERE embedding_dimensions <> 8`).Scan(&stale))
+		return stale == 0
+	}, 5*time.Second, 50*time.Millisecond)
+
+	response, err := service.Query(ctx, "migrated model")
+	require.NoError(t, err)
+	assert.NotEmpty(t, response.Results)
+
+	// A restart still configured with the old model uses the migrated one
+	restarted := NewRAGService(db, cfg.OpenAIKey, cfg.OpenAIBaseURL, cfg.MCPEndpoint)
+	require.NoError(t, restarted.CheckEmbeddingSchema(ctx))
+	assert.Equal(t, 8, restarted.currentEmbedder().Dimensions())
+}
+
 func TestRAGService_QueueURL(t *testing.T) {
 	db := setupTestDB(t)
 	defer db.Close()
@@ -172,7 +731,7 @@ func TestRAGService_QueueURL(t *testing.T) {
 
 	// Test adding valid URL
 	url := "https://example.com/test"
-	err := service.QueueURL(ctx, url)
+	err := service.QueueURL(ctx, url, nil)
 	assert.NoError(t, err)
 
 	// Verify URL was added to queue
@@ -188,7 +747,7 @@ func TestRAGService_QueueURL(t *testing.T) {
 	assert.Equal(t, "pending", status)
 
 	// Test adding empty URL should return error
-	err = service.QueueURL(ctx, "")
+	err = service.QueueURL(ctx, "", nil)
 	assert.Error(t, err)
 }
 
@@ -203,7 +762,7 @@ func TestRAGService_ProcessURLQueue(t *testing.T) {
 
 	// Add test URL to queue
 	url := "https://example.com/test"
-	err := service.QueueURL(ctx, url)
+	err := service.QueueURL(ctx, url, nil)
 	assert.NoError(t, err)
 
 	// Start background workers
@@ -0,0 +1,268 @@
+package service
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"rag-data-service/config"
+
+	openai "github.com/sashabaranov/go-openai"
+)
+
+// Reranker defines the interface for rescoring retrieved passages against a query
+type Reranker interface {
+	// Rerank returns one relevance score per document, in the same order;
+	// higher scores are more relevant
+	Rerank(ctx context.Context, query string, documents []string) ([]float64, error)
+	// Name identifies the reranker and its model
+	Name() string
+}
+
+// NewReranker creates a reranker for the configured provider. It returns
+// nil if reranking is disabled.
+func NewReranker(cfg config.RerankConfig, client *openai.Client) (Reranker, error) {
+	switch cfg.Provider {
+	case "":
+		return nil, nil
+	case "http":
+		if cfg.URL == "" {
+			return nil, fmt.Errorf("rerank URL is required for the http reranker")
+		}
+		return NewHTTPReranker(cfg.URL, cfg.APIKey, cfg.Model, cfg.Format, time.Duration(cfg.TimeoutSec)*time.Second), nil
+	case "llm":
+		model := cfg.Model
+		if model == "" {
+			model = openai.GPT4oMini
+		}
+		return NewLLMReranker(client, model), nil
+	default:
+		return nil, fmt.Errorf("unknown rerank provider: %s", cfg.Provider)
+	}
+}
+
+// Request formats of the HTTP reranker
+const (
+	// RerankFormatCohere is the format of Cohere's /v1/rerank, also used by Jina
+	RerankFormatCohere = "cohere"
+	// RerankFormatTEI is the format of Hugging Face text-embeddings-inference /rerank
+	RerankFormatTEI = "tei"
+)
+
+// HTTPReranker scores passages with a cross-encoder served over HTTP
+type HTTPReranker struct {
+	url    string
+	apiKey string
+	model  string
+	format string
+	client *http.Client
+}
+
+// NewHTTPReranker creates a new HTTP cross-encoder reranker
+func NewHTTPReranker(url, apiKey, model, format string, timeout time.Duration) *HTTPReranker {
+	if format == "" {
+		format = RerankFormatCohere
+	}
+	if timeout <= 0 {
+		timeout = 30 * time.Second
+	}
+	return &HTTPReranker{
+		url:    url,
+		apiKey: apiKey,
+		model:  model,
+		format: format,
+		client: &http.Client{Timeout: timeout},
+	}
+}
+
+// Name returns the reranker name
+func (r *HTTPReranker) Name() string {
+	if r.model == "" {
+		return "http"
+	}
+	return "http:" + r.model
+}
+
+// rerankResult is a scored document in a reranker response. Cohere and Jina
+// name the score relevance_score, TEI names it score.
+type rerankResult struct {
+	Index          int      `json:"index"`
+	RelevanceScore *float64 `json:"relevance_score"`
+	Score          *float64 `json:"score"`
+}
+
+// Rerank scores documents against query with the cross-encoder
+func (r *HTTPReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	var payload map[string]interface{}
+	if r.format == RerankFormatTEI {
+		payload = map[string]interface{}{
+			"query": query,
+			"texts": documents,
+		}
+	} else {
+		payload = map[string]interface{}{
+			"query":     query,
+			"documents": documents,
+			"top_n":     len(documents),
+		}
+		if r.model != "" {
+			payload["model"] = r.model
+		}
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal rerank request: %w", err)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, r.url, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create rerank request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if r.apiKey != "" {
+		req.Header.Set("Authorization", "Bearer "+r.apiKey)
+	}
+
+	resp, err := r.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to call reranker: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return nil, fmt.Errorf("reranker returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(message)))
+	}
+
+	// TEI returns a bare array, Cohere and Jina wrap the results in an object
+	var results []rerankResult
+	if r.format == RerankFormatTEI {
+		err = json.NewDecoder(resp.Body).Decode(&results)
+	} else {
+		var wrapped struct {
+			Results []rerankResult `json:"results"`
+		}
+		err = json.NewDecoder(resp.Body).Decode(&wrapped)
+		results = wrapped.Results
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode rerank response: %w", err)
+	}
+
+	scores := make([]float64, len(documents))
+	seen := make([]bool, len(documents))
+	for _, result := range results {
+		if result.Index < 0 || result.Index >= len(documents) {
+			return nil, fmt.Errorf("reranker returned invalid index %d", result.Index)
+		}
+		switch {
+		case result.RelevanceScore != nil:
+			scores[result.Index] = *result.RelevanceScore
+		case result.Score != nil:
+			scores[result.Index] = *result.Score
+		default:
+			return nil, fmt.Errorf("reranker returned no score for index %d", result.Index)
+		}
+		seen[result.Index] = true
+	}
+	for i, ok := range seen {
+		if !ok {
+			return nil, fmt.Errorf("reranker returned no score for index %d", i)
+		}
+	}
+
+	return scores, nil
+}
+
+// maxJudgePassageRunes bounds the length of each passage shown to the LLM judge
+const maxJudgePassageRunes = 2000
+
+// LLMReranker asks a chat model to judge the relevance of each passage
+type LLMReranker struct {
+	client *openai.Client
+	model  string
+}
+
+// NewLLMReranker creates a new LLM judge reranker
+func NewLLMReranker(client *openai.Client, model string) *LLMReranker {
+	return &LLMReranker{
+		client: client,
+		model:  model,
+	}
+}
+
+// Name returns the reranker name
+func (r *LLMReranker) Name() string {
+	return "llm:" + r.model
+}
+
+// Rerank scores each document from 0 to 10 with a single chat completion
+func (r *LLMReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	if len(documents) == 0 {
+		return nil, nil
+	}
+
+	var prompt strings.Builder
+	fmt.Fprintf(&prompt, "Query: %s\n\n", query)
+	for i, document := range documents {
+		if runes := []rune(document); len(runes) > maxJudgePassageRunes {
+			document = string(runes[:maxJudgePassageRunes])
+		}
+		fmt.Fprintf(&prompt, "Passage %d:\n%s\n\n", i, document)
+	}
+	fmt.Fprintf(&prompt, `Rate how well each passage answers the query from 0 (irrelevant) to 10 (fully answers it).
+Respond with only a JSON object of the form {"scores": [s0, s1, ...]} holding exactly %d numbers, one per passage in order.`, len(documents))
+
+	resp, err := r.client.CreateChatCompletion(ctx, openai.ChatCompletionRequest{
+		Model: r.model,
+		Messages: []openai.ChatCompletionMessage{
+			{Role: openai.ChatMessageRoleSystem, Content: "You are a search relevance judge. You only reply with JSON."},
+			{Role: openai.ChatMessageRoleUser, Content: prompt.String()},
+		},
+		Temperature: 0,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to call LLM reranker: %w", err)
+	}
+	if len(resp.Choices) == 0 {
+		return nil, fmt.Errorf("LLM reranker returned no choices")
+	}
+
+	scores, err := parseJudgeScores(resp.Choices[0].Message.Content, len(documents))
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse LLM reranker response: %w", err)
+	}
+	return scores, nil
+}
+
+// parseJudgeScores extracts the scores object from the judge's reply,
+// tolerating surrounding prose or code fences
+func parseJudgeScores(reply string, count int) ([]float64, error) {
+	start := strings.Index(reply, "{")
+	end := strings.LastIndex(reply, "}")
+	if start < 0 || end < start {
+		return nil, fmt.Errorf("no JSON object in reply")
+	}
+
+	var parsed struct {
+		Scores []float64 `json:"scores"`
+	}
+	if err := json.Unmarshal([]byte(reply[start:end+1]), &parsed); err != nil {
+		return nil, err
+	}
+	if len(parsed.Scores) != count {
+		return nil, fmt.Errorf("expected %d scores, got %d", count, len(parsed.Scores))
+	}
+
+	return parsed.Scores, nil
+}
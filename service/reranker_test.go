@@ -0,0 +1,168 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"rag-data-service/models"
+
+	openai "github.com/sashabaranov/go-openai"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHTTPReranker_Cohere(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "Bearer secret", r.Header.Get("Authorization"))
+
+		var req struct {
+			Model     string   `json:"model"`
+			Query     string   `json:"query"`
+			Documents []string `json:"documents"`
+			TopN      int      `json:"top_n"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, "rerank-v3.5", req.Model)
+		assert.Equal(t, "install on linux", req.Query)
+		assert.Equal(t, 2, req.TopN)
+
+		// Results come back sorted by relevance rather than in input order
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"results": []map[string]interface{}{
+				{"index": 1, "relevance_score": 0.9},
+				{"index": 0, "relevance_score": 0.1},
+			},
+		})
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(server.URL, "secret", "rerank-v3.5", RerankFormatCohere, 0)
+	scores, err := reranker.Rerank(context.Background(), "install on linux", []string{"windows", "linux"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{0.1, 0.9}, scores)
+	assert.Equal(t, "http:rerank-v3.5", reranker.Name())
+}
+
+func TestHTTPReranker_TEI(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req struct {
+			Query string   `json:"query"`
+			Texts []string `json:"texts"`
+		}
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&req))
+		assert.Equal(t, []string{"a", "b", "c"}, req.Texts)
+
+		json.NewEncoder(w).Encode([]map[string]interface{}{
+			{"index": 2, "score": 3.5},
+			{"index": 0, "score": 1.25},
+			{"index": 1, "score": -2},
+		})
+	}))
+	defer server.Close()
+
+	reranker := NewHTTPReranker(server.URL, "", "", RerankFormatTEI, 0)
+	scores, err := reranker.Rerank(context.Background(), "q", []string{"a", "b", "c"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1.25, -2, 3.5}, scores)
+}
+
+func TestHTTPReranker_Errors(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"error status": func(w http.ResponseWriter, r *http.Request) {
+			http.Error(w, "overloaded", http.StatusServiceUnavailable)
+		},
+		"missing document": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"results": [{"index": 0, "relevance_score": 0.5}]}`))
+		},
+		"invalid index": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(`{"results": [{"index": 0, "relevance_score": 0.5}, {"index": 7, "relevance_score": 0.5}]}`))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			server := httptest.NewServer(handler)
+			defer server.Close()
+
+			reranker := NewHTTPReranker(server.URL, "", "", RerankFormatCohere, 0)
+			_, err := reranker.Rerank(context.Background(), "q", []string{"a", "b"})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestLLMReranker(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/chat/completions", r.URL.Path)
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"choices": []map[string]interface{}{
+				{"message": map[string]interface{}{
+					"role":    "assistant",
+					"content": "```json\n{\"scores\": [2, 9]}\n```",
+				}},
+			},
+		})
+	}))
+	defer server.Close()
+
+	clientConfig := openai.DefaultConfig("test")
+	clientConfig.BaseURL = server.URL
+	reranker := NewLLMReranker(openai.NewClientWithConfig(clientConfig), "gpt-4o-mini")
+
+	scores, err := reranker.Rerank(context.Background(), "q", []string{"a", "b"})
+	require.NoError(t, err)
+	assert.Equal(t, []float64{2, 9}, scores)
+}
+
+func TestParseJudgeScores(t *testing.T) {
+	scores, err := parseJudgeScores(`Here you go: {"scores": [1, 0.5, 10]}`, 3)
+	require.NoError(t, err)
+	assert.Equal(t, []float64{1, 0.5, 10}, scores)
+
+	_, err = parseJudgeScores(`{"scores": [1, 2]}`, 3)
+	assert.Error(t, err)
+
+	_, err = parseJudgeScores(`no scores`, 1)
+	assert.Error(t, err)
+}
+
+// stubReranker scores documents by a fixed table
+type stubReranker map[string]float64
+
+func (r stubReranker) Rerank(ctx context.Context, query string, documents []string) ([]float64, error) {
+	scores := make([]float64, len(documents))
+	for i, document := range documents {
+		scores[i] = r[document]
+	}
+	return scores, nil
+}
+
+func (r stubReranker) Name() string { return "stub" }
+
+func TestRerankHits(t *testing.T) {
+	s := NewRAGService(nil, "", "", "", WithReranker(stubReranker{"near miss": 0.2, "answer": 0.8}, 10))
+	hits := []searchHit{
+		{result: models.SearchResult{Content: "near miss", Score: 0.016}},
+		{result: models.SearchResult{Content: "answer", Score: 0.015}},
+	}
+
+	require.NoError(t, s.rerankHits(context.Background(), "q", hits))
+
+	assert.Equal(t, "answer", hits[0].result.Content)
+	assert.Equal(t, 0.8, hits[0].result.Score)
+	assert.Equal(t, 0.015, *hits[0].result.RetrievalScore)
+	assert.Equal(t, 0.8, *hits[0].result.RerankScore)
+	assert.Equal(t, "near miss", hits[1].result.Content)
+
+	opts, err := s.resolveQueryOptions(&models.QueryRequest{Query: "q"})
+	require.NoError(t, err)
+	assert.True(t, opts.rerank)
+	assert.Equal(t, 10, opts.rerankCandidates)
+
+	disabled := false
+	opts, err = s.resolveQueryOptions(&models.QueryRequest{Query: "q", Rerank: &disabled, RerankCandidates: 30})
+	require.NoError(t, err)
+	assert.False(t, opts.rerank)
+	assert.Equal(t, 30, opts.rerankCandidates)
+}
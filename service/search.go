@@ -0,0 +1,640 @@
+package service
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"rag-data-service/models"
+
+	"github.com/lib/pq"
+	"github.com/pgvector/pgvector-go"
+)
+
+// ErrInvalidQuery is returned for query requests with invalid options
+var ErrInvalidQuery = errors.New("invalid query")
+
+// maxQueryDepth bounds offset plus limit so that deep pages stay cheap
+const maxQueryDepth = 1000
+
+// minFusionCandidates is the smallest number of candidates taken from each
+// ranking before they are fused
+const minFusionCandidates = 50
+
+// mergeOverfetch is how many more chunks are fetched when returning parent
+// sections or context windows, since several matching chunks may be merged
+// into one result
+const mergeOverfetch = 4
+
+// queryOptions are the effective settings of a query request
+type queryOptions struct {
+	limit         int
+	offset        int
+	minScore      float64
+	maxDistance   float64
+	vectorWeight  float64
+	keywordWeight float64
+	rrfK          int
+	// rerank is set when the configured reranker orders the top rerankCandidates chunks
+	rerank           bool
+	rerankCandidates int
+	// mmr is set when results are diversified by maximal marginal relevance
+	mmr            bool
+	mmrLambda      float64
+	maxPerDocument int
+	// expansion is the query expansion mode, with the number of paraphrases of multi_query
+	expansion   string
+	paraphrases int
+	// explain is set when results carry how they were ranked
+	explain bool
+	// graph is set when chunks reached through the knowledge graph are fused into the results
+	graph             bool
+	graphHops         int
+	graphWeight       float64
+	graphNodeDistance float64
+}
+
+// fusionScale scales fused reciprocal rank scores to 0..1; it is the inverse
+// of the score of a chunk ranked first by both the vector and full-text rankings
+func (opts queryOptions) fusionScale() float64 {
+	return float64(opts.rrfK+1) / (opts.vectorWeight + opts.keywordWeight)
+}
+
+// searchHit is a matching chunk with the parent section it belongs to
+type searchHit struct {
+	result    models.SearchResult
+	parentID  sql.NullInt64
+	embedding []float32 // only loaded for maximal marginal relevance
+}
+
+// Query searches for relevant content based on the query
+func (s *RAGService) Query(ctx context.Context, query string) (*models.QueryResponse, error) {
+	return s.QueryWithOptions(ctx, &models.QueryRequest{Query: query})
+}
+
+// QueryWithOptions searches for relevant content with the options of the
+// request. Invalid options are reported as ErrInvalidQuery.
+func (s *RAGService) QueryWithOptions(ctx context.Context, req *models.QueryRequest) (*models.QueryResponse, error) {
+	opts, err := s.resolveQueryOptions(req)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fetch everything up to the end of the page, plus one row to tell whether there is more
+	depth := opts.offset + opts.limit
+	fetchLimit := depth + 1
+	if req.ReturnParents || req.ContextWindow > 0 {
+		fetchLimit = depth*mergeOverfetch + 1
+	}
+
+	// The reranker sees at least its configured number of candidates, and
+	// diversification needs more candidates than it picks
+	searchLimit := fetchLimit
+	if opts.rerank {
+		searchLimit = max(searchLimit, opts.rerankCandidates)
+	}
+	diversify := opts.mmr || opts.maxPerDocument > 0
+	if diversify {
+		searchLimit = max(searchLimit, fetchLimit*mergeOverfetch)
+	}
+
+	var timer *stageTimer
+	if opts.explain {
+		timer = newStageTimer()
+	}
+
+	expansion := s.expandQuery(ctx, req.Query, opts)
+	if opts.expansion != QueryExpansionNone {
+		timer.lap("expansion")
+	}
+
+	// The query embedding is compared to the stored ones, so an embedding
+	// migration must not cut over between embedding the query and searching
+	release := s.holdCutover()
+	hits, queryEmbedding, err := s.searchExpanded(ctx, req.Query, expansion, req.Filters, opts, searchLimit, timer)
+	if err != nil {
+		release()
+		return nil, err
+	}
+
+	var graph *models.KnowledgeGraph
+	if opts.graph {
+		hits, graph, err = s.graphAugment(ctx, req.Query, queryEmbedding, hits, req.Filters, opts)
+		if err != nil {
+			release()
+			return nil, err
+		}
+		timer.lap("graph")
+	}
+	release()
+	if opts.explain {
+		// Keywords are matched against the chunk, before it is merged into a parent or window
+		keywords := extractKeywords(req.Query)
+		for _, hit := range hits {
+			hit.result.Explain.MatchedKeywords = matchedKeywords(keywords, hit.result.Content)
+		}
+	}
+
+	var rerankedBy string
+	if opts.rerank && len(hits) > 0 {
+		if err := s.rerankHits(ctx, req.Query, hits); err != nil {
+			log.Printf("Warning: reranking failed, keeping retrieval order: %v", err)
+		} else {
+			rerankedBy = s.reranker.Name()
+		}
+		timer.lap("rerank")
+	}
+	more := len(hits) >= fetchLimit
+	if diversify {
+		hits = diversifyHits(hits, fetchLimit, opts.mmr, opts.mmrLambda, opts.maxPerDocument)
+		timer.lap("diversify")
+	} else if len(hits) > fetchLimit {
+		hits = hits[:fetchLimit]
+	}
+
+	var results []models.SearchResult
+	if req.ReturnParents {
+		results, err = s.expandToParents(ctx, hits)
+		if err != nil {
+			return nil, err
+		}
+		timer.lap("parents")
+	} else {
+		for _, hit := range hits {
+			results = append(results, hit.result)
+		}
+	}
+
+	results, err = s.expandContextWindows(ctx, results, req.ContextWindow)
+	if err != nil {
+		return nil, err
+	}
+	if req.ContextWindow > 0 {
+		timer.lap("context_window")
+	}
+
+	resp := &models.QueryResponse{
+		Results:   []models.SearchResult{},
+		Limit:     opts.limit,
+		Offset:    opts.offset,
+		Reranker:  rerankedBy,
+		Expansion: expansion,
+		Graph:     graph,
+	}
+	if opts.explain {
+		resp.Explain = queryExplanation(req, opts, timer)
+	}
+	if opts.offset < len(results) {
+		resp.Results = results[opts.offset:min(depth, len(results))]
+	}
+	// When results are merged, a full fetch may hide further results
+	if len(results) > depth || more {
+		resp.NextOffset = depth
+		resp.NextCursor = encodeQueryCursor(depth, queryFingerprint(req))
+	}
+
+	return resp, nil
+}
+
+// resolveQueryOptions validates the request and fills unset options from the configured defaults
+func (s *RAGService) resolveQueryOptions(req *models.QueryRequest) (queryOptions, error) {
+	defaults := s.queryDefaults
+	opts := queryOptions{
+		limit:         defaults.Limit,
+		offset:        req.Offset,
+		minScore:      defaults.MinScore,
+		maxDistance:   defaults.MaxDistance,
+		vectorWeight:  defaults.VectorWeight,
+		keywordWeight: defaults.KeywordWeight,
+		rrfK:          defaults.RRFK,
+
+		rerank:           s.reranker != nil && (req.Rerank == nil || *req.Rerank),
+		rerankCandidates: s.rerankCandidates,
+
+		mmr:            req.MMR,
+		mmrLambda:      defaults.MMRLambda,
+		maxPerDocument: defaults.MaxPerDocument,
+
+		expansion:   defaults.Expansion,
+		paraphrases: defaults.Paraphrases,
+
+		explain: req.Explain,
+
+		graph:             req.Graph,
+		graphHops:         defaults.GraphHops,
+		graphWeight:       defaults.GraphWeight,
+		graphNodeDistance: defaults.GraphNodeDistance,
+	}
+
+	if req.Limit < 0 || req.Limit > defaults.MaxLimit {
+		return opts, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidQuery, defaults.MaxLimit)
+	}
+	if req.Limit > 0 {
+		opts.limit = req.Limit
+	}
+
+	if req.Cursor != "" {
+		if req.Offset != 0 {
+			return opts, fmt.Errorf("%w: offset and cursor cannot be combined", ErrInvalidQuery)
+		}
+		offset, fingerprint, err := decodeQueryCursor(req.Cursor)
+		if err != nil || fingerprint != queryFingerprint(req) {
+			return opts, fmt.Errorf("%w: cursor does not belong to this query", ErrInvalidQuery)
+		}
+		opts.offset = offset
+	}
+	if opts.offset < 0 || opts.offset+opts.limit > maxQueryDepth {
+		return opts, fmt.Errorf("%w: offset plus limit must be between 1 and %d", ErrInvalidQuery, maxQueryDepth)
+	}
+
+	if req.MinScore != nil {
+		opts.minScore = *req.MinScore
+	}
+	if opts.minScore < 0 || opts.minScore > 1 {
+		return opts, fmt.Errorf("%w: min_score must be between 0 and 1", ErrInvalidQuery)
+	}
+	if req.MaxDistance != nil {
+		opts.maxDistance = *req.MaxDistance
+	}
+	if opts.maxDistance <= 0 || opts.maxDistance > 2 {
+		return opts, fmt.Errorf("%w: max_distance must be greater than 0 and at most 2", ErrInvalidQuery)
+	}
+
+	if req.VectorWeight != nil {
+		opts.vectorWeight = *req.VectorWeight
+	}
+	if req.KeywordWeight != nil {
+		opts.keywordWeight = *req.KeywordWeight
+	}
+	if opts.vectorWeight < 0 || opts.keywordWeight < 0 || opts.vectorWeight+opts.keywordWeight == 0 {
+		return opts, fmt.Errorf("%w: vector_weight and keyword_weight must not be negative or both zero", ErrInvalidQuery)
+	}
+
+	if req.ContextWindow < 0 || req.ContextWindow > MaxContextWindow {
+		return opts, fmt.Errorf("%w: context_window must be between 0 and %d", ErrInvalidQuery, MaxContextWindow)
+	}
+
+	if req.RerankCandidates < 0 || req.RerankCandidates > maxQueryDepth {
+		return opts, fmt.Errorf("%w: rerank_candidates must be between 1 and %d", ErrInvalidQuery, maxQueryDepth)
+	}
+	if req.RerankCandidates > 0 {
+		opts.rerankCandidates = req.RerankCandidates
+	}
+
+	if err := validateQueryFilters(req.Filters); err != nil {
+		return opts, err
+	}
+
+	if req.MMRLambda != nil {
+		opts.mmrLambda = *req.MMRLambda
+	}
+	if opts.mmrLambda < 0 || opts.mmrLambda > 1 {
+		return opts, fmt.Errorf("%w: mmr_lambda must be between 0 and 1", ErrInvalidQuery)
+	}
+	if req.MaxPerDocument != nil {
+		opts.maxPerDocument = *req.MaxPerDocument
+	}
+	if opts.maxPerDocument < 0 {
+		return opts, fmt.Errorf("%w: max_per_document must not be negative", ErrInvalidQuery)
+	}
+
+	if req.Expansion != "" {
+		opts.expansion = req.Expansion
+	}
+	switch opts.expansion {
+	case "":
+		opts.expansion = QueryExpansionNone
+	case QueryExpansionNone, QueryExpansionMultiQuery, QueryExpansionHyDE:
+	default:
+		return opts, fmt.Errorf("%w: expansion must be one of: %s, %s, %s", ErrInvalidQuery,
+			QueryExpansionNone, QueryExpansionMultiQuery, QueryExpansionHyDE)
+	}
+	if req.Paraphrases < 0 || req.Paraphrases > maxParaphrases {
+		return opts, fmt.Errorf("%w: paraphrases must be between 1 and %d", ErrInvalidQuery, maxParaphrases)
+	}
+	if req.Paraphrases > 0 {
+		opts.paraphrases = req.Paraphrases
+	}
+
+	if req.GraphHops < 0 || req.GraphHops > 2 {
+		return opts, fmt.Errorf("%w: graph_hops must be 1 or 2", ErrInvalidQuery)
+	}
+	if req.GraphHops > 0 {
+		opts.graphHops = req.GraphHops
+	}
+
+	return opts, nil
+}
+
+// rerankHits rescores the hits with the reranker and sorts them by their new
+// score. The retrieval score is kept alongside the rerank score.
+func (s *RAGService) rerankHits(ctx context.Context, query string, hits []searchHit) error {
+	documents := make([]string, len(hits))
+	for i, hit := range hits {
+		documents[i] = hit.result.Content
+	}
+
+	scores, err := s.reranker.Rerank(ctx, query, documents)
+	if err != nil {
+		return err
+	}
+	if len(scores) != len(hits) {
+		return fmt.Errorf("reranker returned %d scores for %d documents", len(scores), len(hits))
+	}
+
+	for i := range hits {
+		r := &hits[i].result
+		retrievalScore, rerankScore := r.Score, scores[i]
+		r.RetrievalScore = &retrievalScore
+		r.RerankScore = &rerankScore
+		r.Score = rerankScore
+		if r.Explain != nil {
+			r.Explain.RerankScore = &rerankScore
+		}
+	}
+	sort.SliceStable(hits, func(i, j int) bool { return hits[i].result.Score > hits[j].result.Score })
+
+	return nil
+}
+
+// queryCursor is the decoded form of a pagination cursor
+type queryCursor struct {
+	Offset      int    `json:"o"`
+	Fingerprint string `json:"f"`
+}
+
+// queryFingerprint identifies the options that determine the ranking of a
+// query, so that a cursor cannot be replayed against a different query
+func queryFingerprint(req *models.QueryRequest) string {
+	optional := func(v *float64) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatFloat(*v, 'g', -1, 64)
+	}
+	optionalBool := func(v *bool) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.FormatBool(*v)
+	}
+	optionalInt := func(v *int) string {
+		if v == nil {
+			return "-"
+		}
+		return strconv.Itoa(*v)
+	}
+	var filters string
+	if req.Filters != nil {
+		data, _ := json.Marshal(req.Filters)
+		filters = string(data)
+	}
+	key := strings.Join([]string{
+		req.Query,
+		strconv.FormatBool(req.ReturnParents),
+		strconv.Itoa(req.ContextWindow),
+		optional(req.MinScore),
+		optional(req.MaxDistance),
+		optional(req.VectorWeight),
+		optional(req.KeywordWeight),
+		optionalBool(req.Rerank),
+		strconv.Itoa(req.RerankCandidates),
+		strconv.FormatBool(req.MMR),
+		optional(req.MMRLambda),
+		optionalInt(req.MaxPerDocument),
+		filters,
+		req.Expansion,
+		strconv.Itoa(req.Paraphrases),
+		strconv.FormatBool(req.Graph),
+		strconv.Itoa(req.GraphHops),
+	}, "\x00")
+	return contentHash(key)[:16]
+}
+
+// encodeQueryCursor returns an opaque cursor for the page starting at offset
+func encodeQueryCursor(offset int, fingerprint string) string {
+	data, _ := json.Marshal(queryCursor{Offset: offset, Fingerprint: fingerprint})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// decodeQueryCursor returns the offset and query fingerprint of a cursor
+func decodeQueryCursor(cursor string) (int, string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return 0, "", fmt.Errorf("failed to decode cursor: %w", err)
+	}
+	var c queryCursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return 0, "", fmt.Errorf("failed to decode cursor: %w", err)
+	}
+	return c.Offset, c.Fingerprint, nil
+}
+
+// textSearchConfig is the PostgreSQL text search configuration of chunks.content_tsv
+const textSearchConfig = "english"
+
+// searchChunks returns the chunks that best match the query, best first. The
+// vector and full-text rankings are each computed over their own candidates
+// and combined with weighted reciprocal rank fusion:
+//
+//	score = vector_weight / (k + vector_rank) + keyword_weight / (k + lexical_rank)
+//
+// where a chunk missing from one ranking gets nothing from that term. The
+// score is scaled by fusionScale to 0..1 before it is compared to the
+// minimum score, so that 1 is a chunk ranked first by both rankings. Only
+// chunks that match the filters take part in either ranking. The vector
+// ranking uses queryEmbedding, which need not be the embedding of query.
+func (s *RAGService) searchChunks(ctx context.Context, query string, queryEmbedding pgvector.Vector, filters *models.QueryFilters, opts queryOptions, limit int) ([]searchHit, error) {
+	// Each ranking contributes more candidates than are returned so that
+	// chunks ranked well by both are not cut off
+	candidates := max(limit*2, minFusionCandidates)
+
+	// Filters are applied within each ranking so that they do not thin out the candidates
+	args := []interface{}{queryEmbedding, query, limit, opts.maxDistance,
+		opts.vectorWeight, opts.keywordWeight, opts.minScore, candidates, opts.rrfK, opts.mmr, opts.fusionScale()}
+	filter, args, err := queryFilterSQL(filters, args)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `
+		WITH q AS (
+			-- Match any of the query terms rather than all of them
+			SELECT replace(plainto_tsquery('`+textSearchConfig+`', $2)::text, '&', '|')::tsquery AS query
+		),
+		vector AS (
+			-- Rank the nearest chunks outside the scan so that it can use the vector index
+			SELECT id, distance, ROW_NUMBER() OVER (ORDER BY distance, id) AS rank
+			FROM (
+				SELECT c.id, c.embedding <=> $1 AS distance
+				FROM chunks c
+				JOIN documents d ON d.id = c.document_id
+				WHERE c.embedding <=> $1 < $4::float8`+filter+`
+				ORDER BY c.embedding <=> $1
+				LIMIT $8
+			) nearest
+		),
+		lexical AS (
+			SELECT c.id, ts_rank_cd(c.content_tsv, q.query, 32) AS score,
+				ROW_NUMBER() OVER (ORDER BY ts_rank_cd(c.content_tsv, q.query, 32) DESC, c.id) AS rank
+			FROM chunks c
+			JOIN documents d ON d.id = c.document_id
+			CROSS JOIN q
+			WHERE c.content_tsv @@ q.query`+filter+`
+			ORDER BY rank
+			LIMIT $8
+		),
+		fused AS (
+			SELECT
+				COALESCE(v.id, l.id) AS id,
+				(COALESCE($5::float8 / ($9::float8 + v.rank), 0) + COALESCE($6::float8 / ($9::float8 + l.rank), 0)) * $11::float8 AS score,
+				v.distance AS vector_distance,
+				v.rank AS vector_rank,
+				l.score AS lexical_score,
+				l.rank AS lexical_rank
+			FROM vector v
+			FULL OUTER JOIN lexical l ON v.id = l.id
+		)
+		SELECT
+			c.id,
+			c.content,
+			d.id as document_id,
+			d.url,
+			d.title,
+			COALESCE(c.metadata->>'section_path', ''),
+			COALESCE(c.chunk_index, 0),
+			COALESCE(c.start_position, 0),
+			COALESCE(c.end_position, 0),
+			c.parent_id,
+			CASE WHEN $10::boolean THEN c.embedding::text END,
+			f.score,
+			f.vector_distance,
+			f.vector_rank,
+			f.lexical_score,
+			f.lexical_rank
+		FROM fused f
+		JOIN chunks c ON c.id = f.id
+		JOIN documents d ON c.document_id = d.id
+		WHERE f.score >= $7::float8
+		ORDER BY f.score DESC, c.id ASC
+		LIMIT $3
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query chunks: %w", err)
+	}
+	defer rows.Close()
+
+	var hits []searchHit
+	for rows.Next() {
+		var hit searchHit
+		var embedding sql.NullString
+		var vectorDistance, lexicalScore sql.NullFloat64
+		var vectorRank, lexicalRank sql.NullInt64
+		r := &hit.result
+		if err := rows.Scan(&r.ChunkID, &r.Content, &r.DocumentID, &r.URL, &r.Title, &r.SectionPath,
+			&r.ChunkIndex, &r.StartPosition, &r.EndPosition, &hit.parentID, &embedding, &r.Score,
+			&vectorDistance, &vectorRank, &lexicalScore, &lexicalRank); err != nil {
+			return nil, fmt.Errorf("failed to scan chunk: %w", err)
+		}
+		if opts.explain {
+			r.Explain = resultExplanation(len(hits)+1, r.Score, vectorDistance, vectorRank, lexicalScore, lexicalRank)
+		}
+		if embedding.Valid {
+			var vector pgvector.Vector
+			if err := vector.Parse(embedding.String); err != nil {
+				return nil, fmt.Errorf("failed to parse chunk embedding: %w", err)
+			}
+			hit.embedding = vector.Slice()
+		}
+		hits = append(hits, hit)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating chunk rows: %w", err)
+	}
+
+	return hits, nil
+}
+
+// expandToParents replaces matching chunks with the text of their parent
+// sections. Each parent is returned once, at the rank of its best matching
+// chunk, and lists all of its matching chunks. Chunks without a parent are
+// returned as they are.
+func (s *RAGService) expandToParents(ctx context.Context, hits []searchHit) ([]models.SearchResult, error) {
+	var parentIDs []int64
+	for _, hit := range hits {
+		if hit.parentID.Valid {
+			parentIDs = append(parentIDs, hit.parentID.Int64)
+		}
+	}
+
+	parents := make(map[int64]models.SearchResult)
+	if len(parentIDs) > 0 {
+		rows, err := s.db.QueryContext(ctx, `
+			SELECT id, content, chunk_index, start_position, end_position
+			FROM parent_chunks
+			WHERE id = ANY($1)
+		`, pq.Array(parentIDs))
+		if err != nil {
+			return nil, fmt.Errorf("failed to query parent chunks: %w", err)
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var id int64
+			var parent models.SearchResult
+			if err := rows.Scan(&id, &parent.Content, &parent.ChunkIndex, &parent.StartPosition, &parent.EndPosition); err != nil {
+				return nil, fmt.Errorf("failed to scan parent chunk: %w", err)
+			}
+			parents[id] = parent
+		}
+
+		if err = rows.Err(); err != nil {
+			return nil, fmt.Errorf("error iterating parent chunk rows: %w", err)
+		}
+	}
+
+	var results []models.SearchResult
+	seen := make(map[int64]int)
+	for _, hit := range hits {
+		match := models.ChunkPosition{
+			ID:            hit.result.ChunkID,
+			ChunkIndex:    hit.result.ChunkIndex,
+			StartPosition: hit.result.StartPosition,
+			EndPosition:   hit.result.EndPosition,
+			Score:         hit.result.Score,
+		}
+
+		parent, ok := parents[hit.parentID.Int64]
+		if !hit.parentID.Valid || !ok {
+			results = append(results, hit.result)
+			continue
+		}
+
+		if i, ok := seen[hit.parentID.Int64]; ok {
+			results[i].MatchedChunks = append(results[i].MatchedChunks, match)
+			continue
+		}
+
+		result := hit.result
+		result.Content = parent.Content
+		result.Parent = &models.ChunkPosition{
+			ID:            int(hit.parentID.Int64),
+			ChunkIndex:    parent.ChunkIndex,
+			StartPosition: parent.StartPosition,
+			EndPosition:   parent.EndPosition,
+		}
+		result.MatchedChunks = []models.ChunkPosition{match}
+		seen[hit.parentID.Int64] = len(results)
+		results = append(results, result)
+	}
+
+	return results, nil
+}
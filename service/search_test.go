@@ -0,0 +1,76 @@
+package service
+
+import (
+	"errors"
+	"testing"
+
+	"rag-data-service/models"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResolveQueryOptions_Defaults(t *testing.T) {
+	s := NewRAGService(nil, "", "", "")
+
+	opts, err := s.resolveQueryOptions(&models.QueryRequest{Query: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, queryOptions{limit: 5, maxDistance: 0.5, vectorWeight: 0.3, keywordWeight: 0.7, rrfK: 60, rerankCandidates: 20, mmrLambda: 0.5, expansion: QueryExpansionNone, paraphrases: 3,
+		graphHops: 1, graphWeight: 0.5, graphNodeDistance: 0.3}, opts)
+
+	minScore, vectorWeight := 0.2, 1.0
+	opts, err = s.resolveQueryOptions(&models.QueryRequest{
+		Query:        "test",
+		Limit:        20,
+		Offset:       40,
+		MinScore:     &minScore,
+		VectorWeight: &vectorWeight,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, queryOptions{limit: 20, offset: 40, minScore: 0.2, maxDistance: 0.5, vectorWeight: 1, keywordWeight: 0.7, rrfK: 60, rerankCandidates: 20, mmrLambda: 0.5, expansion: QueryExpansionNone, paraphrases: 3,
+		graphHops: 1, graphWeight: 0.5, graphNodeDistance: 0.3}, opts)
+}
+
+func TestResolveQueryOptions_Invalid(t *testing.T) {
+	s := NewRAGService(nil, "", "", "")
+	zero, negative := 0.0, -1.0
+
+	for name, req := range map[string]*models.QueryRequest{
+		"limit above maximum":   {Limit: 101},
+		"negative offset":       {Offset: -1},
+		"page beyond depth":     {Offset: 999, Limit: 5},
+		"negative weight":       {VectorWeight: &negative},
+		"both weights zero":     {VectorWeight: &zero, KeywordWeight: &zero},
+		"zero max distance":     {MaxDistance: &zero},
+		"min score above one":   {MinScore: &[]float64{1.5}[0]},
+		"context window large":  {ContextWindow: MaxContextWindow + 1},
+		"rerank candidates":     {RerankCandidates: -1},
+		"mmr lambda above one":  {MMR: true, MMRLambda: &[]float64{1.5}[0]},
+		"negative per document": {MaxPerDocument: &[]int{-1}[0]},
+		"unknown expansion":     {Expansion: "synonyms"},
+		"too many paraphrases":  {Expansion: QueryExpansionMultiQuery, Paraphrases: maxParaphrases + 1},
+		"three graph hops":      {Graph: true, GraphHops: 3},
+		"malformed cursor":      {Cursor: "not a cursor"},
+		"cursor and offset":     {Cursor: encodeQueryCursor(5, queryFingerprint(&models.QueryRequest{})), Offset: 5},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := s.resolveQueryOptions(req)
+			assert.True(t, errors.Is(err, ErrInvalidQuery), "expected ErrInvalidQuery, got %v", err)
+		})
+	}
+}
+
+func TestQueryCursor(t *testing.T) {
+	s := NewRAGService(nil, "", "", "")
+	req := &models.QueryRequest{Query: "install on linux", ContextWindow: 1}
+	req.Cursor = encodeQueryCursor(10, queryFingerprint(req))
+
+	opts, err := s.resolveQueryOptions(req)
+	require.NoError(t, err)
+	assert.Equal(t, 10, opts.offset)
+
+	// A cursor cannot be replayed against a different query
+	other := &models.QueryRequest{Query: "install on windows", ContextWindow: 1, Cursor: req.Cursor}
+	_, err = s.resolveQueryOptions(other)
+	assert.True(t, errors.Is(err, ErrInvalidQuery))
+}